@@ -79,7 +79,7 @@ func (al *AttributeList) Map(conf *Configuration) map[AttributeTypeIdentifier]Tr
 	if al.attrMap == nil {
 		al.attrMap = make(map[AttributeTypeIdentifier]TranslatedString)
 		ctid := al.CredentialType().Identifier()
-		attrTypes := conf.CredentialTypes[ctid].AttributeTypes
+		attrTypes := conf.CredentialType(ctid).AttributeTypes
 		for i, val := range al.Strings() {
 			al.attrMap[attrTypes[i].GetAttributeTypeIdentifier()] = val
 		}
@@ -87,16 +87,25 @@ func (al *AttributeList) Map(conf *Configuration) map[AttributeTypeIdentifier]Tr
 	return al.attrMap
 }
 
-// Strings converts the current instance to human-readable strings.
+// Strings converts the current instance to human-readable strings, translating the attribute
+// values if their attribute types declare translations for them.
 func (al *AttributeList) Strings() []TranslatedString {
 	if al.strings == nil {
+		var attrtypes []*AttributeType
+		if credtype := al.CredentialType(); credtype != nil {
+			attrtypes = credtype.AttributeTypes
+		}
 		al.strings = make([]TranslatedString, len(al.Ints)-1)
 		for i := range al.Ints[1:] { // skip metadata
 			val := al.decode(i)
 			if val == nil {
 				continue
 			}
-			al.strings[i] = NewTranslatedString(val)
+			var attrtype *AttributeType
+			if i < len(attrtypes) {
+				attrtype = attrtypes[i]
+			}
+			al.strings[i] = attrtype.Translate(val)
 		}
 	}
 	return al.strings
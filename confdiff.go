@@ -0,0 +1,259 @@
+package irma
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiffKind describes how an item differs between two configurations.
+type DiffKind string
+
+const (
+	DiffKindAdded    = DiffKind("added")
+	DiffKindRemoved  = DiffKind("removed")
+	DiffKindModified = DiffKind("modified")
+)
+
+// A FieldDiff contains the old and new value of a field of a modified item, in JSON.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// An IdentifierDiff describes an item (e.g. a credential type) that was added, removed or modified.
+// For modified items, Fields contains the fields that differ.
+type IdentifierDiff struct {
+	ID     string       `json:"id"`
+	Kind   DiffKind     `json:"kind"`
+	Fields []*FieldDiff `json:"fields,omitempty"`
+}
+
+// A ConfigurationDiff contains the differences between two configurations, per type of item.
+// Public keys are identified by the issuer identifier and the key counter, e.g. "irma-demo.RU-2".
+type ConfigurationDiff struct {
+	SchemeManagers  []*IdentifierDiff `json:"schemeManagers,omitempty"`
+	Issuers         []*IdentifierDiff `json:"issuers,omitempty"`
+	CredentialTypes []*IdentifierDiff `json:"credentialTypes,omitempty"`
+	AttributeTypes  []*IdentifierDiff `json:"attributeTypes,omitempty"`
+	PublicKeys      []*IdentifierDiff `json:"publicKeys,omitempty"`
+}
+
+// Fields that are either derived from other fields or from the identifier of the item,
+// or that say something about our parsing of the item instead of the item itself.
+var diffSkippedFields = map[string]struct{}{
+	"XMLName":          {},
+	"Valid":            {},
+	"Status":           {},
+	"AttributeTypes":   {},
+	"CredentialTypeID": {},
+	"IssuerID":         {},
+	"SchemeManagerID":  {},
+	"Params":           {},
+}
+
+// Diff compares this configuration with the specified newer one, returning all scheme managers,
+// issuers, credential types, attribute types and public keys that were added, removed or modified.
+func (conf *Configuration) Diff(newer *Configuration) (*ConfigurationDiff, error) {
+	return conf.diff(newer, nil, false)
+}
+
+// DiffScheme is like Diff, but compares only the specified scheme manager and its contents,
+// e.g. before and after updating it.
+func (conf *Configuration) DiffScheme(newer *Configuration, id SchemeManagerIdentifier) (*ConfigurationDiff, error) {
+	return conf.diff(newer, &id, false)
+}
+
+// diff computes the differences with the newer configuration, restricted to the specified scheme
+// if it is not nil. If indexedKeys is set, public keys are compared not by parsing them but by
+// their hashes in the scheme indices. This is used when the older configuration has been replaced
+// by the newer one, so that the old public keys are no longer present in the file system.
+func (conf *Configuration) diff(newer *Configuration, scheme *SchemeManagerIdentifier, indexedKeys bool) (*ConfigurationDiff, error) {
+	include := func(id SchemeManagerIdentifier) bool {
+		return scheme == nil || *scheme == id
+	}
+	confs := []*Configuration{conf, newer}
+	schemes, issuers, credtypes, attrtypes, keys :=
+		diffPairs{}, diffPairs{}, diffPairs{}, diffPairs{}, diffPairs{}
+
+	for i, c := range confs {
+		for id, sm := range c.SchemeManagers {
+			if include(id) {
+				schemes.add(id.String(), i, sm)
+			}
+			if include(id) && indexedKeys {
+				sm.index.addPublicKeys(keys, i)
+			}
+		}
+		for id, iss := range c.Issuers {
+			if !include(id.SchemeManagerIdentifier()) {
+				continue
+			}
+			issuers.add(id.String(), i, iss)
+			if indexedKeys {
+				continue
+			}
+			indices, err := c.PublicKeyIndices(id)
+			if err != nil {
+				return nil, err
+			}
+			for _, counter := range indices {
+				pk, err := c.PublicKey(id, counter)
+				if err != nil {
+					return nil, err
+				}
+				if pk != nil {
+					keys.add(fmt.Sprintf("%s-%d", id.String(), counter), i, pk)
+				}
+			}
+		}
+		for id, credtype := range c.CredentialTypes {
+			if include(id.IssuerIdentifier().SchemeManagerIdentifier()) {
+				credtypes.add(id.String(), i, credtype)
+			}
+		}
+		for id, attrtype := range c.AttributeTypes {
+			if include(id.CredentialTypeIdentifier().IssuerIdentifier().SchemeManagerIdentifier()) {
+				attrtypes.add(id.String(), i, attrtype)
+			}
+		}
+	}
+
+	return &ConfigurationDiff{
+		SchemeManagers:  schemes.diff(),
+		Issuers:         issuers.diff(),
+		CredentialTypes: credtypes.diff(),
+		AttributeTypes:  attrtypes.diff(),
+		PublicKeys:      keys.diff(),
+	}, nil
+}
+
+// Empty returns whether the compared configurations are equal.
+func (diff *ConfigurationDiff) Empty() bool {
+	return len(diff.SchemeManagers) == 0 && len(diff.Issuers) == 0 && len(diff.CredentialTypes) == 0 &&
+		len(diff.AttributeTypes) == 0 && len(diff.PublicKeys) == 0
+}
+
+// String returns a human-readable representation of the differences, in which long field values
+// (such as public key components) are abbreviated.
+func (diff *ConfigurationDiff) String() string {
+	if diff.Empty() {
+		return "No differences\n"
+	}
+	var b strings.Builder
+	for _, section := range []struct {
+		name  string
+		diffs []*IdentifierDiff
+	}{
+		{"Scheme managers", diff.SchemeManagers},
+		{"Issuers", diff.Issuers},
+		{"Credential types", diff.CredentialTypes},
+		{"Attribute types", diff.AttributeTypes},
+		{"Public keys", diff.PublicKeys},
+	} {
+		if len(section.diffs) == 0 {
+			continue
+		}
+		b.WriteString(section.name + ":\n")
+		for _, d := range section.diffs {
+			fmt.Fprintf(&b, "  %-8s %s\n", d.Kind, d.ID)
+			for _, f := range d.Fields {
+				fmt.Fprintf(&b, "      %s: %s -> %s\n", f.Field, abbreviate(f.Old), abbreviate(f.New))
+			}
+		}
+	}
+	return b.String()
+}
+
+func abbreviate(s string) string {
+	const max = 60
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+// indexedFile represents a file in a scheme by its hash in the index of the scheme.
+type indexedFile struct {
+	Hash string
+}
+
+var indexedPublicKeyRegexp = regexp.MustCompile(`^([^/]+)/([^/]+)/PublicKeys/(\d+)\.xml$`)
+
+// addPublicKeys adds the public keys listed in the index to the specified pairs, using the
+// same identifiers as Diff().
+func (i SchemeManagerIndex) addPublicKeys(pairs diffPairs, index int) {
+	for filename, hash := range i {
+		matches := indexedPublicKeyRegexp.FindStringSubmatch(filename)
+		if len(matches) != 4 {
+			continue
+		}
+		counter, err := strconv.Atoi(matches[3])
+		if err != nil {
+			continue
+		}
+		id := NewIssuerIdentifier(matches[1] + "." + matches[2])
+		pairs.add(fmt.Sprintf("%s-%d", id.String(), counter), index, &indexedFile{Hash: hash.String()})
+	}
+}
+
+// diffPairs contains per identifier the old (index 0) and new (index 1) version of an item.
+type diffPairs map[string]*[2]interface{}
+
+func (pairs diffPairs) add(id string, i int, item interface{}) {
+	if pairs[id] == nil {
+		pairs[id] = &[2]interface{}{}
+	}
+	pairs[id][i] = item
+}
+
+func (pairs diffPairs) diff() []*IdentifierDiff {
+	var diffs []*IdentifierDiff
+	for id, pair := range pairs {
+		switch {
+		case pair[0] == nil:
+			diffs = append(diffs, &IdentifierDiff{ID: id, Kind: DiffKindAdded})
+		case pair[1] == nil:
+			diffs = append(diffs, &IdentifierDiff{ID: id, Kind: DiffKindRemoved})
+		default:
+			if fields := diffFields(pair[0], pair[1]); len(fields) > 0 {
+				diffs = append(diffs, &IdentifierDiff{ID: id, Kind: DiffKindModified, Fields: fields})
+			}
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].ID < diffs[j].ID })
+	return diffs
+}
+
+// diffFields compares the exported fields of the specified struct pointers by their JSON
+// representation.
+func diffFields(old, new interface{}) []*FieldDiff {
+	oldval, newval := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	typ := oldval.Type()
+	var fields []*FieldDiff
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, skip := diffSkippedFields[field.Name]; skip || field.PkgPath != "" {
+			continue
+		}
+		o, n := diffValue(oldval.Field(i)), diffValue(newval.Field(i))
+		if o != n {
+			fields = append(fields, &FieldDiff{Field: field.Name, Old: o, New: n})
+		}
+	}
+	return fields
+}
+
+func diffValue(val reflect.Value) string {
+	// Use a pointer so that MarshalJSON methods with pointer receivers (e.g. of Timestamp) are used
+	bts, err := json.Marshal(val.Addr().Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", val.Interface())
+	}
+	return string(bts)
+}
@@ -0,0 +1,291 @@
+package irma
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi"
+)
+
+// ConfigurationFS is a read-only file system containing an irma_configuration folder, from which
+// a Configuration parses its schemes. Paths are slash- or OS-separated, and relative to the root
+// of the file system (except for the OS file system, for which they are ordinary OS paths).
+// When reading schemes from a ConfigurationFS, the signatures of the schemes (index and index.sig)
+// are verified just like when reading them from disk.
+type ConfigurationFS interface {
+	// ReadFile returns the contents of the specified file.
+	ReadFile(path string) ([]byte, error)
+	// Stat returns information on the specified file or directory.
+	// If it does not exist, an error satisfying os.IsNotExist() is returned.
+	Stat(path string) (os.FileInfo, error)
+	// ReadDir returns the contents of the specified directory, sorted by name.
+	ReadDir(path string) ([]os.FileInfo, error)
+}
+
+// NewConfigurationFromFS returns a new read-only configuration whose schemes are read from the
+// specified file system, e.g. one created by NewMapFS(), NewZipFS() or NewHTTPFileSystemFS().
+// ParseFolder() should be called to parse it. As the file system cannot be written to, schemes
+// cannot be installed or updated in the returned Configuration.
+func NewConfigurationFromFS(fsys ConfigurationFS) (*Configuration, error) {
+	if fsys == nil {
+		return nil, errors.New("no file system specified")
+	}
+	conf := &Configuration{
+		Path:       ".",
+		filesystem: fsys,
+		readOnly:   true,
+	}
+	conf.clear()
+	return conf, nil
+}
+
+// files returns the file system from which this configuration reads its schemes.
+func (conf *Configuration) files() ConfigurationFS {
+	if conf.filesystem == nil {
+		return osFS{}
+	}
+	return conf.filesystem
+}
+
+// onDisk returns whether this configuration reads its schemes from the OS file system,
+// in which case schemes can be installed, updated and removed.
+func (conf *Configuration) onDisk() bool {
+	_, ok := conf.files().(osFS)
+	return ok
+}
+
+func (conf *Configuration) readFile(path string) ([]byte, error) {
+	return conf.files().ReadFile(path)
+}
+
+func (conf *Configuration) pathExists(path string) (bool, error) {
+	return fsPathExists(conf.files(), path)
+}
+
+func (conf *Configuration) readPrivateKey(path string) (*gabi.PrivateKey, error) {
+	bts, err := conf.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gabi.NewPrivateKeyFromXML(string(bts))
+}
+
+// glob returns the files matching the specified pattern, which may contain wildcards only
+// in its last path component.
+func (conf *Configuration) glob(pattern string) ([]string, error) {
+	return fsGlob(conf.files(), pattern)
+}
+
+func fsPathExists(fsys ConfigurationFS, path string) (bool, error) {
+	_, err := fsys.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func fsGlob(fsys ConfigurationFS, pattern string) ([]string, error) {
+	dir, filepattern := filepath.Split(pattern)
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := filepath.Match(filepattern, ""); err != nil {
+		return nil, err
+	}
+	infos, err := fsys.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, info := range infos {
+		if matched, _ := filepath.Match(filepattern, info.Name()); matched {
+			matches = append(matches, filepath.Join(dir, info.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// osFS is the ConfigurationFS of the OS file system.
+type osFS struct{}
+
+func (osFS) ReadFile(path string) ([]byte, error)       { return ioutil.ReadFile(path) }
+func (osFS) Stat(path string) (os.FileInfo, error)      { return os.Stat(path) }
+func (osFS) ReadDir(path string) ([]os.FileInfo, error) { return ioutil.ReadDir(path) }
+
+// MapFS is an in-memory ConfigurationFS, mapping slash-separated paths to file contents.
+// Directories are implied by the paths of the files.
+type MapFS map[string][]byte
+
+// NewMapFS returns an in-memory file system containing the specified files, whose paths
+// are slash-separated and relative to the root of the file system.
+func NewMapFS(files map[string][]byte) MapFS {
+	fsys := MapFS{}
+	for p, bts := range files {
+		fsys[cleanFSPath(p)] = bts
+	}
+	return fsys
+}
+
+// NewZipFS returns an in-memory file system containing the files in the specified zip archive
+// below the specified directory within it (use "" for the root of the archive).
+func NewZipFS(r *zip.Reader, root string) (MapFS, error) {
+	root = cleanFSPath(root)
+	fsys := MapFS{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		p := cleanFSPath(f.Name)
+		if root != "" {
+			if !strings.HasPrefix(p, root+"/") {
+				continue
+			}
+			p = p[len(root)+1:]
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		bts, err := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "failed to read "+f.Name+" from zip", 0)
+		}
+		fsys[p] = bts
+	}
+	return fsys, nil
+}
+
+func cleanFSPath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+}
+
+func (fsys MapFS) ReadFile(p string) ([]byte, error) {
+	bts, ok := fsys[cleanFSPath(p)]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: p, Err: os.ErrNotExist}
+	}
+	return bts, nil
+}
+
+func (fsys MapFS) Stat(p string) (os.FileInfo, error) {
+	p = cleanFSPath(p)
+	if bts, ok := fsys[p]; ok {
+		return &memFileInfo{name: path.Base(p), size: int64(len(bts))}, nil
+	}
+	for file := range fsys {
+		if p == "" || strings.HasPrefix(file, p+"/") {
+			return &memFileInfo{name: path.Base(p), dir: true}, nil
+		}
+	}
+	return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+}
+
+func (fsys MapFS) ReadDir(p string) ([]os.FileInfo, error) {
+	p = cleanFSPath(p)
+	prefix := p + "/"
+	if p == "" {
+		prefix = ""
+	}
+	entries := map[string]*memFileInfo{}
+	for file, bts := range fsys {
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		rest := file[len(prefix):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			entries[rest[:i]] = &memFileInfo{name: rest[:i], dir: true}
+		} else {
+			entries[rest] = &memFileInfo{name: rest, size: int64(len(bts))}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
+	}
+	return sortedFileInfos(entries), nil
+}
+
+// HTTPFileSystemFS is a ConfigurationFS backed by a http.FileSystem, which is the interface
+// implemented by most tools that embed file trees into Go binaries.
+type HTTPFileSystemFS struct {
+	fs http.FileSystem
+}
+
+// NewHTTPFileSystemFS returns a ConfigurationFS reading from the specified http.FileSystem,
+// e.g. an embedded file tree.
+func NewHTTPFileSystemFS(fs http.FileSystem) *HTTPFileSystemFS {
+	return &HTTPFileSystemFS{fs: fs}
+}
+
+func (fsys *HTTPFileSystemFS) ReadFile(p string) ([]byte, error) {
+	f, err := fsys.fs.Open("/" + cleanFSPath(p))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func (fsys *HTTPFileSystemFS) Stat(p string) (os.FileInfo, error) {
+	f, err := fsys.fs.Open("/" + cleanFSPath(p))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+func (fsys *HTTPFileSystemFS) ReadDir(p string) ([]os.FileInfo, error) {
+	f, err := fsys.fs.Open("/" + cleanFSPath(p))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi *memFileInfo) IsDir() bool        { return fi.dir }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+func sortedFileInfos(entries map[string]*memFileInfo) []os.FileInfo {
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, info := range entries {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos
+}
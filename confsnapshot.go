@@ -0,0 +1,219 @@
+package irma
+
+import (
+	"crypto/rsa"
+)
+
+// This file contains the machinery that allows a Configuration to be updated (e.g. by
+// AutoUpdateSchemes()) while it is being read by other goroutines.
+//
+// The maps of a Configuration that is in use are never modified in place. Instead, updates
+// parse or modify a fresh copy of the configuration, which is then swapped in as a whole under
+// a write lock. Readers that obtained one of the maps (under a read lock, or using the accessor
+// methods below) can therefore keep using it, and always see a consistent version of it.
+// Direct access to the exported map fields is safe only if the Configuration is not updated
+// concurrently; otherwise the accessor methods should be used.
+
+// SchemeManager returns the specified scheme manager, or nil if it is not present.
+func (conf *Configuration) SchemeManager(id SchemeManagerIdentifier) *SchemeManager {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+	return conf.SchemeManagers[id]
+}
+
+// Issuer returns the specified issuer, or nil if it is not present.
+func (conf *Configuration) Issuer(id IssuerIdentifier) *Issuer {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+	return conf.Issuers[id]
+}
+
+// CredentialType returns the specified credential type, or nil if it is not present.
+func (conf *Configuration) CredentialType(id CredentialTypeIdentifier) *CredentialType {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+	return conf.CredentialTypes[id]
+}
+
+// AttributeType returns the specified attribute type, or nil if it is not present.
+func (conf *Configuration) AttributeType(id AttributeTypeIdentifier) *AttributeType {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+	return conf.AttributeTypes[id]
+}
+
+// Snapshot returns a copy of the current state of this Configuration, which is not affected
+// by later updates to this Configuration. The scheme managers, issuers, credential and attribute
+// types in it are shared with this Configuration, and must not be modified.
+func (conf *Configuration) Snapshot() *Configuration {
+	conf.keyLock.Lock()
+	defer conf.keyLock.Unlock()
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+
+	snapshot := conf.emptyCopy()
+	for id, manager := range conf.SchemeManagers {
+		snapshot.SchemeManagers[id] = manager
+	}
+	for id, issuer := range conf.Issuers {
+		snapshot.Issuers[id] = issuer
+	}
+	for id, credtype := range conf.CredentialTypes {
+		snapshot.CredentialTypes[id] = credtype
+	}
+	for id, attrtype := range conf.AttributeTypes {
+		snapshot.AttributeTypes[id] = attrtype
+	}
+	for id, mgrerr := range conf.DisabledSchemeManagers {
+		snapshot.DisabledSchemeManagers[id] = mgrerr
+	}
+	for hash, id := range conf.reverseHashes {
+		snapshot.reverseHashes[hash] = id
+	}
+	for id, scheme := range conf.RequestorSchemes {
+		snapshot.RequestorSchemes[id] = scheme
+	}
+	for id, err := range conf.DisabledRequestorSchemes {
+		snapshot.DisabledRequestorSchemes[id] = err
+	}
+	for hostname, requestor := range conf.requestors {
+		snapshot.requestors[hostname] = requestor
+	}
+	for id, keys := range conf.kssPublicKeys {
+		snapshot.kssPublicKeys[id] = make(map[int]*rsa.PublicKey, len(keys))
+		for i, pk := range keys {
+			snapshot.kssPublicKeys[id][i] = pk
+		}
+	}
+	snapshot.publicKeys = conf.publicKeys.copy(conf.publicKeyCacheSize)
+	for id, sk := range conf.privateKeys {
+		snapshot.privateKeys[id] = sk
+	}
+	snapshot.Warnings = append([]string(nil), conf.Warnings...)
+	snapshot.initialized = conf.initialized
+	return snapshot
+}
+
+// Subscribe registers a function that is called (on the goroutine performing the update)
+// each time the contents of this Configuration are replaced, e.g. after ParseFolder() or
+// after the automatic updater has updated a scheme. The handler is called after the update has
+// completed, so it may itself update this Configuration.
+func (conf *Configuration) Subscribe(handler func()) {
+	conf.lock.Lock()
+	defer conf.lock.Unlock()
+	conf.subscribers = append(conf.subscribers, handler)
+}
+
+// AddUpdateListener registers a function that is called (on the goroutine performing the update)
+// each time the contents of this Configuration are replaced by different ones, with the
+// differences between the old and new contents. Public keys are compared by their hashes in the
+// scheme indices, so the differences in the fields of modified public keys are not reported.
+// The returned function unregisters the listener.
+func (conf *Configuration) AddUpdateListener(listener func(diff *ConfigurationDiff)) func() {
+	l := &updateListener{listener: listener}
+	conf.lock.Lock()
+	defer conf.lock.Unlock()
+	conf.updateListeners = append(conf.updateListeners, l)
+	return func() { conf.removeUpdateListener(l) }
+}
+
+func (conf *Configuration) removeUpdateListener(l *updateListener) {
+	conf.lock.Lock()
+	defer conf.lock.Unlock()
+	// Build a new slice, as swap() may be iterating over the current one
+	listeners := make([]*updateListener, 0, len(conf.updateListeners))
+	for _, other := range conf.updateListeners {
+		if other != l {
+			listeners = append(listeners, other)
+		}
+	}
+	conf.updateListeners = listeners
+}
+
+// emptyCopy returns a new, empty Configuration reading from the same location, and downloading
+// from the same scheme mirrors, as this one. If this Configuration is in use, the read lock must
+// be held.
+func (conf *Configuration) emptyCopy() *Configuration {
+	fresh := &Configuration{
+		Path:               conf.Path,
+		assets:             conf.assets,
+		filesystem:         conf.filesystem,
+		readOnly:           conf.readOnly,
+		publicKeyCacheSize: conf.publicKeyCacheSize,
+		requiredLanguages:  conf.requiredLanguages,
+	}
+	if conf.schemeMirrors != nil {
+		fresh.schemeMirrors = make(map[SchemeManagerIdentifier][]string, len(conf.schemeMirrors))
+		for id, urls := range conf.schemeMirrors {
+			fresh.schemeMirrors[id] = urls
+		}
+	}
+	fresh.clear()
+	return fresh
+}
+
+// update applies f to a copy of the current state of this Configuration, and swaps in the
+// result if f succeeds. Updates are serialized, so that concurrent updates do not undo each other.
+// The subscribers and update listeners are notified after the update lock has been released.
+func (conf *Configuration) update(f func(fresh *Configuration) error) error {
+	conf.updateLock.Lock()
+	fresh := conf.Snapshot()
+	err := f(fresh)
+	var notify func()
+	if err == nil {
+		notify = conf.swap(fresh)
+	}
+	conf.updateLock.Unlock()
+
+	if notify != nil {
+		notify()
+	}
+	return err
+}
+
+// swap atomically replaces the contents of this Configuration by those of fresh, which must not
+// be used afterwards. It must be called with the update lock held, and returns a function that
+// notifies the subscribers and update listeners, to be called after releasing the update lock.
+func (conf *Configuration) swap(fresh *Configuration) func() {
+	conf.keyLock.Lock()
+	conf.lock.Lock()
+	old := &Configuration{
+		SchemeManagers:  conf.SchemeManagers,
+		Issuers:         conf.Issuers,
+		CredentialTypes: conf.CredentialTypes,
+		AttributeTypes:  conf.AttributeTypes,
+	}
+	conf.SchemeManagers = fresh.SchemeManagers
+	conf.Issuers = fresh.Issuers
+	conf.CredentialTypes = fresh.CredentialTypes
+	conf.AttributeTypes = fresh.AttributeTypes
+	conf.DisabledSchemeManagers = fresh.DisabledSchemeManagers
+	conf.Warnings = fresh.Warnings
+	conf.kssPublicKeys = fresh.kssPublicKeys
+	conf.publicKeys = fresh.publicKeys
+	conf.privateKeys = fresh.privateKeys
+	conf.reverseHashes = fresh.reverseHashes
+	conf.RequestorSchemes = fresh.RequestorSchemes
+	conf.DisabledRequestorSchemes = fresh.DisabledRequestorSchemes
+	conf.requestors = fresh.requestors
+	conf.initialized = fresh.initialized
+	subscribers, listeners := conf.subscribers, conf.updateListeners
+	conf.lock.Unlock()
+	conf.keyLock.Unlock()
+
+	return func() {
+		for _, handler := range subscribers {
+			handler()
+		}
+		if len(listeners) == 0 {
+			return
+		}
+		diff, err := old.diff(fresh, nil, true) // never returns an error when comparing indexed keys
+		if err != nil || diff.Empty() {
+			return
+		}
+		for _, l := range listeners {
+			l.listener(diff)
+		}
+	}
+}
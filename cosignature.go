@@ -0,0 +1,289 @@
+package irma
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bwesterb/go-atum"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi/big"
+)
+
+const (
+	LDContextMultiSignatureRequest = "https://irma.app/ld/request/multisignature/v1"
+	LDContextSignatureBundle       = "https://irma.app/ld/signature/bundle/v1"
+)
+
+// A MultiSignatureRequest is a request for several signers to each sign the same message with
+// their own attributes. Each signer performs an ordinary signature session; the resulting
+// signatures are combined into a SignatureBundle. Construct new instances using
+// NewMultiSignatureRequest().
+type MultiSignatureRequest struct {
+	BaseRequest
+	Message string             `json:"message"`
+	Signers []*CoSignerRequest `json:"signers"`
+}
+
+// A CoSignerRequest contains the attributes that one of the signers of a MultiSignatureRequest
+// has to sign the message with.
+type CoSignerRequest struct {
+	Disclose AttributeConDisCon       `json:"disclose"`
+	Labels   map[int]TranslatedString `json:"labels,omitempty"`
+}
+
+// A SignatureBundle contains the signatures of all signers of a MultiSignatureRequest over the
+// same message, sorted by the time of their timestamps.
+type SignatureBundle struct {
+	LDContext  string         `json:"@context"`
+	Message    string         `json:"message"`
+	Signatures []*CoSignature `json:"signatures"`
+}
+
+// A CoSignature is the signature of one of the signers of a MultiSignatureRequest, along with
+// the index of the signer within the request.
+type CoSignature struct {
+	Signer    int            `json:"signer"`
+	Signature *SignedMessage `json:"signature"`
+}
+
+// A MultiSignatureRequestorRequest contains a multi-signature request.
+type MultiSignatureRequestorRequest struct {
+	RequestorBaseRequest
+	Request *MultiSignatureRequest `json:"request"`
+}
+
+// MultiSignatureRequestorJwt is a requestor JWT for a multi-signature session.
+type MultiSignatureRequestorJwt struct {
+	ServerJwt
+	Request *MultiSignatureRequestorRequest `json:"msrequest"`
+}
+
+// NewMultiSignatureRequest returns a request for each of the specified signers to sign the
+// message with the attributes of the corresponding entry of signers.
+func NewMultiSignatureRequest(message string, signers ...[]AttributeTypeIdentifier) *MultiSignatureRequest {
+	request := &MultiSignatureRequest{
+		BaseRequest: BaseRequest{LDContext: LDContextMultiSignatureRequest},
+		Message:     message,
+	}
+	for _, attrs := range signers {
+		dr := NewDisclosureRequest(attrs...)
+		request.Signers = append(request.Signers, &CoSignerRequest{Disclose: dr.Disclose, Labels: dr.Labels})
+	}
+	return request
+}
+
+// SignatureRequest returns the signature request for the signer with the specified index, with
+// which the signature session of that signer is started.
+func (msr *MultiSignatureRequest) SignatureRequest(signer int) (*SignatureRequest, error) {
+	if signer < 0 || signer >= len(msr.Signers) {
+		return nil, errors.Errorf("Multi-signature request has no signer %d", signer)
+	}
+	sr := NewSignatureRequest(msr.Message)
+	sr.Disclose = msr.Signers[signer].Disclose
+	if msr.Signers[signer].Labels != nil {
+		sr.Labels = msr.Signers[signer].Labels
+	}
+	sr.ProtocolVersion = msr.ProtocolVersion
+	return sr, nil
+}
+
+// Disclosure returns a disclosure request containing the attributes of all signers,
+// e.g. for checking which attributes may be used in this request.
+func (msr *MultiSignatureRequest) Disclosure() *DisclosureRequest {
+	dr := NewDisclosureRequest()
+	for _, signer := range msr.Signers {
+		dr.Disclose = append(dr.Disclose, signer.Disclose...)
+	}
+	return dr
+}
+
+func (msr *MultiSignatureRequest) Identifiers() *IrmaIdentifierSet {
+	if msr.ids == nil {
+		msr.ids = msr.Disclosure().identifiers()
+	}
+	return msr.ids
+}
+
+func (msr *MultiSignatureRequest) Base() *BaseRequest {
+	return &msr.BaseRequest
+}
+
+func (msr *MultiSignatureRequest) GetNonce(*atum.Timestamp) *big.Int {
+	return msr.BaseRequest.GetNonce(nil)
+}
+
+func (msr *MultiSignatureRequest) Action() Action { return ActionMultiSigning }
+
+func (msr *MultiSignatureRequest) Legacy() (SessionRequest, error) {
+	return nil, errors.New("Multi-signature requests have no legacy representation")
+}
+
+func (msr *MultiSignatureRequest) Validate() error {
+	if msr.LDContext != LDContextMultiSignatureRequest {
+		return errors.New("Not a multi-signature request")
+	}
+	if msr.Message == "" {
+		return errors.New("Multi-signature request had empty message")
+	}
+	if len(msr.Signers) < 2 {
+		return errors.New("Multi-signature request must have at least two signers")
+	}
+	for i, signer := range msr.Signers {
+		if signer == nil || len(signer.Disclose) == 0 {
+			return errors.Errorf("Signer %d of multi-signature request had no attributes", i)
+		}
+		for _, discon := range signer.Disclose {
+			if err := discon.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NewSignatureBundle combines the specified signatures into a SignatureBundle. The signature of
+// the i-th signer of the request must be at index i of signatures. All signatures must be made
+// over the specified message and contain a timestamp.
+func NewSignatureBundle(message string, signatures []*SignedMessage) (*SignatureBundle, error) {
+	bundle := &SignatureBundle{
+		LDContext: LDContextSignatureBundle,
+		Message:   message,
+	}
+	for i, sig := range signatures {
+		if sig == nil {
+			return nil, errors.Errorf("Missing signature of signer %d", i)
+		}
+		if sig.Message != message {
+			return nil, errors.Errorf("Signature of signer %d was not made over the shared message", i)
+		}
+		if sig.Timestamp == nil {
+			return nil, errors.Errorf("Signature of signer %d has no timestamp", i)
+		}
+		bundle.Signatures = append(bundle.Signatures, &CoSignature{Signer: i, Signature: sig})
+	}
+	sort.SliceStable(bundle.Signatures, func(i, j int) bool {
+		return bundle.Signatures[i].Signature.Timestamp.Time < bundle.Signatures[j].Signature.Timestamp.Time
+	})
+	return bundle, nil
+}
+
+func (b *SignatureBundle) Validate() error {
+	if b.LDContext != LDContextSignatureBundle {
+		return errors.New("Not a signature bundle")
+	}
+	if len(b.Signatures) == 0 {
+		return errors.New("Signature bundle contains no signatures")
+	}
+	for _, cosig := range b.Signatures {
+		if cosig == nil || cosig.Signature == nil {
+			return errors.New("Signature bundle contains empty signature")
+		}
+		if cosig.Signature.Timestamp == nil {
+			return errors.Errorf("Signature of signer %d has no timestamp", cosig.Signer)
+		}
+	}
+	return nil
+}
+
+// Verify verifies the signature bundle and returns the disclosed attributes per signer, in the
+// order of the signers in the request. Each signature is verified as in SignedMessage.Verify()
+// against the shared message and, if a request is specified, against the attributes requested
+// from its signer. Additionally all signers must be present exactly once, and the timestamps
+// of the signatures must be in the order in which they occur in the bundle.
+func (b *SignatureBundle) Verify(configuration *Configuration, request *MultiSignatureRequest) ([][][]*DisclosedAttribute, ProofStatus, error) {
+	if err := b.Validate(); err != nil {
+		return nil, ProofStatusInvalid, err
+	}
+
+	signerCount := len(b.Signatures)
+	if request != nil {
+		if request.Message != b.Message || len(request.Signers) != signerCount {
+			return nil, ProofStatusUnmatchedRequest, nil
+		}
+	}
+
+	result := make([][][]*DisclosedAttribute, signerCount)
+	seen := make([]bool, signerCount)
+	var previous int64
+	for _, cosig := range b.Signatures {
+		if cosig.Signer < 0 || cosig.Signer >= signerCount || seen[cosig.Signer] {
+			return nil, ProofStatusInvalid, nil
+		}
+		seen[cosig.Signer] = true
+
+		sig := cosig.Signature
+		if sig.Message != b.Message {
+			return nil, ProofStatusInvalid, nil
+		}
+		if sig.Timestamp == nil || sig.Timestamp.Time < previous {
+			return nil, ProofStatusInvalidTimestamp, nil
+		}
+		previous = sig.Timestamp.Time
+
+		var required AttributeConDisCon
+		if request != nil {
+			required = request.Signers[cosig.Signer].Disclose
+		}
+		attrs, status, err := sig.verify(configuration, required, b.Message)
+		if status != ProofStatusValid || err != nil {
+			return nil, status, err
+		}
+		result[cosig.Signer] = attrs
+	}
+
+	return result, ProofStatusValid, nil
+}
+
+// NewMultiSignatureRequestorJwt returns a new MultiSignatureRequestorJwt.
+func NewMultiSignatureRequestorJwt(servername string, msr *MultiSignatureRequest) *MultiSignatureRequestorJwt {
+	return &MultiSignatureRequestorJwt{
+		ServerJwt: ServerJwt{
+			ServerName: servername,
+			IssuedAt:   Timestamp(time.Now()),
+			Type:       "multisignature_request",
+		},
+		Request: &MultiSignatureRequestorRequest{
+			RequestorBaseRequest: RequestorBaseRequest{ResultJwtValidity: 120},
+			Request:              msr,
+		},
+	}
+}
+
+func (r *MultiSignatureRequestorRequest) Validate() error {
+	if r.Request == nil {
+		return errors.New("Not a MultiSignatureRequestorRequest")
+	}
+	return r.Request.Validate()
+}
+
+func (r *MultiSignatureRequestorRequest) SessionRequest() SessionRequest {
+	return r.Request
+}
+
+func (r *MultiSignatureRequestorRequest) Base() RequestorBaseRequest {
+	return r.RequestorBaseRequest
+}
+
+// SessionRequest returns an IRMA session object.
+func (claims *MultiSignatureRequestorJwt) SessionRequest() SessionRequest {
+	return claims.Request.Request
+}
+
+func (claims *MultiSignatureRequestorJwt) Sign(method jwt.SigningMethod, key interface{}) (string, error) {
+	return jwt.NewWithClaims(method, claims).SignedString(key)
+}
+
+func (claims *MultiSignatureRequestorJwt) RequestorRequest() RequestorRequest { return claims.Request }
+
+func (claims *MultiSignatureRequestorJwt) Valid() error {
+	if claims.Type != "multisignature_request" {
+		return errors.New("Multi-signature jwt has invalid subject")
+	}
+	if time.Time(claims.IssuedAt).After(time.Now()) {
+		return errors.New("Multi-signature jwt not yet valid")
+	}
+	return nil
+}
+
+func (claims *MultiSignatureRequestorJwt) Action() Action { return ActionMultiSigning }
@@ -44,7 +44,7 @@ func NewCredentialInfo(ints []*big.Int, conf *Configuration) *CredentialInfo {
 }
 
 func (ci CredentialInfo) GetCredentialType(conf *Configuration) *CredentialType {
-	return conf.CredentialTypes[NewCredentialTypeIdentifier(fmt.Sprintf("%s.%s.%s", ci.SchemeManagerID, ci.IssuerID, ci.ID))]
+	return conf.CredentialType(NewCredentialTypeIdentifier(fmt.Sprintf("%s.%s.%s", ci.SchemeManagerID, ci.IssuerID, ci.ID)))
 }
 
 // Returns true if credential is expired at moment of calling this function
@@ -4,9 +4,9 @@ import (
 	"encoding/xml"
 	"fmt"
 	"path/filepath"
+	"sort"
 
 	"github.com/go-errors/errors"
-	"github.com/privacybydesign/irmago/internal/fs"
 )
 
 // This file contains data types for scheme managers, issuers, credential types
@@ -25,13 +25,15 @@ type SchemeManager struct {
 	KeyshareWebsite   string
 	KeyshareAttribute string
 	TimestampServer   string
-	XMLVersion        int      `xml:"version,attr"`
-	XMLName           xml.Name `xml:"SchemeManager"`
+	// Mirrors are URLs from which the scheme can be downloaded if its URL is unavailable
+	Mirrors    []string `xml:"Mirrors>Mirror,omitempty"`
+	XMLVersion int      `xml:"version,attr"`
+	XMLName    xml.Name `xml:"SchemeManager"`
 
 	Status SchemeManagerStatus `xml:"-"`
 	Valid  bool                `xml:"-"` // true iff Status == SchemeManagerStatusValid
 
-	Timestamp Timestamp
+	Timestamp Timestamp `xml:"-"`
 
 	index SchemeManagerIndex
 }
@@ -68,16 +70,28 @@ type CredentialType struct {
 	XMLName         xml.Name         `xml:"IssueSpecification"`
 	IssueURL        TranslatedString `xml:"IssueURL"`
 
+	// Display metadata, all optional: colours are of the form #RRGGBB, and the category is a
+	// free-form identifier (e.g. "personal", "education") by which apps may group credentials.
+	ForegroundColor string `xml:",omitempty" json:",omitempty"`
+	BackgroundColor string `xml:",omitempty" json:",omitempty"`
+	Category        string `xml:",omitempty" json:",omitempty"`
+
 	Valid bool `xml:"-"`
 }
 
 // AttributeType is a description of an attribute within a credential type.
 type AttributeType struct {
 	ID          string `xml:"id,attr"`
-	Optional    string `xml:"optional,attr"  json:",omitempty"`
+	Optional    string `xml:"optional,attr,omitempty"  json:",omitempty"`
+	Hidden      string `xml:"hidden,attr,omitempty" json:",omitempty"` // not shown to the user
+	Secret      string `xml:"secret,attr,omitempty" json:",omitempty"` // shown only on request of the user
 	Name        TranslatedString
 	Description TranslatedString
 
+	// Values optionally contains translations of (enum-like) values of this attribute, e.g.
+	// <Values><Value value="M"><en>Male</en><nl>Man</nl></Value></Values>
+	Values AttributeValueTranslations `xml:"Values,omitempty" json:",omitempty"`
+
 	Index        int  `xml:"-"`
 	DisplayIndex *int `xml:"displayIndex,attr" json:",omitempty"`
 
@@ -95,6 +109,28 @@ func (ad AttributeType) IsOptional() bool {
 	return ad.Optional == "true"
 }
 
+func (ad AttributeType) IsHidden() bool {
+	return ad.Hidden == "true"
+}
+
+func (ad AttributeType) IsSecret() bool {
+	return ad.Secret == "true"
+}
+
+// Translate returns a TranslatedString containing the specified value, along with its
+// translations if the attribute type declares any for this value; or nil when value is nil.
+// It may be called on a nil *AttributeType, in which case no translations are added.
+func (ad *AttributeType) Translate(value *string) TranslatedString {
+	ts := NewTranslatedString(value)
+	if ts == nil || ad == nil {
+		return ts
+	}
+	for lang, translation := range ad.Values[*value] {
+		ts[lang] = translation
+	}
+	return ts
+}
+
 // ContainsAttribute tests whether the specified attribute is contained in this
 // credentialtype.
 func (ct *CredentialType) ContainsAttribute(ai AttributeTypeIdentifier) bool {
@@ -171,6 +207,59 @@ func (ts *TranslatedString) UnmarshalXML(d *xml.Decoder, start xml.StartElement)
 	return nil
 }
 
+// AttributeValueTranslations maps attribute values to their translations.
+type AttributeValueTranslations map[string]TranslatedString
+
+type xmlAttributeValue struct {
+	Value        string           `xml:"value,attr"`
+	Translations []xmlTranslation `xml:",any"`
+}
+
+type xmlAttributeValues struct {
+	Values []xmlAttributeValue `xml:"Value"`
+}
+
+// MarshalXML implements xml.Marshaler.
+func (avt *AttributeValueTranslations) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	values := make([]string, 0, len(*avt))
+	for value := range *avt {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	temp := &xmlAttributeValues{}
+	for _, value := range values {
+		xmlvalue := xmlAttributeValue{Value: value}
+		for lang, text := range (*avt)[value] {
+			xmlvalue.Translations = append(xmlvalue.Translations,
+				xmlTranslation{XMLName: xml.Name{Local: lang}, Text: text},
+			)
+		}
+		temp.Values = append(temp.Values, xmlvalue)
+	}
+	return e.EncodeElement(temp, start)
+}
+
+// UnmarshalXML unmarshals an XML tag containing translations of attribute values, for example:
+// <Values><Value value="M"><en>Male</en><nl>Man</nl></Value></Values>
+// into an AttributeValueTranslations: { "M": { "en": "Male", "nl": "Man" } }
+func (avt *AttributeValueTranslations) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if map[string]TranslatedString(*avt) == nil {
+		*avt = AttributeValueTranslations(make(map[string]TranslatedString))
+	}
+	temp := &xmlAttributeValues{}
+	if err := d.DecodeElement(temp, &start); err != nil {
+		return err
+	}
+	for _, value := range temp.Values {
+		ts := TranslatedString{}
+		for _, translation := range value.Translations {
+			ts[translation.XMLName.Local] = translation.Text
+		}
+		(*avt)[value.Value] = ts
+	}
+	return nil
+}
+
 // Identifier returns the identifier of the specified credential type.
 func (ct *CredentialType) Identifier() CredentialTypeIdentifier {
 	return NewCredentialTypeIdentifier(ct.SchemeManagerID + "." + ct.IssuerID + "." + ct.ID)
@@ -187,7 +276,16 @@ func (ct *CredentialType) SchemeManagerIdentifier() SchemeManagerIdentifier {
 
 func (ct *CredentialType) Logo(conf *Configuration) string {
 	path := filepath.Join(conf.Path, ct.SchemeManagerID, ct.IssuerID, "Issues", ct.ID, "logo.png")
-	exists, err := fs.PathExists(path)
+	exists, err := conf.pathExists(path)
+	if err != nil || !exists {
+		return ""
+	}
+	return path
+}
+
+func (id *Issuer) Logo(conf *Configuration) string {
+	path := filepath.Join(conf.Path, id.SchemeManagerID, id.ID, "logo.png")
+	exists, err := conf.pathExists(path)
 	if err != nil || !exists {
 		return ""
 	}
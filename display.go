@@ -0,0 +1,124 @@
+package irma
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// CredentialView is a render-ready view of a credential, combining its attributes with the
+// display metadata of its credential type, so that apps and web frontends can all show
+// credentials in the same way.
+type CredentialView struct {
+	ID              CredentialTypeIdentifier
+	Name            TranslatedString
+	ShortName       TranslatedString
+	IssuerName      TranslatedString
+	Category        string `json:",omitempty"`
+	ForegroundColor string `json:",omitempty"`
+	BackgroundColor string `json:",omitempty"`
+	Logo            string `json:",omitempty"` // Path to the logo of the credential type, if any
+	IssuerLogo      string `json:",omitempty"` // Path to the logo of the issuer, if any
+	SignedOn        Timestamp
+	Expires         Timestamp
+	Hash            string
+	Attributes      []*AttributeView // In display order, excluding hidden attributes
+}
+
+// AttributeView is a render-ready view of an attribute within a CredentialView.
+type AttributeView struct {
+	ID     AttributeTypeIdentifier
+	Name   TranslatedString
+	Value  TranslatedString // nil if the attribute is optional and absent
+	Secret bool             `json:",omitempty"` // If set, show only on request of the user
+}
+
+var colorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// View returns a render-ready view of the attribute list, or nil if its credential type is unknown.
+func (al *AttributeList) View(conf *Configuration) *CredentialView {
+	credtype := al.CredentialType()
+	if credtype == nil {
+		return nil
+	}
+
+	view := &CredentialView{
+		ID:              credtype.Identifier(),
+		Name:            credtype.Name,
+		ShortName:       credtype.ShortName,
+		Category:        credtype.Category,
+		ForegroundColor: credtype.ForegroundColor,
+		BackgroundColor: credtype.BackgroundColor,
+		Logo:            credtype.Logo(conf),
+		SignedOn:        Timestamp(al.SigningDate()),
+		Expires:         Timestamp(al.Expiry()),
+		Hash:            al.Hash(),
+	}
+	if issuer := conf.Issuer(credtype.IssuerIdentifier()); issuer != nil {
+		view.IssuerName = issuer.Name
+		view.IssuerLogo = issuer.Logo(conf)
+	}
+
+	values := al.Strings()
+	for _, attrtype := range credtype.DisplayOrder() {
+		if attrtype.IsHidden() || attrtype.Index >= len(values) {
+			continue
+		}
+		view.Attributes = append(view.Attributes, &AttributeView{
+			ID:     attrtype.GetAttributeTypeIdentifier(),
+			Name:   attrtype.Name,
+			Value:  values[attrtype.Index],
+			Secret: attrtype.IsSecret(),
+		})
+	}
+	return view
+}
+
+// DisplayOrder returns the attribute types of the credential type, ordered by their
+// displayIndex if present, and otherwise by their index.
+func (ct *CredentialType) DisplayOrder() []*AttributeType {
+	attrtypes := make([]*AttributeType, len(ct.AttributeTypes))
+	copy(attrtypes, ct.AttributeTypes)
+	displayIndex := func(attrtype *AttributeType) int {
+		if attrtype.DisplayIndex != nil {
+			return *attrtype.DisplayIndex
+		}
+		return attrtype.Index
+	}
+	sort.SliceStable(attrtypes, func(i, j int) bool {
+		return displayIndex(attrtypes[i]) < displayIndex(attrtypes[j])
+	})
+	return attrtypes
+}
+
+// IssuerLogo returns the logo of the specified issuer, or nil if the issuer is unknown or has
+// no logo. The logo is verified against the index of the scheme.
+func (conf *Configuration) IssuerLogo(id IssuerIdentifier) ([]byte, error) {
+	if conf.Issuer(id) == nil {
+		return nil, nil
+	}
+	return conf.readLogo(id.SchemeManagerIdentifier(), id.Name(), "logo.png")
+}
+
+// CredentialTypeLogo returns the logo of the specified credential type, or nil if the credential
+// type is unknown or has no logo. The logo is verified against the index of the scheme.
+func (conf *Configuration) CredentialTypeLogo(id CredentialTypeIdentifier) ([]byte, error) {
+	if conf.CredentialType(id) == nil {
+		return nil, nil
+	}
+	issuer := id.IssuerIdentifier()
+	return conf.readLogo(issuer.SchemeManagerIdentifier(), issuer.Name(), "Issues", id.Name(), "logo.png")
+}
+
+func (conf *Configuration) readLogo(scheme SchemeManagerIdentifier, elems ...string) ([]byte, error) {
+	manager := conf.SchemeManager(scheme)
+	if manager == nil {
+		return nil, nil
+	}
+	path := filepath.Join(append([]string{scheme.Name()}, elems...)...)
+	if exists, err := conf.pathExists(filepath.Join(conf.Path, path)); err != nil || !exists {
+		return nil, err
+	}
+	bts, _, err := conf.ReadAuthenticatedFile(manager, path)
+	return bts, err
+}
@@ -0,0 +1,242 @@
+package irma
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "crypto/sha256" // register hash functions usable as HashAlgorithm
+	_ "crypto/sha512"
+
+	"github.com/go-errors/errors"
+)
+
+const (
+	LDContextSignedFile = "https://irma.app/ld/signature/file/v1"
+
+	// fileSignatureMessagePrefix is the first line of the message that is signed in a file signature
+	// session, distinguishing it from ordinary messages.
+	fileSignatureMessagePrefix = "IRMA file signature v1"
+)
+
+// HashAlgorithm identifies the hash function with which the digest of a signed file is computed.
+type HashAlgorithm string
+
+const (
+	HashAlgorithmSHA256 = HashAlgorithm("sha256")
+	HashAlgorithmSHA384 = HashAlgorithm("sha384")
+	HashAlgorithmSHA512 = HashAlgorithm("sha512")
+
+	DefaultHashAlgorithm = HashAlgorithmSHA256
+)
+
+var hashAlgorithms = map[HashAlgorithm]crypto.Hash{
+	HashAlgorithmSHA256: crypto.SHA256,
+	HashAlgorithmSHA384: crypto.SHA384,
+	HashAlgorithmSHA512: crypto.SHA512,
+}
+
+// FileMetadata describes a signed document: its name, size, media type, and its digest
+// computed using the declared hash algorithm. Only the digest and the algorithm are required
+// to verify a file signature; the other fields are informational but also signed.
+type FileMetadata struct {
+	Name      string        `json:"name,omitempty"`
+	MediaType string        `json:"mediaType,omitempty"`
+	Size      int64         `json:"size"`
+	Algorithm HashAlgorithm `json:"algorithm"`
+	Digest    HexBytes      `json:"digest"`
+}
+
+// SignedFile is a detached signature over a document: a container holding the attribute-based
+// signature (including its timestamp) over the digest of the document, along with the document
+// metadata. The document itself is not included.
+type SignedFile struct {
+	LDContext string         `json:"@context"`
+	Version   int            `json:"version"`
+	Document  *FileMetadata  `json:"document"`
+	Signature *SignedMessage `json:"signature"`
+}
+
+// HexBytes is a byte slice that (un)marshals to and from a hexadecimal string in JSON.
+type HexBytes []byte
+
+func (h HexBytes) String() string {
+	return hex.EncodeToString(h)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (h HexBytes) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (h *HexBytes) UnmarshalText(text []byte) error {
+	bts, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*h = bts
+	return nil
+}
+
+// Hash returns the hash function corresponding to this algorithm.
+func (alg HashAlgorithm) Hash() (crypto.Hash, error) {
+	h, ok := hashAlgorithms[alg]
+	if !ok {
+		return 0, errors.Errorf("Unsupported hash algorithm %s", alg)
+	}
+	if !h.Available() {
+		return 0, errors.Errorf("Hash algorithm %s not available", alg)
+	}
+	return h, nil
+}
+
+// NewFileMetadata reads r until EOF and computes its digest using the specified algorithm.
+func NewFileMetadata(r io.Reader, name string, alg HashAlgorithm) (*FileMetadata, error) {
+	if alg == "" {
+		alg = DefaultHashAlgorithm
+	}
+	h, err := alg.Hash()
+	if err != nil {
+		return nil, err
+	}
+	hasher := h.New()
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMetadata{
+		Name:      name,
+		Size:      size,
+		Algorithm: alg,
+		Digest:    hasher.Sum(nil),
+	}, nil
+}
+
+// NewFileMetadataFromPath computes the metadata of the file at the specified path.
+func NewFileMetadataFromPath(path string, alg HashAlgorithm) (*FileMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewFileMetadata(f, filepath.Base(path), alg)
+}
+
+// Message returns the message that is signed in a file signature session over this document.
+func (fm *FileMetadata) Message() string {
+	lines := []string{
+		fileSignatureMessagePrefix,
+		string(fm.Algorithm) + ":" + fm.Digest.String(),
+		"size:" + strconv.FormatInt(fm.Size, 10),
+	}
+	if fm.Name != "" {
+		lines = append(lines, "name:"+fm.Name)
+	}
+	if fm.MediaType != "" {
+		lines = append(lines, "type:"+fm.MediaType)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Matches checks that the contents of r has the digest specified in this instance.
+func (fm *FileMetadata) Matches(r io.Reader) (bool, error) {
+	other, err := NewFileMetadata(r, fm.Name, fm.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	return other.Size == fm.Size && bytes.Equal(other.Digest, fm.Digest), nil
+}
+
+func (fm *FileMetadata) Validate() error {
+	h, err := fm.Algorithm.Hash()
+	if err != nil {
+		return err
+	}
+	if len(fm.Digest) != h.Size() {
+		return errors.Errorf("Digest has wrong length for algorithm %s", fm.Algorithm)
+	}
+	if strings.ContainsRune(fm.Name, '\n') || strings.ContainsRune(fm.MediaType, '\n') {
+		return errors.New("Document name and media type may not contain newlines")
+	}
+	return nil
+}
+
+// NewFileSignatureRequest returns a signature request for signing the specified document.
+func NewFileSignatureRequest(document *FileMetadata, attrs ...AttributeTypeIdentifier) *SignatureRequest {
+	return NewSignatureRequest(document.Message(), attrs...)
+}
+
+// NewSignedFile packages the signature over the specified document into a SignedFile container,
+// after checking that it was made over the document's digest.
+func NewSignedFile(document *FileMetadata, signature *SignedMessage) (*SignedFile, error) {
+	if err := document.Validate(); err != nil {
+		return nil, err
+	}
+	if signature == nil {
+		return nil, errors.New("No signature specified")
+	}
+	if signature.Message != document.Message() {
+		return nil, errors.New("Signature was not made over the specified document")
+	}
+	return &SignedFile{
+		LDContext: LDContextSignedFile,
+		Version:   1,
+		Document:  document,
+		Signature: signature,
+	}, nil
+}
+
+func (sf *SignedFile) Validate() error {
+	if sf.LDContext != LDContextSignedFile {
+		return errors.New("Not a file signature")
+	}
+	if sf.Version != 1 {
+		return errors.Errorf("Unsupported file signature version %d", sf.Version)
+	}
+	if sf.Document == nil || sf.Signature == nil {
+		return errors.New("File signature misses document or signature")
+	}
+	return sf.Document.Validate()
+}
+
+// Verify verifies the file signature against the specified document contents and, if present,
+// the signature request. First the digest of the document is checked against the container;
+// after that the attribute-based signature is verified as in SignedMessage.Verify().
+func (sf *SignedFile) Verify(configuration *Configuration, document io.Reader, request *SignatureRequest) ([][]*DisclosedAttribute, ProofStatus, error) {
+	if err := sf.Validate(); err != nil {
+		return nil, ProofStatusInvalid, err
+	}
+	if sf.Signature.Message != sf.Document.Message() {
+		return nil, ProofStatusInvalid, nil
+	}
+	if request != nil && request.Message != sf.Signature.Message {
+		return nil, ProofStatusUnmatchedRequest, nil
+	}
+	if document == nil {
+		return nil, ProofStatusInvalid, errors.New("No document specified to verify file signature against")
+	}
+	matches, err := sf.Document.Matches(document)
+	if err != nil {
+		return nil, ProofStatusInvalid, err
+	}
+	if !matches {
+		return nil, ProofStatusInvalidDigest, nil
+	}
+	return sf.Signature.Verify(configuration, request)
+}
+
+// VerifyPath verifies the file signature against the file at the specified path.
+func (sf *SignedFile) VerifyPath(configuration *Configuration, path string, request *SignatureRequest) ([][]*DisclosedAttribute, ProofStatus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ProofStatusInvalid, err
+	}
+	defer f.Close()
+	return sf.Verify(configuration, f, request)
+}
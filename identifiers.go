@@ -12,6 +12,11 @@ type SchemeManagerIdentifier struct {
 	metaObjectIdentifier
 }
 
+// RequestorSchemeIdentifier identifies a requestor scheme. Equal to its ID. For example "pbdf-requestors".
+type RequestorSchemeIdentifier struct {
+	metaObjectIdentifier
+}
+
 // IssuerIdentifier identifies an issuer. For example "irma-demo.RU".
 type IssuerIdentifier struct {
 	metaObjectIdentifier
@@ -96,6 +101,11 @@ func NewSchemeManagerIdentifier(id string) SchemeManagerIdentifier {
 	return SchemeManagerIdentifier{metaObjectIdentifier(id)}
 }
 
+// NewRequestorSchemeIdentifier converts the specified identifier to a RequestorSchemeIdentifier.
+func NewRequestorSchemeIdentifier(id string) RequestorSchemeIdentifier {
+	return RequestorSchemeIdentifier{metaObjectIdentifier(id)}
+}
+
 // NewIssuerIdentifier converts the specified identifier to a IssuerIdentifier.
 func NewIssuerIdentifier(id string) IssuerIdentifier {
 	return IssuerIdentifier{metaObjectIdentifier(id)}
@@ -151,6 +161,17 @@ func (id *SchemeManagerIdentifier) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// MarshalText implements encoding.TextMarshaler.
+func (id RequestorSchemeIdentifier) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *RequestorSchemeIdentifier) UnmarshalText(text []byte) error {
+	*id = NewRequestorSchemeIdentifier(string(text))
+	return nil
+}
+
 // MarshalText implements encoding.TextMarshaler.
 func (id IssuerIdentifier) MarshalText() ([]byte, error) {
 	return []byte(id.String()), nil
@@ -204,7 +225,7 @@ func (set *IrmaIdentifierSet) join(other *IrmaIdentifierSet) {
 
 func (set *IrmaIdentifierSet) Distributed(conf *Configuration) bool {
 	for id := range set.SchemeManagers {
-		if conf.SchemeManagers[id].Distributed() {
+		if conf.SchemeManager(id).Distributed() {
 			return true
 		}
 	}
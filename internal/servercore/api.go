@@ -28,6 +28,8 @@ type Server struct {
 	sessions      sessionStore
 	scheduler     *gocron.Scheduler
 	stopScheduler chan bool
+
+	removeUpdateListener func()
 }
 
 func New(conf *server.Configuration) (*Server, error) {
@@ -49,6 +51,9 @@ func New(conf *server.Configuration) (*Server, error) {
 }
 
 func (s *Server) Stop() {
+	if s.removeUpdateListener != nil {
+		s.removeUpdateListener()
+	}
 	s.stopScheduler <- true
 	s.sessions.stop()
 }
@@ -88,22 +93,13 @@ func (s *Server) verifyConfiguration(configuration *server.Configuration) error
 		}
 	}
 
-	if len(s.conf.IrmaConfiguration.SchemeManagers) == 0 {
+	if len(s.conf.IrmaConfiguration.Snapshot().SchemeManagers) == 0 {
 		s.conf.Logger.Infof("No schemes found in %s, downloading default (irma-demo and pbdf)", s.conf.SchemesPath)
 		if err := s.conf.IrmaConfiguration.DownloadDefaultSchemes(); err != nil {
 			return server.LogError(err)
 		}
 	}
 
-	if !s.conf.DisableSchemesUpdate {
-		if s.conf.SchemesUpdateInterval == 0 {
-			s.conf.SchemesUpdateInterval = 60
-		}
-		s.conf.IrmaConfiguration.AutoUpdateSchemes(uint(s.conf.SchemesUpdateInterval))
-	} else {
-		s.conf.SchemesUpdateInterval = 0
-	}
-
 	if s.conf.IssuerPrivateKeys == nil {
 		s.conf.IssuerPrivateKeys = make(map[irma.IssuerIdentifier]*gabi.PrivateKey)
 	}
@@ -119,7 +115,7 @@ func (s *Server) verifyConfiguration(configuration *server.Configuration) error
 				continue
 			}
 			issid := irma.NewIssuerIdentifier(strings.TrimSuffix(filename, filepath.Ext(filename))) // strip .xml
-			if _, ok := s.conf.IrmaConfiguration.Issuers[issid]; !ok {
+			if s.conf.IrmaConfiguration.Issuer(issid) == nil {
 				return server.LogError(errors.Errorf("Private key %s belongs to an unknown issuer", filename))
 			}
 			sk, err := gabi.NewPrivateKeyFromFile(filepath.Join(s.conf.IssuerPrivateKeysPath, filename))
@@ -129,17 +125,19 @@ func (s *Server) verifyConfiguration(configuration *server.Configuration) error
 			s.conf.IssuerPrivateKeys[issid] = sk
 		}
 	}
-	for issid, sk := range s.conf.IssuerPrivateKeys {
-		pk, err := s.conf.IrmaConfiguration.PublicKey(issid, int(sk.Counter))
-		if err != nil {
-			return server.LogError(err)
-		}
-		if pk == nil {
-			return server.LogError(errors.Errorf("Missing public key belonging to private key %s-%d", issid.String(), sk.Counter))
-		}
-		if new(big.Int).Mul(sk.P, sk.Q).Cmp(pk.N) != 0 {
-			return server.LogError(errors.Errorf("Private key %s-%d does not belong to corresponding public key", issid.String(), sk.Counter))
+	if err := s.verifyPrivateKeys(); err != nil {
+		return server.LogError(err)
+	}
+	s.checkKeyExpiries()
+
+	s.removeUpdateListener = s.conf.IrmaConfiguration.AddUpdateListener(s.configurationUpdated)
+	if !s.conf.DisableSchemesUpdate {
+		if s.conf.SchemesUpdateInterval == 0 {
+			s.conf.SchemesUpdateInterval = 60
 		}
+		s.conf.IrmaConfiguration.AutoUpdateSchemes(uint(s.conf.SchemesUpdateInterval))
+	} else {
+		s.conf.SchemesUpdateInterval = 0
 	}
 
 	if s.conf.URL != "" {
@@ -174,6 +172,89 @@ func (s *Server) verifyConfiguration(configuration *server.Configuration) error
 	return nil
 }
 
+// verifyPrivateKeys checks that the issuer private keys with which this server issues belong to
+// known issuers, and that their public keys are present in the IRMA configuration.
+func (s *Server) verifyPrivateKeys() error {
+	for issid, sk := range s.conf.IssuerPrivateKeys {
+		if s.conf.IrmaConfiguration.Issuer(issid) == nil {
+			return errors.Errorf("Private key %s-%d belongs to an unknown issuer", issid.String(), sk.Counter)
+		}
+		pk, err := s.conf.IrmaConfiguration.PublicKey(issid, int(sk.Counter))
+		if err != nil {
+			return err
+		}
+		if pk == nil {
+			return errors.Errorf("Missing public key belonging to private key %s-%d", issid.String(), sk.Counter)
+		}
+		if new(big.Int).Mul(sk.P, sk.Q).Cmp(pk.N) != 0 {
+			return errors.Errorf("Private key %s-%d does not belong to corresponding public key", issid.String(), sk.Counter)
+		}
+	}
+	return nil
+}
+
+// checkKeyExpiries warns about each issuer private key whose public key is expired or expires soon.
+func (s *Server) checkKeyExpiries() {
+	for issid := range s.conf.IrmaConfiguration.Snapshot().Issuers {
+		sk, err := s.conf.PrivateKey(issid)
+		if err != nil || sk == nil {
+			continue
+		}
+		pk, err := s.conf.IrmaConfiguration.PublicKey(issid, int(sk.Counter))
+		if err != nil || pk == nil {
+			continue
+		}
+		s.checkKeyExpiry(issid, pk)
+	}
+}
+
+// configurationUpdated is called when the IRMA configuration has been updated, e.g. by the
+// automatic scheme updater. It logs the changes, and checks that the issuer private keys of this
+// server are still valid.
+func (s *Server) configurationUpdated(diff *irma.ConfigurationDiff) {
+	s.conf.Logger.WithFields(logrus.Fields{
+		"schemes":         len(diff.SchemeManagers),
+		"issuers":         len(diff.Issuers),
+		"credentialTypes": len(diff.CredentialTypes),
+		"attributeTypes":  len(diff.AttributeTypes),
+		"publicKeys":      len(diff.PublicKeys),
+	}).Info("IRMA configuration updated")
+	s.conf.Logger.Debug("IRMA configuration changes:\n", diff.String())
+
+	for _, d := range diff.CredentialTypes {
+		if d.Kind == irma.DiffKindRemoved {
+			s.conf.Logger.WithField("credentialType", d.ID).Warn("Credential type was removed from IRMA configuration: sessions involving it will fail")
+		}
+	}
+	if err := s.verifyPrivateKeys(); err != nil {
+		_ = server.LogError(errors.WrapPrefix(err, "Issuer private keys invalid after IRMA configuration update", 0))
+	}
+	s.checkKeyExpiries()
+}
+
+// checkKeyExpiry warns if the specified public key, corresponding to one of the issuer private
+// keys with which this server issues, is expired or expires soon.
+func (s *Server) checkKeyExpiry(issid irma.IssuerIdentifier, pk *gabi.PublicKey) {
+	now := time.Now()
+	if !irma.PublicKeyExpired(pk, now) && !irma.PublicKeyExpiresSoon(pk, now) {
+		return
+	}
+	logger := s.conf.Logger.WithFields(logrus.Fields{
+		"issuer":  issid.String(),
+		"counter": pk.Counter,
+		"expiry":  time.Unix(pk.ExpiryDate, 0).String(),
+	})
+	newest, err := s.conf.IrmaConfiguration.NewestValidPublicKey(issid, now.Add(irma.PublicKeyExpiryWarningPeriod))
+	if err == nil && newest != nil && newest.Counter > pk.Counter {
+		logger = logger.WithField("newerCounter", newest.Counter)
+	}
+	if irma.PublicKeyExpired(pk, now) {
+		logger.Warn("Public key of issuer private key has expired: issuance of credentials of this issuer will fail")
+	} else {
+		logger.Warn("Public key of issuer private key expires soon: issuance of credentials of this issuer will then fail")
+	}
+}
+
 func (s *Server) validateRequest(request irma.SessionRequest) error {
 	if _, err := s.conf.IrmaConfiguration.Download(request); err != nil {
 		return err
@@ -189,6 +270,9 @@ func (s *Server) StartSession(req interface{}) (*irma.Qr, string, error) {
 
 	request := rrequest.SessionRequest()
 	action := request.Action()
+	if action == irma.ActionMultiSigning {
+		return nil, "", errors.New("Multi-signature sessions must be started with StartMultiSignSession()")
+	}
 
 	if err := s.validateRequest(request); err != nil {
 		return nil, "", err
@@ -344,6 +428,10 @@ func (s *Server) handleProtocolMessage(
 		if session.status != session.prevStatus {
 			session.prevStatus = session.status
 			result = session.result
+			if session.parent != nil {
+				// Only the multi-signature session is of interest to the requestor
+				result = session.updatedParentResult()
+			}
 		}
 	}()
 
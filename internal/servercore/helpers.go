@@ -30,6 +30,12 @@ func (session *session) setStatus(status server.Status) {
 	session.status = status
 	session.result.Status = status
 	session.sessions.update(session)
+	if session.parent != nil {
+		session.parent.childUpdated(session.signer, status, session.result)
+	}
+	if len(session.children) > 0 && status.Finished() {
+		go session.cancelChildren()
+	}
 }
 
 func (session *session) onUpdate() {
@@ -43,8 +49,8 @@ func (session *session) onUpdate() {
 
 func (session *session) fail(err server.Error, message string) *irma.RemoteError {
 	rerr := server.RemoteError(err, message)
-	session.setStatus(server.StatusCancelled)
 	session.result = &server.SessionResult{Err: rerr, Token: session.token, Status: server.StatusCancelled, Type: session.action}
+	session.setStatus(server.StatusCancelled)
 	return rerr
 }
 
@@ -92,6 +98,9 @@ func (s *Server) validateIssuanceRequest(request *irma.IssuanceRequest) error {
 		if pubkey == nil {
 			return errors.Errorf("missing public key of issuer %s", iss.String())
 		}
+		if irma.PublicKeyExpired(pubkey, time.Now()) {
+			return errors.Errorf("public key %d of issuer %s has expired", privatekey.Counter, iss.String())
+		}
 		cred.KeyCounter = int(privatekey.Counter)
 
 		// Check that the credential is consistent with irma_configuration
@@ -107,6 +116,10 @@ func (s *Server) validateIssuanceRequest(request *irma.IssuanceRequest) error {
 		if cred.Validity.Before(irma.Timestamp(time.Now())) {
 			return errors.New("cannot issue expired credentials")
 		}
+		if cred.Validity.After(irma.Timestamp(time.Unix(pubkey.ExpiryDate, 0))) {
+			s.conf.Logger.WithFields(logrus.Fields{"issuer": iss.String(), "counter": privatekey.Counter}).
+				Warn("Credential expires after the public key with which it is issued: it cannot be used after the key expires")
+		}
 	}
 
 	return nil
@@ -0,0 +1,142 @@
+package servercore
+
+import (
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/server"
+	"github.com/sirupsen/logrus"
+)
+
+// This file contains the multi-signature sessions. Such a session consists of a parent session,
+// which is not accessible to clients and whose token is returned to the requestor, and an
+// ordinary signature session for each signer. Status updates of the signature sessions are
+// propagated to the parent session, which upon completion of all signature sessions combines
+// the signatures into a signature bundle.
+
+// StartMultiSignSession starts a multi-signature session, returning a session pointer for each of
+// the signers (in order) and the token of the multi-signature session, with which its status and
+// result can be retrieved.
+func (s *Server) StartMultiSignSession(req interface{}) ([]*irma.Qr, string, error) {
+	rrequest, err := server.ParseSessionRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+	request, ok := rrequest.SessionRequest().(*irma.MultiSignatureRequest)
+	if !ok {
+		return nil, "", errors.New("Not a multi-signature request")
+	}
+	if err := s.validateRequest(request); err != nil {
+		return nil, "", err
+	}
+
+	parent := s.newSession(irma.ActionMultiSigning, rrequest)
+	parent.Lock()
+	defer parent.Unlock()
+
+	parent.cosigned = make([]*irma.SignedMessage, len(request.Signers))
+	parent.result.CoSigners = make([]*server.SessionResult, len(request.Signers))
+	qrs := make([]*irma.Qr, 0, len(request.Signers))
+	for i := range request.Signers {
+		sr, err := request.SignatureRequest(i)
+		if err != nil {
+			return nil, "", err
+		}
+		child := s.newSession(irma.ActionSigning, &irma.SignatureRequestorRequest{
+			RequestorBaseRequest: rrequest.Base(),
+			Request:              sr,
+		})
+		// No locking needed: the client token of the child is not yet known to anyone
+		child.parent = parent
+		child.signer = i
+
+		parent.children = append(parent.children, child)
+		parent.result.CoSigners[i] = child.result
+		qrs = append(qrs, &irma.Qr{
+			Type: irma.ActionSigning,
+			URL:  s.conf.URL + "session/" + child.clientToken,
+		})
+	}
+
+	s.conf.Logger.WithFields(logrus.Fields{"action": irma.ActionMultiSigning, "session": parent.token, "signers": len(qrs)}).
+		Infof("Session started")
+	if s.conf.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		s.conf.Logger.WithFields(logrus.Fields{"session": parent.token}).Info("Session request: ", server.ToJson(rrequest))
+	}
+	return qrs, parent.token, nil
+}
+
+// childUpdated processes a status update of the signature session of the specified signer.
+// Must be called with the lock of the child session held, but not that of the parent.
+func (session *session) childUpdated(signer int, status server.Status, result *server.SessionResult) {
+	session.Lock()
+	defer session.Unlock()
+
+	if session.status.Finished() {
+		return
+	}
+	session.markAlive()
+	session.result.CoSigners[signer] = result
+
+	switch status {
+	case server.StatusConnected:
+		if session.status == server.StatusInitialized {
+			session.setStatus(server.StatusConnected)
+		}
+	case server.StatusCancelled, server.StatusTimeout:
+		session.conf.Logger.WithFields(logrus.Fields{"session": session.token, "signer": signer}).
+			Info("Signature session of signer aborted, aborting multi-signature session")
+		session.result.Err = result.Err
+		session.setStatus(status)
+	case server.StatusDone:
+		session.cosigned[signer] = result.Signature
+		for _, sig := range session.cosigned {
+			if sig == nil {
+				return
+			}
+		}
+		session.finishMultiSign()
+	}
+}
+
+// finishMultiSign combines the signatures of all signers into a signature bundle, and verifies it.
+func (session *session) finishMultiSign() {
+	request := session.request.(*irma.MultiSignatureRequest)
+	cosigners := session.result.CoSigners
+
+	bundle, err := irma.NewSignatureBundle(request.Message, session.cosigned)
+	if err != nil {
+		session.fail(server.ErrorMalformedInput, err.Error())
+		session.result.CoSigners = cosigners
+		return
+	}
+	session.result.SignatureBundle = bundle
+	if _, session.result.ProofStatus, err = bundle.Verify(session.conf.IrmaConfiguration, request); err != nil {
+		session.fail(server.ErrorUnknown, err.Error())
+		session.result.CoSigners = cosigners
+		return
+	}
+	session.setStatus(server.StatusDone)
+}
+
+// cancelChildren cancels the signature sessions of the signers that are still running.
+// Must not be called with the lock of this session held.
+func (session *session) cancelChildren() {
+	for _, child := range session.children {
+		child.Lock()
+		child.handleDelete()
+		child.Unlock()
+	}
+}
+
+// updatedParentResult returns the result of the parent session if its status changed since the
+// last time its result was returned, and nil otherwise.
+func (session *session) updatedParentResult() *server.SessionResult {
+	parent := session.parent
+	parent.Lock()
+	defer parent.Unlock()
+	if parent.status == parent.prevStatus {
+		return nil
+	}
+	parent.prevStatus = parent.status
+	return parent.result
+}
@@ -34,6 +34,13 @@ type session struct {
 
 	kssProofs map[irma.SchemeManagerIdentifier]*gabi.ProofP
 
+	// Multi-signature sessions consist of a parent session, which is not accessible to clients,
+	// and a signature session per signer
+	parent   *session
+	signer   int
+	children []*session
+	cosigned []*irma.SignedMessage
+
 	conf     *server.Configuration
 	sessions sessionStore
 }
@@ -88,7 +95,9 @@ func (s *memorySessionStore) add(session *session) {
 	s.Lock()
 	defer s.Unlock()
 	s.requestor[session.token] = session
-	s.client[session.clientToken] = session
+	if session.clientToken != "" {
+		s.client[session.clientToken] = session
+	}
 }
 
 func (s *memorySessionStore) update(session *session) {
@@ -150,6 +159,9 @@ var one *big.Int = big.NewInt(1)
 func (s *Server) newSession(action irma.Action, request irma.RequestorRequest) *session {
 	token := newSessionToken()
 	clientToken := newSessionToken()
+	if action == irma.ActionMultiSigning {
+		clientToken = "" // clients connect to the signature sessions of the signers instead
+	}
 
 	ses := &session{
 		action:      action,
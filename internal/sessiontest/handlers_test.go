@@ -17,8 +17,9 @@ type TestClientHandler struct {
 	c chan error
 }
 
-func (i *TestClientHandler) UpdateConfiguration(new *irma.IrmaIdentifierSet) {}
-func (i *TestClientHandler) UpdateAttributes()                               {}
+func (i *TestClientHandler) UpdateConfiguration(new *irma.IrmaIdentifierSet)      {}
+func (i *TestClientHandler) UpdateAttributes()                                    {}
+func (i *TestClientHandler) CredentialsExpiring([]*irmaclient.ExpiringCredential) {}
 func (i *TestClientHandler) EnrollmentSuccess(manager irma.SchemeManagerIdentifier) {
 	select {
 	case i.c <- nil: // nop
@@ -103,21 +104,21 @@ func (th TestHandler) UnsatisfiableRequest(request irma.SessionRequest, serverNa
 		ErrorType: irma.ErrorType("UnsatisfiableRequest"),
 	})
 }
-func (th TestHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, ServerName irma.TranslatedString, callback irmaclient.PermissionHandler) {
+func (th TestHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, callback irmaclient.PermissionHandler) {
 	var choice irma.DisclosureChoice
 	for _, cand := range candidates {
 		choice.Attributes = append(choice.Attributes, cand[0])
 	}
 	if len(th.expectedServerName) != 0 {
-		require.Equal(th.t, th.expectedServerName, ServerName)
+		require.Equal(th.t, th.expectedServerName, requestor.Name)
 	}
 	callback(true, &choice)
 }
-func (th TestHandler) RequestIssuancePermission(request *irma.IssuanceRequest, candidates [][][]*irma.AttributeIdentifier, ServerName irma.TranslatedString, callback irmaclient.PermissionHandler) {
-	th.RequestVerificationPermission(&request.DisclosureRequest, candidates, ServerName, callback)
+func (th TestHandler) RequestIssuancePermission(request *irma.IssuanceRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, callback irmaclient.PermissionHandler) {
+	th.RequestVerificationPermission(&request.DisclosureRequest, candidates, requestor, callback)
 }
-func (th TestHandler) RequestSignaturePermission(request *irma.SignatureRequest, candidates [][][]*irma.AttributeIdentifier, ServerName irma.TranslatedString, callback irmaclient.PermissionHandler) {
-	th.RequestVerificationPermission(&request.DisclosureRequest, candidates, ServerName, callback)
+func (th TestHandler) RequestSignaturePermission(request *irma.SignatureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, callback irmaclient.PermissionHandler) {
+	th.RequestVerificationPermission(&request.DisclosureRequest, candidates, requestor, callback)
 }
 func (th TestHandler) RequestSchemeManagerPermission(manager *irma.SchemeManager, callback func(proceed bool)) {
 	callback(true)
@@ -145,6 +146,20 @@ func (th UnsatisfiableTestHandler) Success(result string) {
 	th.Failure(&irma.SessionError{ErrorType: irma.ErrorType("Unsatisfiable request succeeded")})
 }
 
+// PostponedPermissionTestHandler embeds a TestHandler to inherit its methods, but instead of
+// giving permission for disclosure sessions, it sends a function giving the permission over its
+// channel, so that the test decides when the session continues.
+type PostponedPermissionTestHandler struct {
+	*TestHandler
+	permission chan func()
+}
+
+func (th PostponedPermissionTestHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, callback irmaclient.PermissionHandler) {
+	th.permission <- func() {
+		th.TestHandler.RequestVerificationPermission(request, candidates, requestor, callback)
+	}
+}
+
 // ManualTestHandler embeds a TestHandler to inherit its methods.
 // Below we overwrite the methods that require behaviour specific to manual settings.
 type ManualTestHandler struct {
@@ -182,10 +197,10 @@ func (th *ManualTestHandler) Success(result string) {
 
 	th.c <- retval
 }
-func (th *ManualTestHandler) RequestSignaturePermission(request *irma.SignatureRequest, candidates [][][]*irma.AttributeIdentifier, requesterName irma.TranslatedString, ph irmaclient.PermissionHandler) {
-	th.RequestVerificationPermission(&request.DisclosureRequest, candidates, requesterName, ph)
+func (th *ManualTestHandler) RequestSignaturePermission(request *irma.SignatureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, ph irmaclient.PermissionHandler) {
+	th.RequestVerificationPermission(&request.DisclosureRequest, candidates, requestor, ph)
 }
-func (th *ManualTestHandler) RequestIssuancePermission(request *irma.IssuanceRequest, candidates [][][]*irma.AttributeIdentifier, issuerName irma.TranslatedString, ph irmaclient.PermissionHandler) {
+func (th *ManualTestHandler) RequestIssuancePermission(request *irma.IssuanceRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, ph irmaclient.PermissionHandler) {
 	ph(true, nil)
 }
 
@@ -193,7 +208,7 @@ func (th *ManualTestHandler) RequestIssuancePermission(request *irma.IssuanceReq
 func (th *ManualTestHandler) RequestSchemeManagerPermission(manager *irma.SchemeManager, callback func(proceed bool)) {
 	th.Failure(&irma.SessionError{Err: errors.New("Unexpected session type")})
 }
-func (th *ManualTestHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, verifierName irma.TranslatedString, ph irmaclient.PermissionHandler) {
+func (th *ManualTestHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *irmaclient.RequestorInfo, ph irmaclient.PermissionHandler) {
 	var choice irma.DisclosureChoice
 	for _, cand := range candidates {
 		choice.Attributes = append(choice.Attributes, cand[0])
@@ -1,10 +1,15 @@
 package sessiontest
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/privacybydesign/irmago"
 	"github.com/privacybydesign/irmago/internal/test"
+	"github.com/privacybydesign/irmago/irmaclient"
 	"github.com/stretchr/testify/require"
 )
 
@@ -80,3 +85,59 @@ func TestLogging(t *testing.T) {
 
 	test.ClearTestStorage(t)
 }
+
+func TestLogQuery(t *testing.T) {
+	client, _ := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	start := time.Now().Add(-time.Second)
+	attrid := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	sessionHelper(t, getCombinedIssuanceRequest(attrid), "issue", client)
+	sessionHelper(t, getDisclosureRequest(attrid), "verification", client)
+	sessionHelper(t, getSigningRequest(attrid), "signature", client)
+
+	logs, err := client.QueryLogs(&irmaclient.LogFilter{From: start, AttributeTypes: []irma.AttributeTypeIdentifier{attrid}})
+	require.NoError(t, err)
+	require.Len(t, logs, 3)
+	require.Equal(t, irma.ActionSigning, logs[0].Type)
+	require.Equal(t, irma.ActionIssuing, logs[2].Type)
+
+	logs, err = client.QueryLogs(&irmaclient.LogFilter{From: start, Types: []irma.Action{irma.ActionDisclosing}})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	logs, err = client.QueryLogs(&irmaclient.LogFilter{
+		CredentialTypes: []irma.CredentialTypeIdentifier{irma.NewCredentialTypeIdentifier("irma-demo.MijnOverheid.root")},
+		From:            start,
+	})
+	require.NoError(t, err)
+	require.Empty(t, logs)
+
+	logs, err = client.QueryLogs(&irmaclient.LogFilter{From: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.Empty(t, logs)
+
+	logs, err = client.QueryLogs(&irmaclient.LogFilter{Max: 1})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, irma.ActionSigning, logs[0].Type)
+
+	// Export the signature session
+	var buf bytes.Buffer
+	require.NoError(t, client.ExportLogsJSON(&buf, logs))
+	var exports []*irmaclient.LogExport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &exports))
+	require.Len(t, exports, 1)
+	require.NotNil(t, exports[0].SignedMessage)
+	require.Equal(t, attrid, exports[0].Disclosed[0][0].Identifier)
+
+	buf.Reset()
+	require.NoError(t, client.ExportLogsCSV(&buf, logs, "en"))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Equal(t, "id", rows[0][0])
+	require.Equal(t, string(irma.ActionSigning), rows[1][1])
+	require.Equal(t, attrid.String(), rows[1][5])
+	require.Equal(t, exports[0].SignedMessage.Message, rows[1][7])
+}
@@ -44,6 +44,7 @@ func parseStorage(t *testing.T) (*irmaclient.Client, *TestClientHandler) {
 		filepath.Join(path, "irma_configuration"),
 		"",
 		handler,
+		nil,
 	)
 	require.NoError(t, err)
 	return client, handler
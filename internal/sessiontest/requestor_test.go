@@ -5,14 +5,17 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"reflect"
 
 	"testing"
 
+	"github.com/privacybydesign/gabi"
 	"github.com/privacybydesign/irmago"
 	"github.com/privacybydesign/irmago/internal/test"
 	"github.com/privacybydesign/irmago/irmaclient"
 	"github.com/privacybydesign/irmago/server"
+	"github.com/privacybydesign/irmago/server/irmaserver"
 	"github.com/stretchr/testify/require"
 )
 
@@ -102,6 +105,30 @@ func TestRequestorInvalidRequest(t *testing.T) {
 	require.Error(t, err)
 }
 
+// Check that issuance sessions are refused when the private key of the issuer belongs to an expired public key
+func TestRequestorIssuanceExpiredKey(t *testing.T) {
+	testdata := test.FindTestdataFolder(t)
+	issuer := irma.NewIssuerIdentifier("test.test")
+	sk, err := gabi.NewPrivateKeyFromFile(filepath.Join(testdata, "irma_configuration", "test", "test", "PrivateKeys", "3.xml"))
+	require.NoError(t, err)
+
+	srv, err := irmaserver.New(&server.Configuration{
+		URL:               "http://localhost:48680",
+		Logger:            logger,
+		SchemesPath:       filepath.Join(testdata, "irma_configuration"),
+		IssuerPrivateKeys: map[irma.IssuerIdentifier]*gabi.PrivateKey{issuer: sk},
+	})
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	_, _, err = srv.StartSession(irma.NewIssuanceRequest([]*irma.CredentialRequest{{
+		CredentialTypeID: irma.NewCredentialTypeIdentifier("test.test.mijnirma"),
+		Attributes:       map[string]string{"email": "testusername"},
+	}}), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "expired")
+}
+
 func TestRequestorDoubleGET(t *testing.T) {
 	StartIrmaServer(t, false)
 	defer StopIrmaServer()
@@ -147,6 +174,69 @@ func TestRequestorSignatureSession(t *testing.T) {
 	require.Equal(t, irma.ProofStatusValid, status)
 }
 
+func TestRequestorMultiSignatureSession(t *testing.T) {
+	client, _ := parseStorage(t)
+	defer test.ClearTestStorage(t)
+	StartIrmaServer(t, false)
+	defer StopIrmaServer()
+
+	studentID := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	bsn := irma.NewAttributeTypeIdentifier("irma-demo.MijnOverheid.root.BSN")
+	request := irma.NewMultiSignatureRequest("message", []irma.AttributeTypeIdentifier{studentID}, []irma.AttributeTypeIdentifier{bsn})
+
+	serverChan := make(chan *server.SessionResult)
+	qrs, token, err := irmaServer.StartMultiSignSession(request, func(result *server.SessionResult) {
+		serverChan <- result
+	})
+	require.NoError(t, err)
+	require.Len(t, qrs, 2)
+
+	// Let each signer sign in turn, so that the signature timestamps are ordered
+	for _, qr := range qrs {
+		clientChan := make(chan *SessionResult)
+		j, err := json.Marshal(qr)
+		require.NoError(t, err)
+		client.NewSession(string(j), &TestHandler{t, clientChan, client, nil, ""})
+		if clientResult := <-clientChan; clientResult != nil {
+			require.NoError(t, clientResult.Err)
+		}
+	}
+
+	serverResult := <-serverChan
+	require.Equal(t, token, serverResult.Token)
+	require.Equal(t, server.StatusDone, serverResult.Status)
+	require.Equal(t, irma.ProofStatusValid, serverResult.ProofStatus)
+	require.NotNil(t, serverResult.SignatureBundle)
+	require.Len(t, serverResult.CoSigners, 2)
+
+	attrs, status, err := serverResult.SignatureBundle.Verify(client.Configuration, request)
+	require.NoError(t, err)
+	require.Equal(t, irma.ProofStatusValid, status)
+	require.Equal(t, studentID, attrs[0][0][0].Identifier)
+	require.Equal(t, bsn, attrs[1][0][0].Identifier)
+
+	// A bundle in which one of the signers is missing does not satisfy the request
+	bundle := *serverResult.SignatureBundle
+	bundle.Signatures = bundle.Signatures[:1]
+	_, status, err = bundle.Verify(client.Configuration, request)
+	require.NoError(t, err)
+	require.Equal(t, irma.ProofStatusUnmatchedRequest, status)
+
+	// A bundle containing a signature without timestamp is rejected
+	sig := *serverResult.SignatureBundle.Signatures[1].Signature
+	sig.Timestamp = nil
+	bundle.Signatures = []*irma.CoSignature{
+		serverResult.SignatureBundle.Signatures[0],
+		{Signer: serverResult.SignatureBundle.Signatures[1].Signer, Signature: &sig},
+	}
+	_, status, err = bundle.Verify(client.Configuration, request)
+	require.Error(t, err)
+	require.Equal(t, irma.ProofStatusInvalid, status)
+	bts, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	require.Error(t, irma.UnmarshalValidate(bts, &irma.SignatureBundle{}))
+}
+
 func TestRequestorDisclosureSession(t *testing.T) {
 	id := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
 	request := irma.NewDisclosureRequest(id)
@@ -333,3 +423,132 @@ func TestOptionalDisclosure(t *testing.T) {
 		require.True(t, reflect.DeepEqual(args.disclosed, result.Disclosed))
 	}
 }
+
+func TestSessionPolicy(t *testing.T) {
+	client, _ := parseStorage(t)
+	defer test.ClearTestStorage(t)
+	studentid := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	bsn := irma.NewAttributeTypeIdentifier("irma-demo.MijnOverheid.root.BSN")
+
+	blockedSessionHelper := func(request irma.SessionRequest) {
+		StartIrmaServer(t, false)
+		defer StopIrmaServer()
+		serverChan := make(chan *server.SessionResult, 1)
+		qr, _, err := irmaServer.StartSession(request, func(result *server.SessionResult) {
+			serverChan <- result
+		})
+		require.NoError(t, err)
+
+		clientChan := make(chan *SessionResult)
+		j, err := json.Marshal(qr)
+		require.NoError(t, err)
+		client.NewSession(string(j), &TestHandler{t, clientChan, client, nil, ""})
+		clientResult := <-clientChan
+		require.NotNil(t, clientResult)
+		require.Error(t, clientResult.Err)
+		require.Equal(t, irma.ErrorBlocked, clientResult.Err.(*irma.SessionError).ErrorType)
+		require.Equal(t, server.StatusCancelled, (<-serverChan).Status)
+	}
+
+	// Block all sessions with the IRMA server
+	require.NoError(t, client.SetSessionPolicy(&irmaclient.SessionPolicy{
+		Rules: []*irmaclient.SessionPolicyRule{{Hostname: "localhost", Block: true}},
+	}))
+	blockedSessionHelper(irma.NewDisclosureRequest(studentid))
+
+	// Allow only the studentID to be disclosed to it
+	require.NoError(t, client.SetSessionPolicy(&irmaclient.SessionPolicy{
+		AllowedHostsOnly: true,
+		Rules: []*irmaclient.SessionPolicyRule{
+			{Hostname: "localhost", Attributes: []irma.AttributeTypeIdentifier{studentid}},
+		},
+	}))
+	blockedSessionHelper(irma.NewDisclosureRequest(bsn))
+	result := requestorSessionHelper(t, irma.NewDisclosureRequest(studentid), client)
+	require.Nil(t, result.Err)
+	require.Equal(t, irma.ProofStatusValid, result.ProofStatus)
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	client, _ := parseStorage(t)
+	defer test.ClearTestStorage(t)
+	StartIrmaServer(t, false)
+	defer StopIrmaServer()
+
+	request := irma.NewDisclosureRequest(irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID"))
+	newSession := func() string {
+		qr, _, err := irmaServer.StartSession(request, nil)
+		require.NoError(t, err)
+		j, err := json.Marshal(qr)
+		require.NoError(t, err)
+		return string(j)
+	}
+
+	// Start a session, and keep it waiting for permission
+	clientChan := make(chan *SessionResult, 1)
+	permission := make(chan func(), 1)
+	client.NewSession(newSession(), PostponedPermissionTestHandler{
+		&TestHandler{t, clientChan, client, nil, ""}, permission,
+	})
+	approve := <-permission
+
+	// A second session is refused while the first one is running
+	otherChan := make(chan *SessionResult, 1)
+	client.NewSession(newSession(), &TestHandler{t, otherChan, client, nil, ""})
+	otherResult := <-otherChan
+	require.NotNil(t, otherResult)
+	require.Error(t, otherResult.Err)
+	require.Equal(t, irma.ErrorSessionInProgress, otherResult.Err.(*irma.SessionError).ErrorType)
+
+	// The first session is unaffected
+	approve()
+	require.Nil(t, <-clientChan)
+
+	// Once it has finished, new sessions can be started
+	client.NewSession(newSession(), &TestHandler{t, otherChan, client, nil, ""})
+	require.Nil(t, <-otherChan)
+}
+
+func TestSessionEvents(t *testing.T) {
+	client, _ := parseStorage(t)
+	defer test.ClearTestStorage(t)
+	StartIrmaServer(t, false)
+	defer StopIrmaServer()
+
+	id := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	eventsHelper := func(approve bool) (events []irmaclient.SessionEvent, result *server.SessionResult) {
+		serverChan := make(chan *server.SessionResult, 1)
+		qr, _, err := irmaServer.StartSession(irma.NewDisclosureRequest(id), func(result *server.SessionResult) {
+			serverChan <- result
+		})
+		require.NoError(t, err)
+		j, err := json.Marshal(qr)
+		require.NoError(t, err)
+
+		eventChan, dismisser := client.NewSessionEvents(string(j))
+		require.NotNil(t, dismisser)
+		for event := range eventChan {
+			events = append(events, event)
+			if permission, ok := event.(*irmaclient.PermissionRequestEvent); ok {
+				require.Equal(t, irma.ActionDisclosing, permission.Action)
+				if approve {
+					permission.Approve(permission.ProposedChoice())
+				} else {
+					permission.Deny()
+				}
+			}
+		}
+		require.True(t, events[len(events)-1].Final())
+		return events, <-serverChan
+	}
+
+	events, result := eventsHelper(true)
+	require.Equal(t, &irmaclient.StatusUpdateEvent{Action: irma.ActionDisclosing, Status: irma.StatusCommunicating}, events[0])
+	require.IsType(t, &irmaclient.SuccessEvent{}, events[len(events)-1])
+	require.Equal(t, irma.ProofStatusValid, result.ProofStatus)
+	require.Equal(t, "456", result.Disclosed[0][0].Value["en"])
+
+	events, result = eventsHelper(false)
+	require.IsType(t, &irmaclient.CancelledEvent{}, events[len(events)-1])
+	require.Equal(t, server.StatusCancelled, result.Status)
+}
@@ -1,8 +1,11 @@
 package sessiontest
 
 import (
+	"io/ioutil"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -134,3 +137,140 @@ var JwtServerConfiguration = &requestorserver.Configuration{
 	},
 	JwtPrivateKeyFile: filepath.Join(testdata, "jwtkeys", "sk.pem"),
 }
+
+// logEntries is a logrus hook recording the messages of all log entries.
+type logEntries struct {
+	sync.Mutex
+	messages []string
+}
+
+func (l *logEntries) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (l *logEntries) Fire(entry *logrus.Entry) error {
+	l.Lock()
+	defer l.Unlock()
+	l.messages = append(l.messages, entry.Message)
+	return nil
+}
+
+func (l *logEntries) contains(substr string) bool {
+	l.Lock()
+	defer l.Unlock()
+	for _, msg := range l.messages {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *logEntries) reset() {
+	l.Lock()
+	defer l.Unlock()
+	l.messages = nil
+}
+
+// newListenerTestConfiguration returns a logger recording its entries and a parsed read-only
+// configuration, out of which schemes can be removed and restored by reparsing it.
+func newListenerTestConfiguration(t *testing.T) (*logrus.Logger, *logEntries, *irma.Configuration) {
+	entries := &logEntries{}
+	logger := logrus.New()
+	logger.Level = logrus.InfoLevel
+	logger.Out = ioutil.Discard
+	logger.AddHook(entries)
+
+	conf, err := irma.NewConfigurationReadOnly(filepath.Join(testdata, "irma_configuration"))
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+	return logger, entries, conf
+}
+
+func TestIrmaServerConfigurationUpdateListener(t *testing.T) {
+	logger, entries, conf := newListenerTestConfiguration(t)
+	srv, err := irmaserver.New(&server.Configuration{
+		URL:                  "http://localhost:48680",
+		Logger:               logger,
+		IrmaConfiguration:    conf,
+		DisableSchemesUpdate: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, conf.RemoveSchemeManager(irma.NewSchemeManagerIdentifier("test"), false))
+	require.True(t, entries.contains("IRMA configuration updated"))
+
+	// Stopped servers are no longer notified
+	srv.Stop()
+	entries.reset()
+	require.NoError(t, conf.ParseFolder())
+	require.NotNil(t, conf.SchemeManager(irma.NewSchemeManagerIdentifier("test")))
+	require.False(t, entries.contains("IRMA configuration updated"))
+}
+
+func TestRequestorServerConfigurationUpdateListener(t *testing.T) {
+	logger, entries, conf := newListenerTestConfiguration(t)
+	StartRequestorServer(&requestorserver.Configuration{
+		Configuration: &server.Configuration{
+			URL:                  "http://localhost:48682/irma",
+			Logger:               logger,
+			IrmaConfiguration:    conf,
+			DisableSchemesUpdate: true,
+		},
+		DisableRequestorAuthentication: true,
+		Port:                           48682,
+		Permissions: requestorserver.Permissions{
+			Disclosing: []string{"test.test.email.email"},
+		},
+	})
+
+	// Permissions referring to the removed scheme are reported
+	require.NoError(t, conf.RemoveSchemeManager(irma.NewSchemeManagerIdentifier("test"), false))
+	require.True(t, entries.contains("Permissions invalid after IRMA configuration update"))
+	require.True(t, entries.contains("IRMA configuration updated"))
+
+	StopRequestorServer()
+	entries.reset()
+	require.NoError(t, conf.ParseFolder())
+	require.NoError(t, conf.RemoveSchemeManager(irma.NewSchemeManagerIdentifier("test"), false))
+	require.False(t, entries.contains("Permissions invalid after IRMA configuration update"))
+	require.False(t, entries.contains("IRMA configuration updated"))
+}
+
+func TestRequestorServerLogos(t *testing.T) {
+	StartRequestorServer(IrmaServerConfiguration)
+	defer StopRequestorServer()
+
+	get := func(path string) (int, []byte) {
+		res, err := http.Get("http://localhost:48682" + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		bts, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, bts
+	}
+
+	for path, file := range map[string]string{
+		"/logos/irma-demo/RU/logo.png":             "irma-demo/RU/logo.png",
+		"/logos/irma-demo/RU/studentCard/logo.png": "irma-demo/RU/Issues/studentCard/logo.png",
+	} {
+		expected, err := ioutil.ReadFile(filepath.Join(testdata, "irma_configuration", filepath.FromSlash(file)))
+		require.NoError(t, err)
+		status, bts := get(path)
+		require.Equal(t, http.StatusOK, status, path)
+		require.Equal(t, expected, bts, path)
+	}
+
+	// Unknown identifiers and attempts to escape the scheme folders are not found
+	for _, path := range []string{
+		"/logos/irma-demo/foo/logo.png",
+		"/logos/irma-demo/RU/foo/logo.png",
+		"/logos/foo/RU/logo.png",
+		"/logos/irma-demo/../logo.png",
+		"/logos/irma-demo/RU/..%2F..%2F..%2Fprivatekeys/logo.png",
+		"/logos/..%2Fjwtkeys/RU/logo.png",
+	} {
+		status, _ := get(path)
+		require.Equal(t, http.StatusNotFound, status, path)
+	}
+}
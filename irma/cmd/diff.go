@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff old new",
+	Short: "Show the differences between two versions of a scheme or irma_configuration folder",
+	Long: `The diff command parses the two specified folders and prints the scheme managers, issuers,
+credential types, attribute types and public keys that were added, removed or modified in the
+new one compared to the old one, including the fields of modified items that differ.
+
+Both arguments must be either a scheme folder (containing an index file), in which case both must
+be versions of the same scheme (and so both named after its identifier), or an irma_configuration
+folder containing scheme folders.`,
+	Example: `irma scheme diff old/irma-demo new/irma-demo`,
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		asJson, _ := cmd.Flags().GetBool("json")
+
+		oldconf, oldscheme, err := parseDiffFolder(args[0])
+		if err != nil {
+			die("Failed to parse "+args[0], err)
+		}
+		newconf, newscheme, err := parseDiffFolder(args[1])
+		if err != nil {
+			die("Failed to parse "+args[1], err)
+		}
+
+		var diff *irma.ConfigurationDiff
+		switch {
+		case oldscheme == nil && newscheme == nil:
+			diff, err = oldconf.Diff(newconf)
+		case oldscheme != nil && newscheme != nil && *oldscheme == *newscheme:
+			diff, err = oldconf.DiffScheme(newconf, *oldscheme)
+		default:
+			die("", errors.New("Can only compare two versions of the same scheme, or two irma_configuration folders"))
+		}
+		if err != nil {
+			die("Failed to compare configurations", err)
+		}
+
+		if asJson {
+			fmt.Println(prettyprint(diff))
+		} else {
+			fmt.Print(diff.String())
+		}
+	},
+}
+
+// parseDiffFolder parses the specified scheme or irma_configuration folder. If it is a scheme,
+// its identifier is returned as well.
+func parseDiffFolder(path string) (*irma.Configuration, *irma.SchemeManagerIdentifier, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	isScheme, err := fs.PathExists(filepath.Join(path, "index"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !isScheme {
+		conf, err := irma.NewConfigurationReadOnly(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = conf.ParseFolder(); err != nil {
+			return nil, nil, err
+		}
+		return conf, nil, nil
+	}
+
+	conf, err := irma.NewConfigurationReadOnly(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	scheme := irma.NewSchemeManager(filepath.Base(path))
+	if err = conf.ParseSchemeManagerFolder(path, scheme); err != nil {
+		return nil, nil, err
+	}
+	id := scheme.Identifier()
+	return conf, &id, nil
+}
+
+func init() {
+	schemeCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().Bool("json", false, "print the differences as JSON")
+}
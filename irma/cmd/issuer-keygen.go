@@ -38,35 +38,9 @@ IRMA applications.`,
 		expiryDateString, _ := flags.GetString("expirydate")
 		validFor, _ := flags.GetString("valid-for")
 
-		var expiryDate time.Time
-		var err error
-		if expiryDateString != "" {
-			expiryDate, err = time.Parse(time.RFC3339, expiryDateString)
-			if err != nil {
-				return errors.WrapPrefix(err, "Failed to parse expirydate", 0)
-			}
-		} else {
-			expiryDate = time.Now()
-			m := regexp.MustCompile(`^(\d+)([yMdhm])$`).FindStringSubmatch(validFor)
-			if m == nil {
-				return errors.New("unable to parse valid-for period")
-			}
-			num, err := strconv.Atoi(m[1])
-			if err != nil {
-				return errors.New("unable to parse valid-for period")
-			}
-			switch m[2] {
-			case "m":
-				expiryDate = expiryDate.Add(time.Minute * time.Duration(num))
-			case "h":
-				expiryDate = expiryDate.Add(time.Hour * time.Duration(num))
-			case "d":
-				expiryDate = expiryDate.AddDate(0, 0, num)
-			case "M":
-				expiryDate = expiryDate.AddDate(0, num, 0)
-			case "y":
-				expiryDate = expiryDate.AddDate(num, 0, 0)
-			}
+		expiryDate, err := parseExpiryDate(expiryDateString, validFor)
+		if err != nil {
+			return err
 		}
 
 		var path string
@@ -83,45 +57,86 @@ IRMA applications.`,
 			return errors.WrapPrefix(err, "Nonexisting path specified", 0)
 		}
 
-		if counter == 0 {
-			counter = uint(defaultCounter(path))
-		}
+		return generateIssuerKeys(path, keylength, counter, numAttributes, expiryDate, privkeyfile, pubkeyfile, overwrite)
+	},
+}
 
-		// Now generate the key pair
-		fmt.Println("Generating keys (may take several minutes)")
-		sysParams, ok := gabi.DefaultSystemParameters[keylength]
-		if !ok {
-			return errors.Errorf("Unsupported key length, should be one of %v", gabi.DefaultKeyLengths)
-		}
-		privk, pubk, err := gabi.GenerateKeyPair(sysParams, numAttributes, counter, expiryDate)
+// parseExpiryDate parses the specified RFC3339 expiry date, or if it is empty, returns the current
+// time plus the specified period (e.g. "2y").
+func parseExpiryDate(expiryDateString, validFor string) (time.Time, error) {
+	if expiryDateString != "" {
+		expiryDate, err := time.Parse(time.RFC3339, expiryDateString)
 		if err != nil {
-			return err
+			return time.Time{}, errors.WrapPrefix(err, "Failed to parse expirydate", 0)
 		}
+		return expiryDate, nil
+	}
 
-		defaultFilename := strconv.Itoa(int(counter)) + ".xml"
-		if privkeyfile == "" {
-			keypath := filepath.Join(path, "PrivateKeys")
-			if err = fs.EnsureDirectoryExists(keypath); err != nil {
-				return errors.WrapPrefix(err, "Failed to create"+keypath, 0)
-			}
-			privkeyfile = filepath.Join(keypath, defaultFilename)
-		}
-		if pubkeyfile == "" {
-			keypath := filepath.Join(path, "PublicKeys")
-			if err = fs.EnsureDirectoryExists(keypath); err != nil {
-				return errors.WrapPrefix(err, "Failed to create"+keypath, 0)
-			}
-			pubkeyfile = filepath.Join(keypath, defaultFilename)
-		}
+	expiryDate := time.Now()
+	m := regexp.MustCompile(`^(\d+)([yMdhm])$`).FindStringSubmatch(validFor)
+	if m == nil {
+		return time.Time{}, errors.New("unable to parse valid-for period")
+	}
+	num, err := strconv.Atoi(m[1])
+	if err != nil {
+		return time.Time{}, errors.New("unable to parse valid-for period")
+	}
+	switch m[2] {
+	case "m":
+		expiryDate = expiryDate.Add(time.Minute * time.Duration(num))
+	case "h":
+		expiryDate = expiryDate.Add(time.Hour * time.Duration(num))
+	case "d":
+		expiryDate = expiryDate.AddDate(0, 0, num)
+	case "M":
+		expiryDate = expiryDate.AddDate(0, num, 0)
+	case "y":
+		expiryDate = expiryDate.AddDate(num, 0, 0)
+	}
+	return expiryDate, nil
+}
+
+// generateIssuerKeys generates an issuer private/public keypair and writes it to the specified
+// files, by default to the PrivateKeys and PublicKeys subfolders of the issuer at path.
+func generateIssuerKeys(path string, keylength int, counter uint, numAttributes int, expiryDate time.Time, privkeyfile, pubkeyfile string, overwrite bool) error {
+	if counter == 0 {
+		counter = uint(defaultCounter(path))
+	}
+
+	// Now generate the key pair
+	fmt.Println("Generating keys (may take several minutes)")
+	sysParams, ok := gabi.DefaultSystemParameters[keylength]
+	if !ok {
+		return errors.Errorf("Unsupported key length, should be one of %v", gabi.DefaultKeyLengths)
+	}
+	privk, pubk, err := gabi.GenerateKeyPair(sysParams, numAttributes, counter, expiryDate)
+	if err != nil {
+		return err
+	}
 
-		if _, err = privk.WriteToFile(privkeyfile, overwrite); err != nil {
-			return errors.New("private key file already exists, will not overwrite (force with -f flag)")
+	defaultFilename := strconv.Itoa(int(counter)) + ".xml"
+	if privkeyfile == "" {
+		keypath := filepath.Join(path, "PrivateKeys")
+		if err = fs.EnsureDirectoryExists(keypath); err != nil {
+			return errors.WrapPrefix(err, "Failed to create"+keypath, 0)
 		}
-		if _, err = pubk.WriteToFile(pubkeyfile, overwrite); err != nil {
-			return errors.New("public key file already exists, will not overwrite (force with -f flag)")
+		privkeyfile = filepath.Join(keypath, defaultFilename)
+	}
+	if pubkeyfile == "" {
+		keypath := filepath.Join(path, "PublicKeys")
+		if err = fs.EnsureDirectoryExists(keypath); err != nil {
+			return errors.WrapPrefix(err, "Failed to create"+keypath, 0)
 		}
-		return nil
-	},
+		pubkeyfile = filepath.Join(keypath, defaultFilename)
+	}
+
+	if _, err = privk.WriteToFile(privkeyfile, overwrite); err != nil {
+		return errors.New("private key file already exists, will not overwrite (force with -f flag)")
+	}
+	if _, err = pubk.WriteToFile(pubkeyfile, overwrite); err != nil {
+		return errors.New("public key file already exists, will not overwrite (force with -f flag)")
+	}
+	return nil
 }
 
 func defaultCounter(path string) (counter int) {
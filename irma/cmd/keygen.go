@@ -32,44 +32,50 @@ var keygenCmd = &cobra.Command{
 			return err
 		}
 
-		// For safety we enforce that we never overwrite a file
-		if err := fs.AssertPathNotExists(skfile); err != nil {
-			return errors.Errorf("File %s already exists, not overwriting", skfile)
-		}
-		if err := fs.AssertPathNotExists(pkfile); err != nil {
-			return errors.Errorf("File %s already exists, not overwriting", pkfile)
-		}
+		return generateSchemeKeypair(skfile, pkfile)
+	},
+}
 
-		// Generate keys
-		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-		if err != nil {
-			return err
-		}
+// generateSchemeKeypair generates an ECDSA keypair for signing schemes, and writes it to the
+// specified files.
+func generateSchemeKeypair(skfile, pkfile string) error {
+	// For safety we enforce that we never overwrite a file
+	if err := fs.AssertPathNotExists(skfile); err != nil {
+		return errors.Errorf("File %s already exists, not overwriting", skfile)
+	}
+	if err := fs.AssertPathNotExists(pkfile); err != nil {
+		return errors.Errorf("File %s already exists, not overwriting", pkfile)
+	}
 
-		// Marshal keys
-		bts, err := x509.MarshalECPrivateKey(key)
-		if err != nil {
-			return err
-		}
-		pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: bts})
-		bts, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
-		if err != nil {
-			os.Exit(1)
-		}
-		pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bts})
+	// Generate keys
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
 
-		// Save keys
-		if err = ioutil.WriteFile(skfile, pemEncoded, 0600); err != nil {
-			return err
-		}
-		fmt.Println("Private key written at", skfile)
-		if err = ioutil.WriteFile(pkfile, pemEncodedPub, 0644); err != nil {
-			return err
-		}
-		fmt.Println("Public key written at", pkfile)
+	// Marshal keys
+	bts, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: bts})
+	bts, err = x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		os.Exit(1)
+	}
+	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bts})
 
-		return nil
-	},
+	// Save keys
+	if err = ioutil.WriteFile(skfile, pemEncoded, 0600); err != nil {
+		return err
+	}
+	fmt.Println("Private key written at", skfile)
+	if err = ioutil.WriteFile(pkfile, pemEncodedPub, 0644); err != nil {
+		return err
+	}
+	fmt.Println("Public key written at", pkfile)
+
+	return nil
 }
 
 func init() {
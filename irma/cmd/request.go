@@ -130,6 +130,21 @@ func constructSessionRequest(cmd *cobra.Command, conf *irma.Configuration) (irma
 	sign, _ := cmd.Flags().GetStringArray("sign")
 	message, _ := cmd.Flags().GetString("message")
 	jsonrequest, _ := cmd.Flags().GetString("request")
+	signfile, _ := cmd.Flags().GetString("sign-file")
+
+	if signfile != "" {
+		if message != "" {
+			return nil, errors.New("cannot combine --message and --sign-file")
+		}
+		if len(sign) == 0 {
+			return nil, errors.New("file signature sessions require attributes to sign with using --sign")
+		}
+		document, err := fileMetadata(cmd, signfile)
+		if err != nil {
+			return nil, err
+		}
+		message = document.Message()
+	}
 
 	if len(disclose) == 0 && len(issue) == 0 && len(sign) == 0 && message == "" {
 		if jsonrequest == "" {
@@ -154,7 +169,7 @@ func constructSessionRequest(cmd *cobra.Command, conf *irma.Configuration) (irma
 			return nil, errors.New("cannot combine issuance and signature sessions, use either --issue or --sign")
 		}
 		if message == "" {
-			return nil, errors.New("signature sessions require a message to be signed using --message")
+			return nil, errors.New("signature sessions require a message to be signed using --message or --sign-file")
 		}
 	}
 
@@ -197,6 +212,19 @@ func constructSessionRequest(cmd *cobra.Command, conf *irma.Configuration) (irma
 	return request, nil
 }
 
+// fileMetadata computes the metadata, including the digest, of the file to be signed
+// in a file signature session.
+func fileMetadata(cmd *cobra.Command, path string) (*irma.FileMetadata, error) {
+	alg, _ := cmd.Flags().GetString("hash")
+	mediatype, _ := cmd.Flags().GetString("media-type")
+	document, err := irma.NewFileMetadataFromPath(path, irma.HashAlgorithm(alg))
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to compute digest of file to sign", 0)
+	}
+	document.MediaType = mediatype
+	return document, document.Validate()
+}
+
 func parseCredentials(credentialsStr []string, conf *irma.Configuration) ([]*irma.CredentialRequest, error) {
 	list := make([]*irma.CredentialRequest, 0, len(credentialsStr))
 
@@ -206,7 +234,7 @@ func parseCredentials(credentialsStr []string, conf *irma.Configuration) ([]*irm
 			return nil, errors.New("--issue argument must contain exactly 1 = sign")
 		}
 		credIdStr, attrsStr := parts[0], parts[1]
-		credtype := conf.CredentialTypes[irma.NewCredentialTypeIdentifier(credIdStr)]
+		credtype := conf.CredentialType(irma.NewCredentialTypeIdentifier(credIdStr))
 		if credtype == nil {
 			return nil, errors.New("unknown credential type: " + credIdStr)
 		}
@@ -236,7 +264,7 @@ func parseAttrs(attrsStr []string, conf *irma.Configuration) (irma.AttributeConD
 		attrids := strings.Split(disjunctionStr, ",")
 		for _, attridStr := range attrids {
 			attrid := irma.NewAttributeTypeIdentifier(attridStr)
-			if conf.AttributeTypes[attrid] == nil {
+			if conf.AttributeType(attrid) == nil {
 				return nil, errors.New("unknown attribute: " + attridStr)
 			}
 			disjunction = append(disjunction, irma.AttributeCon{irma.AttributeRequest{Type: attrid}})
@@ -309,4 +337,7 @@ func addRequestFlags(flags *pflag.FlagSet) {
 	flags.StringArray("issue", nil, "Add a credential to issue")
 	flags.StringArray("sign", nil, "Add an attribute disjunction to signature session")
 	flags.String("message", "", "Message to sign in signature session")
+	flags.String("sign-file", "", "File to sign in signature session (instead of --message)")
+	flags.String("hash", string(irma.DefaultHashAlgorithm), "Hash algorithm for --sign-file (sha256, sha384, sha512)")
+	flags.String("media-type", "", "Media type of the file to sign, e.g. application/pdf (optional)")
 }
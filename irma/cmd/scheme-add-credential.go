@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+var schemeAddCredentialCmd = &cobra.Command{
+	Use:   "add-credential issuer",
+	Short: "Add a new credential type to an issuer",
+	Long: `The add-credential command adds a credential type to the issuer at the specified path, within a scheme.
+
+The credential type is described either by flags, or by a YAML or JSON specification file (--spec).
+Translated fields are specified using lang=text values; a value without language is used for all
+languages. Attributes specified with --attribute get their identifier as name and description; use
+a specification file to specify these.
+
+Afterwards the scheme is signed using the key specified with --privatekey, and the containing
+irma_configuration folder is verified.`,
+	Example: `irma scheme add-credential --id studentCard --name "Student card" --attribute university --attribute studentID irma-demo/RU
+irma scheme add-credential --spec studentcard.yml irma-demo/RU`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		specfile, _ := flags.GetString("spec")
+		skfile, _ := flags.GetString("privatekey")
+
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			die("Invalid path", err)
+		}
+		if err = fs.AssertPathExists(filepath.Join(path, "description.xml")); err != nil {
+			die("", errors.Errorf("%s is not an issuer directory", path))
+		}
+
+		spec := &credentialSpec{}
+		if specfile != "" {
+			if err = readSpec(specfile, spec); err != nil {
+				die("", err)
+			}
+		} else {
+			spec.ID, _ = flags.GetString("id")
+			spec.Name = translationsFlag(cmd, "name", spec.ID)
+			spec.ShortName = translationsFlag(cmd, "shortname", spec.ID)
+			spec.Description = translationsFlag(cmd, "description", spec.ID)
+			spec.IssueURL = translationsFlag(cmd, "issue-url", "")
+			spec.Singleton, _ = flags.GetBool("singleton")
+			attrs, _ := flags.GetStringArray("attribute")
+			optional, _ := flags.GetStringArray("optional-attribute")
+			for _, id := range attrs {
+				spec.Attributes = append(spec.Attributes, &attributeSpec{
+					ID: id, Name: parseTranslations([]string{id}), Description: parseTranslations([]string{id}),
+				})
+			}
+			for _, id := range optional {
+				spec.Attributes = append(spec.Attributes, &attributeSpec{
+					ID: id, Name: parseTranslations([]string{id}), Description: parseTranslations([]string{id}), Optional: true,
+				})
+			}
+		}
+
+		if err = writeCredentialType(path, spec); err != nil {
+			die("Failed to add credential type", err)
+		}
+		finishScheme(filepath.Dir(path), skfile)
+	},
+}
+
+func init() {
+	schemeCmd.AddCommand(schemeAddCredentialCmd)
+
+	flags := schemeAddCredentialCmd.Flags()
+	flags.SortFlags = false
+	flags.StringP("spec", "f", "", "YAML or JSON file specifying the credential type")
+	flags.StringP("privatekey", "s", "sk.pem", "ECDSA private key with which to sign the scheme")
+	flags.String("id", "", "identifier of the credential type")
+	flags.StringArray("name", nil, "name of the credential type (default the identifier)")
+	flags.StringArray("shortname", nil, "short name of the credential type (default the identifier)")
+	flags.StringArray("description", nil, "description of the credential type (default the identifier)")
+	flags.StringArray("issue-url", nil, "URL at which the credential type can be obtained")
+	flags.Bool("singleton", false, "whether clients may have at most one instance of the credential type")
+	flags.StringArray("attribute", nil, "identifier of an attribute of the credential type (repeatable)")
+	flags.StringArray("optional-attribute", nil, "identifier of an optional attribute, after the other attributes (repeatable)")
+}
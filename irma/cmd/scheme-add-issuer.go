@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+var schemeAddIssuerCmd = &cobra.Command{
+	Use:   "add-issuer scheme",
+	Short: "Add a new issuer to a scheme",
+	Long: `The add-issuer command adds an issuer to the scheme at the specified path, and generates an issuer
+keypair for it (as in "irma scheme issuer keygen").
+
+The issuer is described either by flags, or by a YAML or JSON specification file (--spec) which may
+also contain the credential types of the issuer (as in "irma scheme add-credential"). Translated
+fields are specified using lang=text values; a value without language is used for all languages.
+
+Afterwards the scheme is signed using the key specified with --privatekey, and the containing
+irma_configuration folder is verified.`,
+	Example: `irma scheme add-issuer --id RU --name "Radboud University" --contact-email info@ru.nl irma-demo
+irma scheme add-issuer --spec ru.yml irma-demo`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		specfile, _ := flags.GetString("spec")
+		skfile, _ := flags.GetString("privatekey")
+
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			die("Invalid path", err)
+		}
+		if err = fs.AssertPathExists(filepath.Join(path, "description.xml")); err != nil {
+			die("", errors.Errorf("%s is not a scheme directory", path))
+		}
+
+		spec := &issuerSpec{}
+		if specfile != "" {
+			if err = readSpec(specfile, spec); err != nil {
+				die("", err)
+			}
+		} else {
+			spec.ID, _ = flags.GetString("id")
+			spec.Name = translationsFlag(cmd, "name", spec.ID)
+			spec.ShortName = translationsFlag(cmd, "shortname", spec.ID)
+			spec.ContactAddress, _ = flags.GetString("contact-address")
+			spec.ContactEMail, _ = flags.GetString("contact-email")
+		}
+
+		if err = writeIssuer(path, spec, issuerKeyFlags(cmd)); err != nil {
+			die("Failed to add issuer", err)
+		}
+		finishScheme(path, skfile)
+	},
+}
+
+func init() {
+	schemeCmd.AddCommand(schemeAddIssuerCmd)
+
+	flags := schemeAddIssuerCmd.Flags()
+	flags.SortFlags = false
+	flags.StringP("spec", "f", "", "YAML or JSON file specifying the issuer and its credential types")
+	flags.StringP("privatekey", "s", "sk.pem", "ECDSA private key with which to sign the scheme")
+	flags.String("id", "", "identifier of the issuer")
+	flags.StringArray("name", nil, "name of the issuer (default the identifier)")
+	flags.StringArray("shortname", nil, "short name of the issuer (default the identifier)")
+	flags.String("contact-address", "", "postal address of the issuer")
+	flags.String("contact-email", "", "email address of the issuer")
+	addIssuerKeyFlags(schemeAddIssuerCmd)
+}
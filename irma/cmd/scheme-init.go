@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+var schemeInitCmd = &cobra.Command{
+	Use:   "init path",
+	Short: "Create a new scheme",
+	Long: `The init command creates a new scheme directory at the specified path, containing a description.xml
+for the scheme. The directory name is the scheme identifier.
+
+The scheme is described either by flags, or by a YAML or JSON specification file (--spec) which may
+also contain the issuers of the scheme (as in "irma scheme add-issuer") and their credential types
+(as in "irma scheme add-credential"). Keys are generated for each issuer. Translated fields are
+specified using lang=text values (e.g. --name en=Demo --name nl=Demo); a value without language is
+used for all languages.
+
+If the private key specified with --privatekey does not exist, a new ECDSA keypair is generated for
+the scheme. The scheme is signed with it and the containing irma_configuration folder is verified.`,
+	Example: `irma scheme init --name "My scheme" --url https://example.com/schemes/my-scheme my-scheme
+irma scheme init --spec my-scheme.yml my-scheme`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		specfile, _ := flags.GetString("spec")
+		skfile, _ := flags.GetString("privatekey")
+
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			die("Invalid path", err)
+		}
+
+		spec := &schemeSpec{}
+		if specfile != "" {
+			if err = readSpec(specfile, spec); err != nil {
+				die("", err)
+			}
+		} else {
+			spec.Name = translationsFlag(cmd, "name", filepath.Base(path))
+			spec.Description = translationsFlag(cmd, "description", filepath.Base(path))
+			spec.URL, _ = flags.GetString("url")
+			spec.Contact, _ = flags.GetString("contact")
+			spec.Demo, _ = flags.GetBool("demo")
+			spec.TimestampServer, _ = flags.GetString("timestamp-server")
+			spec.Mirrors, _ = flags.GetStringArray("mirror")
+		}
+		if spec.ID == "" {
+			spec.ID = filepath.Base(path)
+		}
+
+		if err = writeScheme(path, spec, issuerKeyFlags(cmd)); err != nil {
+			die("Failed to create scheme", err)
+		}
+
+		exists, err := fs.PathExists(skfile)
+		if err != nil {
+			die("Failed to read private key", err)
+		}
+		if !exists {
+			if err = generateSchemeKeypair(skfile, filepath.Join(path, "pk.pem")); err != nil {
+				die("Failed to generate scheme keypair", err)
+			}
+			fmt.Println("Keep the private key secret; it is needed to sign the scheme after each change.")
+		}
+		finishScheme(path, skfile)
+	},
+}
+
+func init() {
+	schemeCmd.AddCommand(schemeInitCmd)
+
+	flags := schemeInitCmd.Flags()
+	flags.SortFlags = false
+	flags.StringP("spec", "f", "", "YAML or JSON file specifying the scheme, its issuers and credential types")
+	flags.StringP("privatekey", "s", "sk.pem", "ECDSA private key with which to sign the scheme (generated if it does not exist)")
+	flags.StringArray("name", nil, "name of the scheme (default the directory name)")
+	flags.StringArray("description", nil, "description of the scheme (default the directory name)")
+	flags.String("url", "", "URL at which the scheme will be hosted")
+	flags.String("contact", "", "contact website of the scheme")
+	flags.Bool("demo", false, "mark the scheme as a demo scheme, whose issuer private keys are public")
+	flags.String("timestamp-server", "", "URL of the timestamp server used in attribute-based signatures")
+	flags.StringArray("mirror", nil, "URL of a mirror of the scheme (may be repeated)")
+	addIssuerKeyFlags(schemeInitCmd)
+}
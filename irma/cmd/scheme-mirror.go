@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+var schemeMirrorCmd = &cobra.Command{
+	Use:   "mirror path output",
+	Short: "Create a static mirror of an installed scheme",
+	Long: `The mirror command writes the files of the scheme at the specified path to the output directory,
+which can then be hosted by any static web server as a mirror of the scheme. Only the files listed
+in the signed index of the scheme are included (along with the index, its signature, the public key
+of the scheme, and its key rotations if any), after verifying them against the index. For demo
+schemes the private keys are included as well.
+
+IRMA apps and servers use mirrors when the scheme URL is unavailable. Mirrors are either declared
+in the Mirrors element of the scheme description, or configured locally. As all files downloaded
+from mirrors are verified against the signed index, mirrors need not be trusted.`,
+	Example: `irma scheme mirror irma_configuration/irma-demo /var/www/mirror/irma-demo`,
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		count, err := mirrorScheme(args[0], args[1], overwrite)
+		if err != nil {
+			die("Failed to mirror scheme", err)
+		}
+		fmt.Printf("Wrote %d files to %s\n", count, args[1])
+	},
+}
+
+// mirrorScheme writes the files of the scheme at path to the output directory, returning the
+// amount of files written.
+func mirrorScheme(path, output string, overwrite bool) (int, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return 0, err
+	}
+
+	// Parse and verify the scheme
+	conf, err := irma.NewConfigurationReadOnly(filepath.Dir(path))
+	if err != nil {
+		return 0, err
+	}
+	scheme := irma.NewSchemeManager(filepath.Base(path))
+	if err = conf.ParseSchemeManagerFolder(path, scheme); err != nil {
+		return 0, err
+	}
+	indexbts, err := ioutil.ReadFile(filepath.Join(path, "index"))
+	if err != nil {
+		return 0, err
+	}
+	index := irma.SchemeManagerIndex{}
+	if err = index.FromString(string(indexbts)); err != nil {
+		return 0, err
+	}
+
+	if err = prepareMirrorDir(output, overwrite); err != nil {
+		return 0, err
+	}
+
+	// Write the files in the index, in the layout of the scheme URL
+	files := make([]string, 0, len(index))
+	for file := range index {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	prefix := scheme.ID + "/"
+	for _, file := range files {
+		if !strings.HasPrefix(file, prefix) {
+			return 0, errors.Errorf("Index contains file %s outside of the scheme", file)
+		}
+		bts, found, err := conf.ReadAuthenticatedFile(scheme, filepath.FromSlash(file))
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, errors.Errorf("File %s not found in index", file)
+		}
+		if err = writeMirrorFile(output, file[len(prefix):], bts); err != nil {
+			return 0, err
+		}
+	}
+	count := len(files)
+
+	// Write the files that are needed to verify the index, or that are not signed
+	extra := []string{"index", "index.sig", "pk.pem", irma.SchemeKeyRotationsFile}
+	if scheme.Demo {
+		extra = append(extra, "sk.pem")
+		privkeys, err := filepath.Glob(filepath.Join(path, "*", "PrivateKeys", "*.xml"))
+		if err != nil {
+			return 0, err
+		}
+		for _, privkey := range privkeys {
+			rel, err := filepath.Rel(path, privkey)
+			if err != nil {
+				return 0, err
+			}
+			extra = append(extra, filepath.ToSlash(rel))
+		}
+	}
+	for _, file := range extra {
+		bts, err := ioutil.ReadFile(filepath.Join(path, filepath.FromSlash(file)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err = writeMirrorFile(output, file, bts); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// prepareMirrorDir ensures that the output directory exists and is empty, emptying it only if
+// overwrite is set.
+func prepareMirrorDir(output string, overwrite bool) error {
+	exists, err := fs.PathExists(output)
+	if err != nil {
+		return err
+	}
+	if exists {
+		infos, err := ioutil.ReadDir(output)
+		if err != nil {
+			return err
+		}
+		if len(infos) > 0 && !overwrite {
+			return errors.Errorf("Output directory %s is not empty (use --overwrite to replace its contents)", output)
+		}
+		for _, info := range infos {
+			if err = os.RemoveAll(filepath.Join(output, info.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return fs.EnsureDirectoryExists(output)
+}
+
+func writeMirrorFile(output, file string, bts []byte) error {
+	dest := filepath.Join(output, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, bts, 0644)
+}
+
+func init() {
+	schemeCmd.AddCommand(schemeMirrorCmd)
+
+	schemeMirrorCmd.Flags().Bool("overwrite", false, "replace the contents of the output directory if it is not empty")
+}
@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/privacybydesign/irmago/server"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/x-cray/logrus-prefixed-formatter"
+)
+
+var schemeServeCmd = &cobra.Command{
+	Use:   "serve path...",
+	Short: "Serve scheme directories over HTTP",
+	Long: `The serve command hosts the specified scheme directories over HTTP, in the layout expected by IRMA
+apps and servers when installing and updating schemes: each scheme is served at /<scheme-id>/.
+A path may also be an irma_configuration folder, in which case all schemes in it are served.
+
+With --privatekey, the index, index.sig, timestamp and pk.pem files are not read from disk but
+generated on the fly: the index is computed over the current contents of the scheme and signed
+with the specified key, and the timestamp is updated when files of the scheme are modified. This
+allows testing scheme updates without resigning the scheme after each change. Note that clients
+only accept the signatures if they trust the specified key (e.g. by installing the scheme from
+this server).
+
+The following flags simulate failures, for testing how clients deal with them:
+  --delay             delay each response by the specified duration
+  --corrupt-index     serve an index in which the hash of the scheme's description.xml is wrong;
+                      with --privatekey, the corrupted index is correctly signed
+  --bad-signature     serve an index.sig created with a random key
+
+Private keys of issuers are only served for demo schemes.`,
+	Example: `irma scheme serve irma-demo
+irma scheme serve --privatekey sk.pem --delay 5s irma_configuration`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		port, _ := flags.GetInt("port")
+		addr, _ := flags.GetString("listen-addr")
+		skfile, _ := flags.GetString("privatekey")
+		verbosity, _ := flags.GetCount("verbose")
+		logger = logrus.New()
+		logger.Level = server.Verbosity(verbosity)
+		logger.Formatter = &prefixed.TextFormatter{FullTimestamp: true}
+
+		s := &schemeServer{schemes: map[string]*servedScheme{}, snapshots: map[string]*schemeSnapshot{}}
+		s.delay, _ = flags.GetDuration("delay")
+		s.corruptIndex, _ = flags.GetBool("corrupt-index")
+		s.badSignature, _ = flags.GetBool("bad-signature")
+
+		var err error
+		if skfile != "" {
+			if s.sk, err = readPrivateKey(skfile); err != nil {
+				die("Failed to read private key", err)
+			}
+		}
+		for _, arg := range args {
+			if err = s.add(arg); err != nil {
+				die("Failed to add "+arg, err)
+			}
+		}
+
+		for id, scheme := range s.schemes {
+			logger.Infof("Serving scheme %s from %s at /%s/", id, scheme.dir, id)
+		}
+		fullAddr := fmt.Sprintf("%s:%d", addr, port)
+		logger.Info("Listening at ", fullAddr)
+		if err = http.ListenAndServe(fullAddr, s); err != nil {
+			die("Failed to serve schemes", err)
+		}
+	},
+}
+
+type schemeServer struct {
+	schemes map[string]*servedScheme
+	sk      *ecdsa.PrivateKey
+
+	delay        time.Duration
+	corruptIndex bool
+	badSignature bool
+
+	sync.Mutex
+	snapshots map[string]*schemeSnapshot
+}
+
+type servedScheme struct {
+	dir  string
+	demo bool
+}
+
+// schemeSnapshot contains the generated index, signature and timestamp of a scheme, when
+// re-signing the scheme on the fly.
+type schemeSnapshot struct {
+	timestamp int64
+	files     map[string][]byte
+}
+
+// The files of a scheme that are generated when resigning on the fly.
+var signatureFiles = map[string]struct{}{"index": {}, "index.sig": {}, "timestamp": {}, "pk.pem": {}}
+
+// add adds the scheme at the specified path, or the schemes in it if it is not a scheme.
+func (s *schemeServer) add(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	isScheme, err := fs.PathExists(filepath.Join(dir, "description.xml"))
+	if err != nil {
+		return err
+	}
+	if !isScheme {
+		subdirs, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, subdir := range subdirs {
+			exists, err := fs.PathExists(filepath.Join(dir, subdir.Name(), "description.xml"))
+			if err != nil {
+				return err
+			}
+			if subdir.IsDir() && exists {
+				if err = s.add(filepath.Join(dir, subdir.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	bts, err := ioutil.ReadFile(filepath.Join(dir, "description.xml"))
+	if err != nil {
+		return err
+	}
+	manager := &irma.SchemeManager{}
+	if err = xml.Unmarshal(bts, manager); err != nil {
+		return errors.WrapPrefix(err, "Failed to parse scheme description", 0)
+	}
+	if manager.ID != filepath.Base(dir) {
+		return errors.Errorf("Scheme %s has wrong directory name %s", manager.ID, filepath.Base(dir))
+	}
+	if _, exists := s.schemes[manager.ID]; exists {
+		return errors.Errorf("Scheme %s specified twice", manager.ID)
+	}
+	s.schemes[manager.ID] = &servedScheme{dir: dir, demo: manager.Demo}
+	return nil
+}
+
+func (s *schemeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+	logger.WithFields(logrus.Fields{"method": r.Method, "path": r.URL.Path}).Debug("Request received")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean(r.URL.Path), "/"), "/", 2)
+	scheme, ok := s.schemes[parts[0]]
+	if !ok || len(parts) != 2 || !s.allowed(scheme, parts[1]) {
+		http.NotFound(w, r)
+		return
+	}
+	file := parts[1]
+
+	var content []byte
+	var err error
+	if _, ok := signatureFiles[file]; ok {
+		content, err = s.signatureFile(parts[0], scheme, file)
+	} else {
+		content, err = ioutil.ReadFile(filepath.Join(scheme.dir, filepath.FromSlash(file)))
+	}
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to read ", r.URL.Path, ": ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", schemeFileContentType(file))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(content)
+	}
+}
+
+// allowed returns whether the specified file of the scheme may be served.
+func (s *schemeServer) allowed(scheme *servedScheme, file string) bool {
+	if file == "sk.pem" || strings.HasPrefix(file, "../") {
+		return false
+	}
+	if strings.Contains(file, "/PrivateKeys/") && !scheme.demo {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(scheme.dir, filepath.FromSlash(file)))
+	return err != nil || !info.IsDir() // nonexisting files are handled by the caller
+}
+
+// signatureFile returns the specified file out of index, index.sig, timestamp and pk.pem,
+// with the failure modes applied.
+func (s *schemeServer) signatureFile(id string, scheme *servedScheme, file string) ([]byte, error) {
+	files := map[string][]byte{}
+	if s.sk != nil {
+		snapshot, err := s.snapshot(id, scheme)
+		if err != nil {
+			return nil, err
+		}
+		for name, bts := range snapshot.files {
+			files[name] = bts
+		}
+	} else {
+		for name := range signatureFiles {
+			bts, err := ioutil.ReadFile(filepath.Join(scheme.dir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			files[name] = bts
+		}
+	}
+
+	if s.corruptIndex && (file == "index" || file == "index.sig") {
+		index := irma.SchemeManagerIndex(make(map[string]irma.ConfigurationFileHash))
+		if err := index.FromString(string(files["index"])); err != nil {
+			return nil, err
+		}
+		index[id+"/description.xml"] = make([]byte, sha256.Size)
+		files["index"] = []byte(index.String())
+		if s.sk != nil {
+			var err error
+			if files["index"], files["index.sig"], err = signIndex(s.sk, index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.badSignature && file == "index.sig" {
+		sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if _, files["index.sig"], err = signIndex(sk, irma.SchemeManagerIndex{}); err != nil {
+			return nil, err
+		}
+	}
+
+	if files[file] == nil {
+		return nil, os.ErrNotExist
+	}
+	return files[file], nil
+}
+
+// snapshot returns the index, signature and timestamp of the current contents of the scheme,
+// signed with our key. A new snapshot, with a newer timestamp, is made when the scheme changes.
+func (s *schemeServer) snapshot(id string, scheme *servedScheme) (*schemeSnapshot, error) {
+	// Take as timestamp the newest of the timestamp file and the modification times of the files
+	var timestamp int64
+	if bts, err := ioutil.ReadFile(filepath.Join(scheme.dir, "timestamp")); err == nil {
+		timestamp, _ = strconv.ParseInt(string(bytes.TrimSpace(bts)), 10, 64)
+	}
+	err := filepath.Walk(scheme.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if _, ok := signatureFiles[filepath.Base(p)]; ok || info.IsDir() {
+			return nil
+		}
+		if t := info.ModTime().Unix(); t > timestamp {
+			timestamp = t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if snapshot := s.snapshots[id]; snapshot != nil && snapshot.timestamp == timestamp {
+		return snapshot, nil
+	}
+
+	index, err := buildIndex(scheme.dir)
+	if err != nil {
+		return nil, err
+	}
+	tsbts := []byte(strconv.FormatInt(timestamp, 10) + "\n")
+	hash := sha256.Sum256(tsbts)
+	index[id+"/timestamp"] = hash[:]
+	indexbts, sig, err := signIndex(s.sk, index)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := pemPublicKey(s.sk)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &schemeSnapshot{
+		timestamp: timestamp,
+		files:     map[string][]byte{"index": indexbts, "index.sig": sig, "timestamp": tsbts, "pk.pem": pk},
+	}
+	s.snapshots[id] = snapshot
+	logger.Infof("Signed scheme %s with timestamp %d", id, timestamp)
+	return snapshot, nil
+}
+
+func schemeFileContentType(file string) string {
+	switch path.Base(file) {
+	case "index", "timestamp":
+		return "text/plain; charset=utf-8"
+	case "index.sig":
+		return "application/octet-stream"
+	}
+	switch path.Ext(file) {
+	case ".xml":
+		return "application/xml; charset=utf-8"
+	case ".png":
+		return "image/png"
+	case ".pem":
+		return "application/x-pem-file"
+	case ".json":
+		return "application/json"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func init() {
+	schemeCmd.AddCommand(schemeServeCmd)
+
+	flags := schemeServeCmd.Flags()
+	flags.SortFlags = false
+	flags.IntP("port", "p", 48681, "port to listen at")
+	flags.StringP("listen-addr", "l", "", "address to listen at")
+	flags.StringP("privatekey", "s", "", "ECDSA private key with which to sign the schemes on the fly")
+	flags.Duration("delay", 0, "delay each response by the specified duration")
+	flags.Bool("corrupt-index", false, "serve corrupted indices")
+	flags.Bool("bad-signature", false, "serve index signatures made with a random key")
+	flags.CountP("verbose", "v", "verbose (repeatable)")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/internal/test"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func startSchemeServer(t *testing.T, sk *ecdsa.PrivateKey) (*httptest.Server, string) {
+	logger = logrus.New()
+	logger.Level = logrus.ErrorLevel
+
+	confpath := filepath.Join(test.FindTestdataFolder(t), "irma_configuration")
+	s := &schemeServer{schemes: map[string]*servedScheme{}, snapshots: map[string]*schemeSnapshot{}, sk: sk}
+	require.NoError(t, s.add(confpath))
+	return httptest.NewServer(s), confpath
+}
+
+func getSchemeFile(t *testing.T, url string) (int, []byte) {
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	bts, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res.StatusCode, bts
+}
+
+func TestSchemeServeFiles(t *testing.T) {
+	httpServer, confpath := startSchemeServer(t, nil)
+	defer httpServer.Close()
+
+	for _, file := range []string{"description.xml", "index", "index.sig", "pk.pem", "RU/PublicKeys/2.xml"} {
+		expected, err := ioutil.ReadFile(filepath.Join(confpath, "irma-demo", filepath.FromSlash(file)))
+		require.NoError(t, err)
+		status, bts := getSchemeFile(t, httpServer.URL+"/irma-demo/"+file)
+		require.Equal(t, http.StatusOK, status, file)
+		require.Equal(t, expected, bts, file)
+	}
+
+	// Private keys are not served, as this scheme is not marked as a demo scheme
+	for _, file := range []string{
+		"/irma-demo/sk.pem",
+		"/irma-demo/RU/PrivateKeys/2.xml",
+		"/irma-demo/nonexisting.xml",
+		"/irma-demo/RU",
+		"/nonexisting/description.xml",
+	} {
+		status, _ := getSchemeFile(t, httpServer.URL+file)
+		require.Equal(t, http.StatusNotFound, status, file)
+	}
+}
+
+func TestSchemeServeInstallSigned(t *testing.T) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	httpServer, _ := startSchemeServer(t, sk)
+	defer httpServer.Close()
+
+	// The scheme, signed on the fly with our key, can be installed by trusting that key
+	pk, err := pemPublicKey(sk)
+	require.NoError(t, err)
+	status, bts := getSchemeFile(t, httpServer.URL+"/irma-demo/pk.pem")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, pk, bts)
+
+	dir, err := ioutil.TempDir("", "irma_configuration")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf, err := irma.NewConfiguration(dir)
+	require.NoError(t, err)
+	scheme, err := irma.DownloadSchemeManager(httpServer.URL + "/irma-demo")
+	require.NoError(t, err)
+	require.NoError(t, conf.InstallSchemeManager(scheme, pk))
+	require.NotNil(t, conf.CredentialType(irma.NewCredentialTypeIdentifier("irma-demo.RU.studentCard")))
+}
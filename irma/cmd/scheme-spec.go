@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// This file contains the specifications of schemes, issuers and credential types from which the
+// "irma scheme init", "add-issuer" and "add-credential" commands write the description.xml files,
+// in the layout expected by irma.Configuration.ParseSchemeManagerFolder().
+
+// The languages in which descriptions are written when a flag specifies no language.
+var specLanguages = []string{"en", "nl"}
+
+type schemeSpec struct {
+	ID                string                `json:"id" yaml:"id"`
+	Name              irma.TranslatedString `json:"name" yaml:"name"`
+	Description       irma.TranslatedString `json:"description" yaml:"description"`
+	URL               string                `json:"url" yaml:"url"`
+	Contact           string                `json:"contact" yaml:"contact"`
+	Demo              bool                  `json:"demo" yaml:"demo"`
+	KeyshareServer    string                `json:"keyshareServer" yaml:"keyshareServer"`
+	KeyshareWebsite   string                `json:"keyshareWebsite" yaml:"keyshareWebsite"`
+	KeyshareAttribute string                `json:"keyshareAttribute" yaml:"keyshareAttribute"`
+	TimestampServer   string                `json:"timestampServer" yaml:"timestampServer"`
+	Mirrors           []string              `json:"mirrors" yaml:"mirrors"`
+	Issuers           []*issuerSpec         `json:"issuers" yaml:"issuers"`
+}
+
+type issuerSpec struct {
+	ID             string                `json:"id" yaml:"id"`
+	Name           irma.TranslatedString `json:"name" yaml:"name"`
+	ShortName      irma.TranslatedString `json:"shortName" yaml:"shortName"`
+	ContactAddress string                `json:"contactAddress" yaml:"contactAddress"`
+	ContactEMail   string                `json:"contactEmail" yaml:"contactEmail"`
+	Credentials    []*credentialSpec     `json:"credentials" yaml:"credentials"`
+}
+
+type credentialSpec struct {
+	ID          string                `json:"id" yaml:"id"`
+	Name        irma.TranslatedString `json:"name" yaml:"name"`
+	ShortName   irma.TranslatedString `json:"shortName" yaml:"shortName"`
+	Description irma.TranslatedString `json:"description" yaml:"description"`
+	IssueURL    irma.TranslatedString `json:"issueUrl" yaml:"issueUrl"`
+	Singleton   bool                  `json:"singleton" yaml:"singleton"`
+	Foreground  string                `json:"foregroundColor" yaml:"foregroundColor"`
+	Background  string                `json:"backgroundColor" yaml:"backgroundColor"`
+	Category    string                `json:"category" yaml:"category"`
+	Attributes  []*attributeSpec      `json:"attributes" yaml:"attributes"`
+}
+
+type attributeSpec struct {
+	ID          string                           `json:"id" yaml:"id"`
+	Name        irma.TranslatedString            `json:"name" yaml:"name"`
+	Description irma.TranslatedString            `json:"description" yaml:"description"`
+	Optional    bool                             `json:"optional" yaml:"optional"`
+	Hidden      bool                             `json:"hidden" yaml:"hidden"`
+	Secret      bool                             `json:"secret" yaml:"secret"`
+	Values      map[string]irma.TranslatedString `json:"values" yaml:"values"`
+}
+
+// issuerKeySpec contains the parameters of the issuer keypairs generated for new issuers.
+type issuerKeySpec struct {
+	keylength     int
+	numAttributes int
+	validFor      string
+}
+
+var specIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func validateSpecID(kind, id string) error {
+	if !specIDRegexp.MatchString(id) {
+		return errors.Errorf("Invalid %s identifier \"%s\": must be nonempty and consist of letters, digits, - and _", kind, id)
+	}
+	return nil
+}
+
+// readSpec parses the specified JSON or YAML file into spec.
+func readSpec(path string, spec interface{}) error {
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WrapPrefix(err, "Failed to read specification", 0)
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(bts, spec)
+	} else {
+		err = yaml.Unmarshal(bts, spec)
+	}
+	if err != nil {
+		return errors.WrapPrefix(err, "Failed to parse specification", 0)
+	}
+	return nil
+}
+
+// parseTranslations parses flag values of the form "en=Hello" into a TranslatedString. A value
+// without language is used for all languages in specLanguages.
+func parseTranslations(values []string) irma.TranslatedString {
+	ts := irma.TranslatedString{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) == 2 && regexp.MustCompile(`^[a-z]{2}$`).MatchString(parts[0]) {
+			ts[parts[0]] = parts[1]
+			continue
+		}
+		for _, lang := range specLanguages {
+			ts[lang] = value
+		}
+	}
+	return ts
+}
+
+// translationsFlag returns the translations specified in the given flag, or if the flag was not
+// specified, the given default for all languages in specLanguages.
+func translationsFlag(cmd *cobra.Command, name, def string) irma.TranslatedString {
+	values, _ := cmd.Flags().GetStringArray(name)
+	if len(values) == 0 {
+		values = []string{def}
+	}
+	return parseTranslations(values)
+}
+
+func writeDescription(path string, description interface{}) error {
+	bts, err := xml.MarshalIndent(description, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(bts, '\n'), 0644)
+}
+
+func writeScheme(path string, spec *schemeSpec, keys *issuerKeySpec) error {
+	if err := validateSpecID("scheme", spec.ID); err != nil {
+		return err
+	}
+	if filepath.Base(path) != spec.ID {
+		return errors.Errorf("Scheme directory name %s does not match scheme identifier %s", filepath.Base(path), spec.ID)
+	}
+	if err := fs.EnsureDirectoryExists(path); err != nil {
+		return err
+	}
+	descpath := filepath.Join(path, "description.xml")
+	if err := fs.AssertPathNotExists(descpath); err != nil {
+		return errors.Errorf("Scheme description %s already exists", descpath)
+	}
+
+	err := writeDescription(descpath, &irma.SchemeManager{
+		ID:                spec.ID,
+		Name:              spec.Name,
+		URL:               spec.URL,
+		Contact:           spec.Contact,
+		Demo:              spec.Demo,
+		Description:       spec.Description,
+		KeyshareServer:    spec.KeyshareServer,
+		KeyshareWebsite:   spec.KeyshareWebsite,
+		KeyshareAttribute: spec.KeyshareAttribute,
+		TimestampServer:   spec.TimestampServer,
+		Mirrors:           spec.Mirrors,
+		XMLVersion:        7,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Scheme written at", path)
+
+	for _, issuer := range spec.Issuers {
+		if err = writeIssuer(path, issuer, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeIssuer(schemepath string, spec *issuerSpec, keys *issuerKeySpec) error {
+	if err := validateSpecID("issuer", spec.ID); err != nil {
+		return err
+	}
+	path := filepath.Join(schemepath, spec.ID)
+	if err := fs.AssertPathNotExists(path); err != nil {
+		return errors.Errorf("Issuer directory %s already exists", path)
+	}
+	if err := fs.EnsureDirectoryExists(path); err != nil {
+		return err
+	}
+
+	err := writeDescription(filepath.Join(path, "description.xml"), &irma.Issuer{
+		ID:              spec.ID,
+		Name:            spec.Name,
+		ShortName:       spec.ShortName,
+		SchemeManagerID: filepath.Base(schemepath),
+		ContactAddress:  spec.ContactAddress,
+		ContactEMail:    spec.ContactEMail,
+		XMLVersion:      4,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Issuer written at", path)
+
+	expiryDate, err := parseExpiryDate("", keys.validFor)
+	if err != nil {
+		return err
+	}
+	if err = generateIssuerKeys(path, keys.keylength, 0, keys.numAttributes, expiryDate, "", "", false); err != nil {
+		return err
+	}
+
+	for _, cred := range spec.Credentials {
+		if err = writeCredentialType(path, cred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCredentialType(issuerpath string, spec *credentialSpec) error {
+	if err := validateSpecID("credential type", spec.ID); err != nil {
+		return err
+	}
+	if len(spec.Attributes) == 0 {
+		return errors.Errorf("Credential type %s has no attributes", spec.ID)
+	}
+	path := filepath.Join(issuerpath, "Issues", spec.ID)
+	if err := fs.AssertPathNotExists(path); err != nil {
+		return errors.Errorf("Credential type directory %s already exists", path)
+	}
+	if err := fs.EnsureDirectoryExists(path); err != nil {
+		return err
+	}
+
+	cred := &irma.CredentialType{
+		ID:              spec.ID,
+		Name:            spec.Name,
+		ShortName:       spec.ShortName,
+		IssuerID:        filepath.Base(issuerpath),
+		SchemeManagerID: filepath.Base(filepath.Dir(issuerpath)),
+		IsSingleton:     spec.Singleton,
+		Description:     spec.Description,
+		IssueURL:        spec.IssueURL,
+		ForegroundColor: spec.Foreground,
+		BackgroundColor: spec.Background,
+		Category:        spec.Category,
+		XMLVersion:      4,
+	}
+	ids := map[string]struct{}{}
+	for _, attr := range spec.Attributes {
+		if err := validateSpecID("attribute", attr.ID); err != nil {
+			return err
+		}
+		if _, exists := ids[attr.ID]; exists {
+			return errors.Errorf("Credential type %s contains attribute %s twice", spec.ID, attr.ID)
+		}
+		ids[attr.ID] = struct{}{}
+		attrtype := &irma.AttributeType{
+			ID:          attr.ID,
+			Name:        attr.Name,
+			Description: attr.Description,
+			Values:      attr.Values,
+		}
+		if attr.Optional {
+			attrtype.Optional = "true"
+		}
+		if attr.Hidden {
+			attrtype.Hidden = "true"
+		}
+		if attr.Secret {
+			attrtype.Secret = "true"
+		}
+		cred.AttributeTypes = append(cred.AttributeTypes, attrtype)
+	}
+
+	if err := writeDescription(filepath.Join(path, "description.xml"), cred); err != nil {
+		return err
+	}
+	fmt.Println("Credential type written at", path)
+	return nil
+}
+
+// finishScheme signs the scheme with the specified key, and verifies the irma_configuration
+// folder containing it.
+func finishScheme(schemepath, skfile string) {
+	sk, err := readPrivateKey(skfile)
+	if err != nil {
+		die("Failed to read private key", err)
+	}
+	if err = signManager(sk, schemepath, true); err != nil {
+		die("Failed to sign scheme", err)
+	}
+	if err = VerifyIrmaConfiguration(filepath.Dir(schemepath)); err != nil {
+		die("Scheme was written but verification failed", err)
+	}
+	fmt.Println()
+	fmt.Println("Scheme was signed and verified successfully.")
+}
+
+func addIssuerKeyFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.IntP("keylength", "l", 2048, "key length of generated issuer keys")
+	flags.IntP("numattributes", "a", 12, "number of attributes of generated issuer keys")
+	flags.StringP("valid-for", "v", "1y", "validity period of generated issuer keys, as in \"irma scheme issuer keygen\"")
+}
+
+func issuerKeyFlags(cmd *cobra.Command) *issuerKeySpec {
+	flags := cmd.Flags()
+	keylength, _ := flags.GetInt("keylength")
+	numAttributes, _ := flags.GetInt("numattributes")
+	validFor, _ := flags.GetString("valid-for")
+	return &issuerKeySpec{keylength: keylength, numAttributes: numAttributes, validFor: validFor}
+}
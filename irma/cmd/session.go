@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -36,9 +38,14 @@ with --server), an IRMA session is started; the QR is printed in the terminal; a
 result is printed when the session completes or fails.
 
 A session request can either be constructed using the --disclose, --issue, and --sign together
-with --message flags, or it can be specified as JSON to the --request flag.`,
+with --message flags, or it can be specified as JSON to the --request flag.
+
+When --sign-file is used instead of --message, the digest of the specified file is signed, and
+afterwards a detached file signature is written to the path specified by --signature-output
+(by default the path of the signed file with ".irmasig" appended).`,
 	Example: `irma session --disclose irma-demo.MijnOverheid.root.BSN
 irma session --sign irma-demo.MijnOverheid.root.BSN --message message
+irma session --sign irma-demo.MijnOverheid.root.BSN --sign-file contract.pdf --media-type application/pdf
 irma session --issue irma-demo.MijnOverheid.ageLower=yes,yes,yes,no --disclose irma-demo.MijnOverheid.root.BSN
 irma session --request '{"type":"disclosing","content":[{"label":"BSN","attributes":["irma-demo.MijnOverheid.root.BSN"]}]}'
 irma session --server http://localhost:8088 --authmethod token --key mytoken --disclose irma-demo.MijnOverheid.root.BSN`,
@@ -78,6 +85,13 @@ irma session --server http://localhost:8088 --authmethod token --key mytoken --d
 
 		printSessionResult(result)
 
+		if signfile, _ := flags.GetString("sign-file"); signfile != "" {
+			output, _ := flags.GetString("signature-output")
+			if err = writeFileSignature(cmd, signfile, output, result); err != nil {
+				die("Failed to write file signature", err)
+			}
+		}
+
 		// Done!
 		if httpServer != nil {
 			_ = httpServer.Close()
@@ -190,6 +204,34 @@ func postRequest(serverurl string, request irma.RequestorRequest, name, authmeth
 	return pkg.SessionPtr, transport, err
 }
 
+// writeFileSignature packages the signature from the session result along with the metadata
+// of the signed file into a file signature container, and writes it to disk.
+func writeFileSignature(cmd *cobra.Command, path, output string, result *server.SessionResult) error {
+	if result.Status != server.StatusDone || result.Signature == nil {
+		return errors.New("session did not result in a signature")
+	}
+	document, err := fileMetadata(cmd, path)
+	if err != nil {
+		return err
+	}
+	signedFile, err := irma.NewSignedFile(document, result.Signature)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = path + ".irmasig"
+	}
+	bts, err := json.MarshalIndent(signedFile, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(output, bts, 0644); err != nil {
+		return err
+	}
+	fmt.Println("File signature written to", output)
+	return nil
+}
+
 // Configuration functions
 
 func configureServer(url string, port int, privatekeysPath string, irmaconfig *irma.Configuration, verbosity int) error {
@@ -242,6 +284,7 @@ func init() {
 	flags.Bool("noqr", false, "Print JSON instead of draw QR")
 	flags.StringP("request", "r", "", "JSON session request")
 	flags.StringP("privkeys", "k", "", "path to private keys")
+	flags.String("signature-output", "", "path to write file signature to (when using --sign-file)")
 
 	addRequestFlags(flags)
 
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
@@ -28,6 +31,8 @@ var signCmd = &cobra.Command{
 	Short: "Sign a scheme directory",
 	Long: `Sign a scheme manager directory, using the specified ECDSA key. Both arguments are optional; "sk.pem" and the working directory are the defaults. Outputs an index file, signature over the index file, and the public key in the specified directory.
 
+To rotate the signing key of the scheme, specify the new ECDSA key with --rotate. A key rotation statement in which the current key designates the new key is then appended to the keyrotations.json file of the scheme, after which the scheme is signed with the new key. IRMA apps that trust the current key then accept the new key by following the statements. The new key may be restricted to a validity period using --valid-from and --valid-until (formatted as 2006-01-02); if the new key is not yet valid, the scheme is signed with the current key.
+
 Careful: this command could fail and invalidate or destroy your scheme manager directory! Use this only if you can restore it from git or backups.`,
 	Args: cobra.MaximumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -62,6 +67,13 @@ Careful: this command could fail and invalidate or destroy your scheme manager d
 		if err != nil {
 			return err
 		}
+
+		rotate, _ := cmd.Flags().GetString("rotate")
+		if rotate != "" {
+			if privatekey, err = rotateKey(cmd, privatekey, rotate, confpath); err != nil {
+				die("Failed to rotate scheme key", err)
+			}
+		}
 		if err := signManager(privatekey, confpath, skipverification); err != nil {
 			die("Failed to sign scheme", err)
 		}
@@ -73,6 +85,104 @@ func init() {
 	schemeCmd.AddCommand(signCmd)
 
 	signCmd.Flags().BoolP("noverification", "n", false, "Skip verification of the scheme after signing it")
+	signCmd.Flags().String("rotate", "", "path to new ECDSA private key to which the signing key of the scheme is rotated")
+	signCmd.Flags().String("valid-from", "", "date from which the new key is valid (only with --rotate)")
+	signCmd.Flags().String("valid-until", "", "date until which the new key is valid (only with --rotate)")
+}
+
+// rotateKey appends a statement to the key rotations of the scheme in which the current key
+// designates the key at the specified path, and returns the key with which to sign the scheme.
+func rotateKey(cmd *cobra.Command, current *ecdsa.PrivateKey, path, confpath string) (*ecdsa.PrivateKey, error) {
+	next, err := readPrivateKey(path)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to read new private key", 0)
+	}
+	validFrom, err := parseDateFlag(cmd, "valid-from")
+	if err != nil {
+		return nil, err
+	}
+	validUntil, err := parseDateFlag(cmd, "valid-until")
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the existing key rotations, and check that we are rotating away from the current key
+	var chain irma.SchemeKeyRotations
+	chainpath := filepath.Join(confpath, irma.SchemeKeyRotationsFile)
+	bts, err := ioutil.ReadFile(chainpath)
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(bts, &chain); err != nil {
+			return nil, errors.WrapPrefix(err, "Failed to parse key rotations", 0)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	var latest *ecdsa.PublicKey
+	if len(chain) > 0 {
+		latest, err = chain[len(chain)-1].Key()
+	} else if bts, err = ioutil.ReadFile(filepath.Join(confpath, "pk.pem")); err == nil {
+		latest, err = irma.ParsePemEcdsaPublicKey(bts)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		same, err := samePublicKey(latest, &current.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			return nil, errors.New("Private key is not the current signing key of the scheme")
+		}
+	}
+
+	// Create and write the new key rotation statement
+	scheme := irma.NewSchemeManagerIdentifier(filepath.Base(confpath))
+	rotation, err := irma.NewSchemeKeyRotation(scheme, current, &next.PublicKey, validFrom, validUntil)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, rotation)
+	if bts, err = json.MarshalIndent(chain, "", "  "); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(chainpath, bts, 0644); err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to write key rotations", 0)
+	}
+
+	if validFrom != nil && time.Time(*validFrom).After(time.Now()) {
+		fmt.Println("New key is not yet valid; signing scheme with current key")
+		return current, nil
+	}
+	return next, nil
+}
+
+func parseDateFlag(cmd *cobra.Command, name string) (*irma.Timestamp, error) {
+	str, _ := cmd.Flags().GetString(name)
+	if str == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", str)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to parse --"+name, 0)
+	}
+	ts := irma.Timestamp(t)
+	return &ts, nil
+}
+
+func samePublicKey(pk1, pk2 *ecdsa.PublicKey) (bool, error) {
+	bts1, err := x509.MarshalPKIXPublicKey(pk1)
+	if err != nil {
+		return false, err
+	}
+	bts2, err := x509.MarshalPKIXPublicKey(pk2)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(bts1, bts2), nil
 }
 
 func signManager(privatekey *ecdsa.PrivateKey, confpath string, skipverification bool) error {
@@ -82,41 +192,29 @@ func signManager(privatekey *ecdsa.PrivateKey, confpath string, skipverification
 		return errors.WrapPrefix(err, "Failed to write timestamp", 0)
 	}
 
-	// Traverse dir and add file hashes to index
-	var index irma.SchemeManagerIndex = make(map[string]irma.ConfigurationFileHash)
-	err := filepath.Walk(confpath, func(path string, info os.FileInfo, err error) error {
-		return calculateFileHash(path, info, err, confpath, index)
-	})
+	// Traverse dir and add file hashes to index, and sign it
+	index, err := buildIndex(confpath)
 	if err != nil {
-		return errors.WrapPrefix(err, "Failed to calculate file index:", 0)
+		return err
+	}
+	bts, sigbytes, err := signIndex(privatekey, index)
+	if err != nil {
+		return err
 	}
 
-	// Write index
-	bts = []byte(index.String())
+	// Write index and signature
 	if err := ioutil.WriteFile(filepath.Join(confpath, "index"), bts, 0644); err != nil {
 		return errors.WrapPrefix(err, "Failed to write index", 0)
 	}
-
-	// Create and write signature
-	indexHash := sha256.Sum256(bts)
-	r, s, err := ecdsa.Sign(rand.Reader, privatekey, indexHash[:])
-	if err != nil {
-		return errors.WrapPrefix(err, "Failed to sign index:", 0)
-	}
-	sigbytes, err := asn1.Marshal([]*big.Int{r, s})
-	if err != nil {
-		return errors.WrapPrefix(err, "Failed to serialize signature:", 0)
-	}
 	if err = ioutil.WriteFile(filepath.Join(confpath, "index.sig"), sigbytes, 0644); err != nil {
 		return errors.WrapPrefix(err, "Failed to write index.sig", 0)
 	}
 
 	// Write public key
-	bts, err = x509.MarshalPKIXPublicKey(&privatekey.PublicKey)
+	pemEncodedPub, err := pemPublicKey(privatekey)
 	if err != nil {
-		return errors.WrapPrefix(err, "Failed to serialize public key", 0)
+		return err
 	}
-	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bts})
 	if err := ioutil.WriteFile(filepath.Join(confpath, "pk.pem"), pemEncodedPub, 0644); err != nil {
 		return errors.WrapPrefix(err, "Failed to write public key", 0)
 	}
@@ -132,6 +230,43 @@ func signManager(privatekey *ecdsa.PrivateKey, confpath string, skipverification
 	return nil
 }
 
+// buildIndex computes the index of the scheme at the specified path, containing the hashes of
+// all files of the scheme that are to be signed.
+func buildIndex(confpath string) (irma.SchemeManagerIndex, error) {
+	var index irma.SchemeManagerIndex = make(map[string]irma.ConfigurationFileHash)
+	err := filepath.Walk(confpath, func(path string, info os.FileInfo, err error) error {
+		return calculateFileHash(path, info, err, confpath, index)
+	})
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to calculate file index:", 0)
+	}
+	return index, nil
+}
+
+// signIndex returns the serialized index and the signature over it.
+func signIndex(privatekey *ecdsa.PrivateKey, index irma.SchemeManagerIndex) ([]byte, []byte, error) {
+	bts := []byte(index.String())
+	indexHash := sha256.Sum256(bts)
+	r, s, err := ecdsa.Sign(rand.Reader, privatekey, indexHash[:])
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, "Failed to sign index:", 0)
+	}
+	sigbytes, err := asn1.Marshal([]*big.Int{r, s})
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, "Failed to serialize signature:", 0)
+	}
+	return bts, sigbytes, nil
+}
+
+// pemPublicKey returns the PEM-encoded public key of the specified private key.
+func pemPublicKey(privatekey *ecdsa.PrivateKey) ([]byte, error) {
+	bts, err := x509.MarshalPKIXPublicKey(&privatekey.PublicKey)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to serialize public key", 0)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bts}), nil
+}
+
 func readPrivateKey(path string) (*ecdsa.PrivateKey, error) {
 	bts, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -149,12 +284,14 @@ func calculateFileHash(path string, info os.FileInfo, err error, confpath string
 	if info.IsDir() || // Can only sign files
 		strings.HasSuffix(path, "index") || // Skip the index file itself
 		strings.Contains(filepath.ToSlash(path), "/.git/") || // No need to traverse .git dirs, can take quite long
-		strings.Contains(filepath.ToSlash(path), "/PrivateKeys/") { // Don't sign private keys
+		strings.Contains(filepath.ToSlash(path), "/PrivateKeys/") || // Don't sign private keys
+		filepath.Base(path) == irma.SchemeKeyRotationsFile { // Key rotations are signed by themselves
 		return nil
 	}
 	// Skip everything except the stuff we do want
 	if !strings.HasSuffix(path, ".xml") &&
 		!strings.HasSuffix(path, ".png") &&
+		!strings.HasSuffix(path, ".json") && // description.json and requestors.json of requestor schemes
 		!regexp.MustCompile("kss-\\d+\\.pem$").Match([]byte(filepath.Base(path))) &&
 		filepath.Base(path) != "timestamp" {
 		return nil
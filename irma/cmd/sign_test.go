@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/internal/fs"
+	"github.com/privacybydesign/irmago/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRequestorScheme writes a requestor scheme with the specified ID and one requestor to dir.
+func writeRequestorScheme(t *testing.T, dir, id string) {
+	testdata := test.FindTestdataFolder(t)
+	logo, err := ioutil.ReadFile(filepath.Join(testdata, "irma_configuration", "irma-demo", "RU", "logo.png"))
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, id)
+	require.NoError(t, fs.EnsureDirectoryExists(path))
+	require.NoError(t, fs.EnsureDirectoryExists(filepath.Join(path, "assets")))
+	files := map[string][]byte{
+		"description.json":   []byte(`{"id": "` + id + `", "url": "http://localhost:48681/` + id + `"}`),
+		"assets/example.png": logo,
+		"requestors.json": []byte(`[{
+			"name": {"en": "Example", "nl": "Voorbeeld"},
+			"hostnames": ["example.com", "www.example.com"],
+			"logo": "assets/example.png",
+			"attributes": ["irma-demo.MijnOverheid.fullName", "irma-demo.RU.studentCard.studentID"]
+		}]`),
+	}
+	for name, bts := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(path, filepath.FromSlash(name)), bts, 0644))
+	}
+}
+
+func TestSignRequestorScheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irma_configuration")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, fs.CopyDirectory(filepath.Join(test.FindTestdataFolder(t), "irma_configuration"), dir))
+
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	writeRequestorScheme(t, dir, "test-requestors")
+	require.NoError(t, signManager(sk, filepath.Join(dir, "test-requestors"), true))
+
+	// Tamper with a second requestor scheme after signing it
+	writeRequestorScheme(t, dir, "test-tampered")
+	require.NoError(t, signManager(sk, filepath.Join(dir, "test-tampered"), true))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "test-tampered", "requestors.json"),
+		[]byte(`[{"name": {"en": "Evil"}, "hostnames": ["example.org"]}]`),
+		0644,
+	))
+
+	// Sign a third requestor scheme of which only the second requestor is invalid
+	writeRequestorScheme(t, dir, "test-invalid")
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(dir, "test-invalid", "requestors.json"),
+		[]byte(`[{"name": {"en": "Valid"}, "hostnames": ["example.net"]}, {"name": {"en": "Invalid"}, "hostnames": []}]`),
+		0644,
+	))
+	require.NoError(t, signManager(sk, filepath.Join(dir, "test-invalid"), true))
+
+	conf, err := irma.NewConfigurationReadOnly(dir)
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+	require.Contains(t, conf.RequestorSchemes, irma.NewRequestorSchemeIdentifier("test-requestors"))
+	require.Contains(t, conf.DisabledRequestorSchemes, irma.NewRequestorSchemeIdentifier("test-tampered"))
+
+	// None of the requestors of the invalid scheme are registered
+	require.Contains(t, conf.DisabledRequestorSchemes, irma.NewRequestorSchemeIdentifier("test-invalid"))
+	require.Nil(t, conf.Requestor("example.net"))
+	for _, warning := range conf.Warnings {
+		require.NotContains(t, warning, "test-invalid")
+	}
+	require.NotContains(t, conf.SchemeManagers, irma.NewSchemeManagerIdentifier("test-requestors"))
+
+	require.Nil(t, conf.Requestor("example.org"))
+	requestor := conf.Requestor("WWW.example.com")
+	require.NotNil(t, requestor)
+	require.Equal(t, "Voorbeeld", requestor.Name["nl"])
+	require.Equal(t, irma.NewRequestorSchemeIdentifier("test-requestors"), requestor.Scheme)
+	require.NotEmpty(t, requestor.LogoPath(conf))
+
+	require.True(t, requestor.Declares(irma.NewAttributeTypeIdentifier("irma-demo.MijnOverheid.fullName.firstname")))
+	require.True(t, requestor.Declares(irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")))
+	require.False(t, requestor.Declares(irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.level")))
+
+	request := irma.NewDisclosureRequest(
+		irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID"),
+		irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.level"),
+		irma.NewAttributeTypeIdentifier("irma-demo.MijnOverheid.root.BSN"),
+	)
+	require.Equal(t, []irma.AttributeTypeIdentifier{
+		irma.NewAttributeTypeIdentifier("irma-demo.MijnOverheid.root.BSN"),
+		irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.level"),
+	}, requestor.UndeclaredAttributes(request))
+}
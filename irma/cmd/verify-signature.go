@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/server"
+	"github.com/spf13/cobra"
+)
+
+// verifySignatureCmd represents the verify-signature command
+var verifySignatureCmd = &cobra.Command{
+	Use:   "verify-signature signature",
+	Short: "Verify an IRMA attribute-based signature",
+	Long: `Verify an IRMA attribute-based signature, and print the signed message and attributes.
+
+The signature argument must be a path to a file containing either an IRMA signature (as in the
+"signature" field of a session result), or, when --file is specified, a file signature as created
+by "irma session --sign-file". In the latter case the digest of the file specified by --file
+is checked against the file signature.
+
+The signature may also be a signature bundle of a multi-signature session (as in the
+"signatureBundle" field of its session result). In that case the signature of each signer is
+verified, as well as the order of their timestamps, and --request accepts a multi-signature request.`,
+	Example: `irma verify-signature signature.json
+irma verify-signature --file contract.pdf contract.pdf.irmasig`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		confpath, _ := flags.GetString("schemes-path")
+		file, _ := flags.GetString("file")
+		requestJson, _ := flags.GetString("request")
+
+		conf, err := irma.NewConfigurationReadOnly(confpath)
+		if err != nil {
+			die("Failed to open irma_configuration", err)
+		}
+		if err = conf.ParseFolder(); err != nil {
+			die("Failed to parse irma_configuration", err)
+		}
+
+		bts, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			die("Failed to read signature", err)
+		}
+		var ldcontext struct {
+			LDContext string `json:"@context"`
+		}
+		if err = json.Unmarshal(bts, &ldcontext); err != nil {
+			die("Failed to parse signature", err)
+		}
+		if ldcontext.LDContext == irma.LDContextSignatureBundle {
+			verifySignatureBundle(conf, bts, requestJson)
+			return
+		}
+
+		var request *irma.SignatureRequest
+		if requestJson != "" {
+			request = &irma.SignatureRequest{}
+			if err = irma.UnmarshalValidate([]byte(requestJson), request); err != nil {
+				die("Failed to parse signature request", err)
+			}
+		}
+
+		var (
+			attrs   [][]*irma.DisclosedAttribute
+			status  irma.ProofStatus
+			message string
+		)
+		if file != "" {
+			signedFile := &irma.SignedFile{}
+			if err = irma.UnmarshalValidate(bts, signedFile); err != nil {
+				die("Failed to parse file signature", err)
+			}
+			attrs, status, err = signedFile.VerifyPath(conf, file, request)
+			message = signedFile.Document.Message()
+		} else {
+			signature := &irma.SignedMessage{}
+			if err = json.Unmarshal(bts, signature); err != nil {
+				die("Failed to parse signature", err)
+			}
+			attrs, status, err = signature.Verify(conf, request)
+			message = signature.Message
+		}
+		if err != nil {
+			die("Failed to verify signature", err)
+		}
+
+		fmt.Println("Signed message:")
+		fmt.Println(message)
+		fmt.Println()
+		fmt.Println("Attributes:")
+		fmt.Println(prettyprint(attrs))
+		fmt.Println()
+		fmt.Println("Proof status:", status)
+		if status != irma.ProofStatusValid {
+			die("", errors.New("Signature is not valid"))
+		}
+	},
+}
+
+func verifySignatureBundle(conf *irma.Configuration, bts []byte, requestJson string) {
+	var request *irma.MultiSignatureRequest
+	if requestJson != "" {
+		request = &irma.MultiSignatureRequest{}
+		if err := irma.UnmarshalValidate([]byte(requestJson), request); err != nil {
+			die("Failed to parse multi-signature request", err)
+		}
+	}
+
+	bundle := &irma.SignatureBundle{}
+	if err := irma.UnmarshalValidate(bts, bundle); err != nil {
+		die("Failed to parse signature bundle", err)
+	}
+	attrs, status, err := bundle.Verify(conf, request)
+	if err != nil {
+		die("Failed to verify signature bundle", err)
+	}
+
+	fmt.Println("Signed message:")
+	fmt.Println(bundle.Message)
+	fmt.Println()
+	for _, cosig := range bundle.Signatures {
+		fmt.Printf("Signer %d, signed at %s:\n", cosig.Signer, time.Unix(cosig.Signature.Timestamp.Time, 0))
+		if status == irma.ProofStatusValid {
+			fmt.Println(prettyprint(attrs[cosig.Signer]))
+		}
+		fmt.Println()
+	}
+	fmt.Println("Proof status:", status)
+	if status != irma.ProofStatusValid {
+		die("", errors.New("Signature bundle is not valid"))
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(verifySignatureCmd)
+
+	flags := verifySignatureCmd.Flags()
+	flags.SortFlags = false
+	flags.StringP("schemes-path", "s", server.DefaultSchemesPath(), "path to irma_configuration")
+	flags.StringP("file", "f", "", "signed file to verify the file signature against")
+	flags.StringP("request", "r", "", "JSON signature request to verify the signature against (optional)")
+}
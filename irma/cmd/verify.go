@@ -98,11 +98,12 @@ func VerifyIrmaConfiguration(path string) error {
 	if err := conf.ValidateKeys(); err != nil {
 		return err
 	}
-	if len(conf.SchemeManagers) == 0 {
+	managers := conf.Snapshot().SchemeManagers
+	if len(managers) == 0 {
 		return errors.New("Specified folder doesn't contain any schemes")
 	}
 
-	for _, manager := range conf.SchemeManagers {
+	for _, manager := range managers {
 		if err := conf.VerifySchemeManager(manager); err != nil {
 			return err
 		}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago/irmaclient"
+	"github.com/spf13/cobra"
+)
+
+var walletCheckCmd = &cobra.Command{
+	Use:   "check path",
+	Short: "Check the integrity of the credentials in a wallet",
+	Long: `The check command checks the credentials in the wallet at the specified path for inconsistencies:
+signatures without credential, credentials without signature or with a signature that does not
+verify against the issuer public key, credentials of unknown credential types or public keys,
+and multiple instances of singleton credential types.
+
+With --repair, the signatures and credentials concerned are removed, except for credentials of
+unknown credential types or public keys (as these may become known again after a scheme update).
+Without --repair the wallet is left untouched; it must then have been migrated to the current
+storage version by the IRMA app (or by a previous --repair). The command exits with a nonzero
+status if any issues remain.`,
+	Example: `irma wallet check ~/irma-storage
+irma wallet check --repair ~/irma-storage`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repair, _ := cmd.Flags().GetBool("repair")
+		client, err := openWallet(cmd, args[0], repair)
+		if err != nil {
+			die("", err)
+		}
+
+		var issues []*irmaclient.IntegrityIssue
+		if repair {
+			issues, err = client.RepairIntegrity()
+		} else {
+			issues, err = client.CheckIntegrity()
+		}
+		if closeErr := client.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+		if err != nil {
+			die("Failed to check wallet integrity", err)
+		}
+
+		remaining := 0
+		for _, issue := range issues {
+			fmt.Println(issue)
+			if !issue.Repaired {
+				remaining++
+			}
+		}
+		if len(issues) == 0 {
+			fmt.Println("No issues found")
+		}
+		if remaining > 0 {
+			die("", errors.Errorf("%d issue(s) remaining", remaining))
+		}
+	},
+}
+
+func init() {
+	walletCmd.AddCommand(walletCheckCmd)
+
+	walletCheckCmd.Flags().Bool("repair", false, "remove the credentials and signatures with issues where possible")
+}
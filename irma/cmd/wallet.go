@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+	"github.com/privacybydesign/irmago/irmaclient"
+	"github.com/privacybydesign/irmago/server"
+	"github.com/spf13/cobra"
+)
+
+// walletCmd represents the wallet command
+var walletCmd = &cobra.Command{
+	Use:   "wallet",
+	Short: "Inspect and maintain the storage of an IRMA app",
+	Long: `The wallet commands operate on the storage directory of an IRMA app (an irmaclient),
+without user interaction. The schemes in the irma_configuration folder within the storage
+directory are updated from the folder specified with --schemes-path if they are older.`,
+}
+
+// headlessHandler is an irmaclient.ClientHandler that ignores all events.
+type headlessHandler struct{}
+
+func (headlessHandler) EnrollmentFailure(irma.SchemeManagerIdentifier, error) {}
+func (headlessHandler) EnrollmentSuccess(irma.SchemeManagerIdentifier)        {}
+func (headlessHandler) ChangePinFailure(irma.SchemeManagerIdentifier, error)  {}
+func (headlessHandler) ChangePinSuccess(irma.SchemeManagerIdentifier)         {}
+func (headlessHandler) ChangePinIncorrect(irma.SchemeManagerIdentifier, int)  {}
+func (headlessHandler) ChangePinBlocked(irma.SchemeManagerIdentifier, int)    {}
+func (headlessHandler) UpdateConfiguration(*irma.IrmaIdentifierSet)           {}
+func (headlessHandler) UpdateAttributes()                                     {}
+func (headlessHandler) CredentialsExpiring([]*irmaclient.ExpiringCredential)  {}
+
+// openWallet opens the irmaclient storage at the specified path. If modify is false, the storage
+// is opened without migrating it or removing any logs or credentials (see irmaclient.Open()).
+// The caller should close the returned client.
+func openWallet(cmd *cobra.Command, path string, modify bool) (*irmaclient.Client, error) {
+	schemes, _ := cmd.Flags().GetString("schemes-path")
+	var client *irmaclient.Client
+	var err error
+	if modify {
+		client, err = irmaclient.New(path, schemes, "", headlessHandler{}, nil)
+	} else {
+		client, err = irmaclient.Open(path, schemes, headlessHandler{})
+	}
+	if err != nil {
+		if _, ok := err.(*irma.SchemeManagerError); !ok || client == nil {
+			return nil, errors.WrapPrefix(err, "Failed to open wallet", 0)
+		}
+		// The client is usable despite one of its schemes being invalid
+		fmt.Println("Warning: failed to parse scheme:", err)
+	}
+	return client, nil
+}
+
+func init() {
+	RootCmd.AddCommand(walletCmd)
+
+	walletCmd.PersistentFlags().StringP("schemes-path", "s", server.DefaultSchemesPath(), "path to irma_configuration with which to update the schemes of the wallet")
+}
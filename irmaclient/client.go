@@ -2,7 +2,9 @@ package irmaclient
 
 import (
 	"path/filepath"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bwesterb/go-atum"
@@ -35,19 +37,29 @@ import (
 // immediately need to be available anyway.
 //
 // - The secret key (the zeroth attribute of every credential), being the same
-// across all credentials, is stored only once in a separate file (storing this
-// in multiple places would be bad).
+// across all credentials, is stored only once (storing this in multiple places
+// would be bad).
+//
+// All changes to the stored credentials, such as adding or removing a credential
+// along with its log entry, are made in a single storage transaction.
+//
+// A Client is safe for concurrent use: its exported methods acquire the lock of the Client
+// where they access its credentials, keyshare servers or preferences, while its unexported
+// methods expect the caller to hold the lock unless documented otherwise. Handlers are never
+// called while the lock is held, so they may call back into the Client. (The exported
+// Preferences field should only be read by the user of this package when no other methods
+// of the Client are running.) Only one session runs at a time (see NewSession()).
 
 type Client struct {
 	// Stuff we manage on disk
-	secretkey        *secretKey
+	secretkey        *SecretKey
 	attributes       map[irma.CredentialTypeIdentifier][]*irma.AttributeList
 	credentialsCache map[irma.CredentialTypeIdentifier]map[int]*credential
-	keyshareServers  map[irma.SchemeManagerIdentifier]*keyshareServer
-	updates          []update
+	keyshareServers  map[irma.SchemeManagerIdentifier]*KeyshareServer
+	updates          []Update
 
 	// Where we store/load it to/from
-	storage storage
+	storage Storage
 
 	// Other state
 	Preferences           Preferences
@@ -55,6 +67,12 @@ type Client struct {
 	irmaConfigurationPath string
 	androidStoragePath    string
 	handler               ClientHandler
+	expiryMonitorStop     chan struct{}
+	expiryMonitorDone     chan struct{}
+	managedSessionPolicy  *SessionPolicy
+
+	lock    sync.Mutex
+	session *session // the currently running session, if any
 }
 
 // SentryDSN should be set in the init() function
@@ -63,10 +81,21 @@ var SentryDSN = ""
 
 type Preferences struct {
 	EnableCrashReporting bool
+	LogRetention         LogRetention
+	// ExpiryWarningDays is the amount of days in advance that credentials about to expire
+	// are reported to the ClientHandler.
+	ExpiryWarningDays int
+	// RemoveExpiredCredentials enables the automatic removal of expired credentials.
+	RemoveExpiredCredentials bool
+	// DisclosureRules contains the remembered disclosure choices per (lowercase) server hostname.
+	DisclosureRules map[string]*DisclosureRule `json:",omitempty"`
+	// SessionPolicy restricts the sessions that the client performs, if set.
+	SessionPolicy *SessionPolicy `json:",omitempty"`
 }
 
 var defaultPreferences = Preferences{
 	EnableCrashReporting: true,
+	ExpiryWarningDays:    30,
 }
 
 // KeyshareHandler is used for asking the user for his email address and PIN,
@@ -91,6 +120,10 @@ type ClientHandler interface {
 
 	UpdateConfiguration(new *irma.IrmaIdentifierSet)
 	UpdateAttributes()
+	// CredentialsExpiring is called in the background shortly after the client is created and
+	// periodically afterwards with the credentials that expire soon or have expired
+	// (see ExpiringCredential).
+	CredentialsExpiring(credentials []*ExpiringCredential)
 }
 
 // MissingAttributes contains all attribute requests that the client cannot satisfy with its
@@ -101,7 +134,8 @@ type MissingAttributes map[int]map[int]map[int]MissingAttribute
 // (with Go's default JSON marshaler instead of that of irma.AttributeRequest).
 type MissingAttribute irma.AttributeRequest
 
-type secretKey struct {
+// SecretKey is the secret key of the client, being the zeroth attribute of all of its credentials.
+type SecretKey struct {
 	Key *big.Int
 }
 
@@ -110,8 +144,9 @@ type secretKey struct {
 // is the path to a (possibly readonly) folder containing irma_configuration;
 // androidStoragePath is an optional path to the files of the old android app
 // (specify "" if you do not want to parse the old android app files),
-// and handler is used for informing the user of new stuff, and when a
-// enrollment to a keyshare server needs to happen.
+// handler is used for informing the user of new stuff, and when a
+// enrollment to a keyshare server needs to happen, and storage is used for persisting
+// the client (specify nil to store it in files and a database within storagePath).
 // The client returned by this function has been fully deserialized
 // and is ready for use.
 //
@@ -122,6 +157,27 @@ func New(
 	irmaConfigurationPath string,
 	androidStoragePath string,
 	handler ClientHandler,
+	storage Storage,
+) (*Client, error) {
+	return newClient(storagePath, irmaConfigurationPath, androidStoragePath, handler, storage, false)
+}
+
+// Open opens the client stored at storagePath like New(), but only for inspecting it: it
+// returns an error instead of migrating the storage or generating a secret key, and it
+// neither enforces the log retention nor checks the expiry of the credentials. The
+// schemes are still updated from irmaConfigurationPath. The caller should Close() the
+// client when done.
+func Open(storagePath string, irmaConfigurationPath string, handler ClientHandler) (*Client, error) {
+	return newClient(storagePath, irmaConfigurationPath, "", handler, nil, true)
+}
+
+func newClient(
+	storagePath string,
+	irmaConfigurationPath string,
+	androidStoragePath string,
+	handler ClientHandler,
+	storage Storage,
+	inspect bool,
 ) (*Client, error) {
 	var err error
 	if err = fs.AssertPathExists(storagePath); err != nil {
@@ -133,7 +189,7 @@ func New(
 
 	cm := &Client{
 		credentialsCache:      make(map[irma.CredentialTypeIdentifier]map[int]*credential),
-		keyshareServers:       make(map[irma.SchemeManagerIdentifier]*keyshareServer),
+		keyshareServers:       make(map[irma.SchemeManagerIdentifier]*KeyshareServer),
 		attributes:            make(map[irma.CredentialTypeIdentifier][]*irma.AttributeList),
 		irmaConfigurationPath: irmaConfigurationPath,
 		androidStoragePath:    androidStoragePath,
@@ -154,41 +210,82 @@ func New(
 	}
 
 	// Ensure storage path exists, and populate it with necessary files
-	cm.storage = storage{storagePath: storagePath, Configuration: cm.Configuration}
+	if storage == nil {
+		storage = &boltStorage{storagePath: storagePath}
+	}
+	cm.storage = storage
 	if err = cm.storage.EnsureStorageExists(); err != nil {
 		return nil, err
 	}
+	// Release the storage if we fail from here on, so that it can be opened again
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			_ = cm.storage.Close()
+		}
+	}()
 
-	if cm.Preferences, err = cm.storage.LoadPreferences(); err != nil {
+	if err = cm.loadPreferences(); err != nil {
 		return nil, err
 	}
 	cm.applyPreferences()
 
-	// Perform new update functions from clientUpdates, if any
-	if err = cm.update(); err != nil {
-		return nil, err
+	if inspect {
+		if err = cm.assertUpdated(); err != nil {
+			return nil, err
+		}
+		if cm.secretkey, err = cm.storage.LoadSecretKey(); err != nil {
+			return nil, err
+		}
+		if cm.secretkey == nil {
+			return nil, errors.New("No secret key stored")
+		}
+	} else {
+		// Perform new update functions from clientUpdates, if any
+		if err = cm.update(); err != nil {
+			return nil, err
+		}
+		if err = cm.loadSecretKey(); err != nil {
+			return nil, err
+		}
 	}
 
 	// Load our stuff
-	if cm.secretkey, err = cm.storage.LoadSecretKey(); err != nil {
-		return nil, err
-	}
-	if cm.attributes, err = cm.storage.LoadAttributes(); err != nil {
+	if err = cm.loadAttributes(); err != nil {
 		return nil, err
 	}
 	if cm.keyshareServers, err = cm.storage.LoadKeyshareServers(); err != nil {
 		return nil, err
 	}
+	if cm.keyshareServers == nil {
+		cm.keyshareServers = make(map[irma.SchemeManagerIdentifier]*KeyshareServer)
+	}
 
 	if len(cm.UnenrolledSchemeManagers()) > 1 {
 		return nil, errors.New("Too many keyshare servers")
 	}
 
+	succeeded = true
+	if inspect {
+		return cm, schemeMgrErr
+	}
+
+	if err = cm.enforceLogRetention(); err != nil {
+		irma.Logger.Warn(errors.WrapPrefix(err, "Failed to enforce log retention", 0).ErrorStack())
+	}
+	cm.startExpiryMonitor()
+
 	return cm, schemeMgrErr
 }
 
 // CredentialInfoList returns a list of information of all contained credentials.
 func (client *Client) CredentialInfoList() irma.CredentialInfoList {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.credentialInfoList()
+}
+
+func (client *Client) credentialInfoList() irma.CredentialInfoList {
 	list := irma.CredentialInfoList([]*irma.CredentialInfo{})
 
 	for _, attrlistlist := range client.attributes {
@@ -204,9 +301,36 @@ func (client *Client) CredentialInfoList() irma.CredentialInfoList {
 	return list
 }
 
+// CredentialViews returns render-ready views of all contained credentials, including the display
+// metadata of their credential types, sorted by credential type and then from old to new.
+func (client *Client) CredentialViews() []*irma.CredentialView {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	var views []*irma.CredentialView
+	for _, attrlistlist := range client.attributes {
+		for _, attrlist := range attrlistlist {
+			if view := attrlist.View(client.Configuration); view != nil {
+				views = append(views, view)
+			}
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		a, b := views[i], views[j]
+		switch {
+		case a.ID != b.ID:
+			return a.ID.String() < b.ID.String()
+		case !time.Time(a.SignedOn).Equal(time.Time(b.SignedOn)):
+			return a.SignedOn.Before(b.SignedOn)
+		default:
+			return a.Hash < b.Hash
+		}
+	})
+	return views
+}
+
 // addCredential adds the specified credential to the Client, saving its signature
-// imediately, and optionally cm.attributes as well.
-func (client *Client) addCredential(cred *credential, storeAttributes bool) (err error) {
+// within the specified transaction. The caller should store the attributes as well.
+func (client *Client) addCredential(tx StorageTransaction, cred *credential) error {
 	id := irma.NewCredentialTypeIdentifier("")
 	if cred.CredentialType() != nil {
 		id = cred.CredentialType().Identifier()
@@ -224,7 +348,9 @@ func (client *Client) addCredential(cred *credential, storeAttributes bool) (err
 	// If this is a singleton credential type, ensure we have at most one by removing any previous instance
 	if !id.Empty() && cred.CredentialType().IsSingleton {
 		for len(client.attrs(id)) != 0 {
-			client.remove(id, 0, false)
+			if _, err := client.remove(tx, id, 0); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -238,38 +364,120 @@ func (client *Client) addCredential(cred *credential, storeAttributes bool) (err
 		client.credentialsCache[id][counter] = cred
 	}
 
-	if err = client.storage.StoreSignature(cred); err != nil {
-		return
-	}
-	if storeAttributes {
-		err = client.storage.StoreAttributes(client.attributes)
-	}
-	return
+	return tx.StoreSignature(cred.AttributeList(), cred.Signature)
 }
 
-func generateSecretKey() (*secretKey, error) {
+func generateSecretKey() (*SecretKey, error) {
 	key, err := gabi.RandomBigInt(gabi.DefaultSystemParameters[1024].Lm)
 	if err != nil {
 		return nil, err
 	}
-	return &secretKey{Key: key}, nil
+	return &SecretKey{Key: key}, nil
+}
+
+// loadSecretKey retrieves the secret key from storage, or if no secret key
+// was found in storage, it generates and saves a new secret key.
+func (client *Client) loadSecretKey() error {
+	sk, err := client.storage.LoadSecretKey()
+	if err != nil {
+		return err
+	}
+	if sk == nil {
+		// Never replace a secret key that has not yet been migrated into the database,
+		// as that would make all existing credentials unusable
+		if s, ok := client.storage.(*boltStorage); ok {
+			legacy, err := s.hasLegacySecretKey()
+			if err != nil {
+				return err
+			}
+			if legacy {
+				return errors.New("Secret key has not been migrated to the database")
+			}
+		}
+		if sk, err = generateSecretKey(); err != nil {
+			return err
+		}
+		err = client.storage.Transaction(func(tx StorageTransaction) error {
+			return tx.StoreSecretKey(sk)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	client.secretkey = sk
+	return nil
+}
+
+func (client *Client) loadAttributes() error {
+	list, err := client.storage.LoadAttributes()
+	if err != nil {
+		return err
+	}
+	client.attributes = make(map[irma.CredentialTypeIdentifier][]*irma.AttributeList)
+	for _, attrlist := range list {
+		attrlist.MetadataAttribute = irma.MetadataFromInt(attrlist.Ints[0], client.Configuration)
+		var id irma.CredentialTypeIdentifier
+		if credtype := attrlist.CredentialType(); credtype != nil {
+			id = credtype.Identifier()
+		}
+		client.attributes[id] = append(client.attributes[id], attrlist)
+	}
+	return nil
+}
+
+func (client *Client) storeAttributes(tx StorageTransaction) error {
+	list := []*irma.AttributeList{}
+	for _, attrlistlist := range client.attributes {
+		list = append(list, attrlistlist...)
+	}
+	return tx.StoreAttributes(list)
+}
+
+// transaction calls f within a storage transaction. As f may modify the attributes, credentials
+// and keyshare servers of the client before the transaction fails, these are then reloaded from
+// storage, so that they keep matching what is stored.
+func (client *Client) transaction(f func(tx StorageTransaction) error) error {
+	err := client.storage.Transaction(f)
+	if err == nil {
+		return nil
+	}
+	client.credentialsCache = make(map[irma.CredentialTypeIdentifier]map[int]*credential)
+	if loadErr := client.loadAttributes(); loadErr != nil {
+		irma.Logger.Warn("Failed to reload attributes after failed transaction: ", loadErr)
+	}
+	if ksses, loadErr := client.storage.LoadKeyshareServers(); loadErr != nil {
+		irma.Logger.Warn("Failed to reload keyshare servers after failed transaction: ", loadErr)
+	} else if ksses != nil {
+		client.keyshareServers = ksses
+	}
+	return err
+}
+
+func (client *Client) loadPreferences() error {
+	prefs, err := client.storage.LoadPreferences()
+	if err != nil {
+		return err
+	}
+	if prefs == nil {
+		prefs = &defaultPreferences
+	}
+	client.Preferences = *prefs
+	return nil
 }
 
 // Removal methods
 
-func (client *Client) remove(id irma.CredentialTypeIdentifier, index int, storenow bool) error {
+// remove removes the specified credential from the Client, deleting its signature within
+// the specified transaction, and returns its attributes. The caller should store the
+// attributes as well.
+func (client *Client) remove(tx StorageTransaction, id irma.CredentialTypeIdentifier, index int) (*irma.AttributeList, error) {
 	// Remove attributes
 	list, exists := client.attributes[id]
 	if !exists || index >= len(list) {
-		return errors.Errorf("Can't remove credential %s-%d: no such credential", id.String(), index)
+		return nil, errors.Errorf("Can't remove credential %s-%d: no such credential", id.String(), index)
 	}
 	attrs := list[index]
 	client.attributes[id] = append(list[:index], list[index+1:]...)
-	if storenow {
-		if err := client.storage.StoreAttributes(client.attributes); err != nil {
-			return err
-		}
-	}
 
 	// Remove credential
 	if creds, exists := client.credentialsCache[id]; exists {
@@ -280,59 +488,101 @@ func (client *Client) remove(id irma.CredentialTypeIdentifier, index int, storen
 	}
 
 	// Remove signature from storage
-	if err := client.storage.DeleteSignature(attrs); err != nil {
-		return err
+	if err := tx.DeleteSignature(attrs.Hash()); err != nil {
+		return nil, err
 	}
+	return attrs, nil
+}
 
-	removed := map[irma.CredentialTypeIdentifier][]irma.TranslatedString{}
-	removed[id] = attrs.Strings()
+// RemoveCredential removes the specified credential.
+func (client *Client) RemoveCredential(id irma.CredentialTypeIdentifier, index int) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.removeCredential(id, index)
+}
 
-	if storenow {
-		return client.storage.AddLogEntry(&LogEntry{
+func (client *Client) removeCredential(id irma.CredentialTypeIdentifier, index int) error {
+	return client.transaction(func(tx StorageTransaction) error {
+		attrs, err := client.remove(tx, id, index)
+		if err != nil {
+			return err
+		}
+		if err = client.storeAttributes(tx); err != nil {
+			return err
+		}
+		return tx.AddLogEntry(&LogEntry{
 			Type:    ActionRemoval,
 			Time:    irma.Timestamp(time.Now()),
-			Removed: removed,
+			Removed: map[irma.CredentialTypeIdentifier][]irma.TranslatedString{id: attrs.Strings()},
 		})
-	}
-	return nil
-}
-
-// RemoveCredential removes the specified credential.
-func (client *Client) RemoveCredential(id irma.CredentialTypeIdentifier, index int) error {
-	return client.remove(id, index, true)
+	})
 }
 
 // RemoveCredentialByHash removes the specified credential.
 func (client *Client) RemoveCredentialByHash(hash string) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 	cred, index, err := client.credentialByHash(hash)
 	if err != nil {
 		return err
 	}
-	return client.RemoveCredential(cred.CredentialType().Identifier(), index)
+	if cred == nil {
+		return errors.Errorf("Can't remove credential %s: no such credential", hash)
+	}
+	return client.removeCredential(cred.CredentialType().Identifier(), index)
 }
 
 // RemoveAllCredentials removes all credentials.
 func (client *Client) RemoveAllCredentials() error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	all := make(map[irma.CredentialTypeIdentifier][]*irma.AttributeList, len(client.attributes))
+	for id, list := range client.attributes {
+		all[id] = append([]*irma.AttributeList{}, list...)
+	}
+	return client.transaction(func(tx StorageTransaction) error {
+		return client.removeCredentials(tx, all)
+	})
+}
+
+// removeCredentials removes the credentials having the specified attributes within the specified
+// transaction, stores the remaining attributes, and adds a log entry of the removed credentials.
+func (client *Client) removeCredentials(tx StorageTransaction, creds map[irma.CredentialTypeIdentifier][]*irma.AttributeList) error {
 	removed := map[irma.CredentialTypeIdentifier][]irma.TranslatedString{}
-	for _, attrlistlist := range client.attributes {
-		for _, attrs := range attrlistlist {
+	for id, list := range creds {
+		for _, attrs := range list {
+			if err := client.removeAttributes(tx, id, attrs); err != nil {
+				return err
+			}
 			if attrs.CredentialType() != nil {
-				removed[attrs.CredentialType().Identifier()] = attrs.Strings()
+				removed[id] = append(removed[id], attrs.Strings()...)
 			}
-			_ = client.storage.DeleteSignature(attrs)
 		}
 	}
-	client.attributes = map[irma.CredentialTypeIdentifier][]*irma.AttributeList{}
-	if err := client.storage.StoreAttributes(client.attributes); err != nil {
+	// Removing credentials shifts the indices of the credentials after them
+	client.credentialsCache = make(map[irma.CredentialTypeIdentifier]map[int]*credential)
+	if err := client.storeAttributes(tx); err != nil {
 		return err
 	}
-
-	logentry := &LogEntry{
+	if len(removed) == 0 {
+		return nil
+	}
+	return tx.AddLogEntry(&LogEntry{
 		Type:    ActionRemoval,
 		Time:    irma.Timestamp(time.Now()),
 		Removed: removed,
+	})
+}
+
+// removeAttributes removes the credential having the specified attributes.
+func (client *Client) removeAttributes(tx StorageTransaction, id irma.CredentialTypeIdentifier, attrs *irma.AttributeList) error {
+	for index, a := range client.attributes[id] {
+		if a == attrs {
+			_, err := client.remove(tx, id, index)
+			return err
+		}
 	}
-	return client.storage.AddLogEntry(logentry)
+	return nil
 }
 
 // Attribute and credential getter methods
@@ -359,6 +609,12 @@ func (client *Client) creds(id irma.CredentialTypeIdentifier) map[int]*credentia
 
 // Attributes returns the attribute list of the requested credential, or nil if we do not have it.
 func (client *Client) Attributes(id irma.CredentialTypeIdentifier, counter int) (attributes *irma.AttributeList) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.attributeList(id, counter)
+}
+
+func (client *Client) attributeList(id irma.CredentialTypeIdentifier, counter int) (attributes *irma.AttributeList) {
 	list := client.attrs(id)
 	if len(list) <= counter {
 		return
@@ -404,7 +660,7 @@ func (client *Client) credential(id irma.CredentialTypeIdentifier, counter int)
 	// deserialized during New(). If so, there should be a corresponding signature file,
 	// so we read that, construct the credential, and add it to the credential map
 	if _, exists := client.creds(id)[counter]; !exists {
-		attrs := client.Attributes(id, counter)
+		attrs := client.attributeList(id, counter)
 		if attrs == nil { // We do not have the requested cred
 			return
 		}
@@ -519,6 +775,14 @@ func cartesianProduct(candidates [][]*irma.CredentialIdentifier) credCandidateSe
 // attributes that would be necessary to satisfy the disjunction.
 func (client *Client) Candidates(discon irma.AttributeDisCon) (
 	candidates [][]*irma.AttributeIdentifier, missing map[int]map[int]MissingAttribute,
+) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.candidates(discon)
+}
+
+func (client *Client) candidates(discon irma.AttributeDisCon) (
+	candidates [][]*irma.AttributeIdentifier, missing map[int]map[int]MissingAttribute,
 ) {
 	candidates = [][]*irma.AttributeIdentifier{}
 
@@ -593,12 +857,14 @@ func (client *Client) missingAttributes(discon irma.AttributeDisCon) map[int]map
 func (client *Client) CheckSatisfiability(condiscon irma.AttributeConDisCon) (
 	candidates [][][]*irma.AttributeIdentifier, missing MissingAttributes,
 ) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 	candidates = make([][][]*irma.AttributeIdentifier, len(condiscon))
 	missing = MissingAttributes{}
 
 	for i, discon := range condiscon {
 		var m map[int]map[int]MissingAttribute
-		candidates[i], m = client.Candidates(discon)
+		candidates[i], m = client.candidates(discon)
 		if len(candidates[i]) == 0 {
 			missing[i] = m
 		}
@@ -647,7 +913,7 @@ func (client *Client) groupCredentials(choice *irma.DisclosureChoice) (
 				continue // In this case we only disclose the metadata attribute, which is already handled above
 			}
 
-			attrIndex, err := client.Configuration.CredentialTypes[identifier.CredentialTypeIdentifier()].IndexOf(identifier)
+			attrIndex, err := client.Configuration.CredentialType(identifier.CredentialTypeIdentifier()).IndexOf(identifier)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -664,20 +930,13 @@ func (client *Client) groupCredentials(choice *irma.DisclosureChoice) (
 // ProofBuilders constructs a list of proof builders for the specified attribute choice.
 func (client *Client) ProofBuilders(choice *irma.DisclosureChoice, request irma.SessionRequest,
 ) (gabi.ProofBuilderList, irma.DisclosedAttributeIndices, *atum.Timestamp, error) {
-	todisclose, attributeIndices, err := client.groupCredentials(choice)
+	client.lock.Lock()
+	builders, attributeIndices, err := client.disclosureProofBuilders(choice)
+	client.lock.Unlock()
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	var builders gabi.ProofBuilderList
-	for _, grp := range todisclose {
-		cred, err := client.credentialByID(grp.cred)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		builders = append(builders, cred.Credential.CreateDisclosureProofBuilder(grp.attrs))
-	}
-
 	var timestamp *atum.Timestamp
 	if r, ok := request.(*irma.SignatureRequest); ok {
 		var sigs []*big.Int
@@ -698,6 +957,28 @@ func (client *Client) ProofBuilders(choice *irma.DisclosureChoice, request irma.
 	return builders, attributeIndices, timestamp, nil
 }
 
+// disclosureProofBuilders constructs a list of disclosure proof builders for the specified attribute choice.
+func (client *Client) disclosureProofBuilders(choice *irma.DisclosureChoice,
+) (gabi.ProofBuilderList, irma.DisclosedAttributeIndices, error) {
+	todisclose, attributeIndices, err := client.groupCredentials(choice)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var builders gabi.ProofBuilderList
+	for _, grp := range todisclose {
+		cred, err := client.credentialByID(grp.cred)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cred == nil {
+			return nil, nil, errors.Errorf("Can't disclose from credential %s: no such credential", grp.cred.Hash)
+		}
+		builders = append(builders, cred.Credential.CreateDisclosureProofBuilder(grp.attrs))
+	}
+	return builders, attributeIndices, nil
+}
+
 // Proofs computes disclosure proofs containing the attributes specified by choice.
 func (client *Client) Proofs(choice *irma.DisclosureChoice, request irma.SessionRequest) (*irma.Disclosure, *atum.Timestamp, error) {
 	builders, choices, timestamp, err := client.ProofBuilders(choice, request)
@@ -766,6 +1047,12 @@ func (client *Client) IssueCommitments(request *irma.IssuanceRequest, choice *ir
 // ConstructCredentials constructs and saves new credentials using the specified issuance signature messages
 // and credential builders.
 func (client *Client) ConstructCredentials(msg []*gabi.IssueSignatureMessage, request *irma.IssuanceRequest, builders gabi.ProofBuilderList) error {
+	return client.constructCredentials(msg, request, builders, nil)
+}
+
+// constructCredentials is like ConstructCredentials, saving the new credentials along with the
+// specified log entry (if not nil) in a single transaction. It acquires the lock of the client.
+func (client *Client) constructCredentials(msg []*gabi.IssueSignatureMessage, request *irma.IssuanceRequest, builders gabi.ProofBuilderList, log *LogEntry) error {
 	if len(msg) > len(builders) {
 		return errors.New("Received unexpected amount of signatures")
 	}
@@ -792,24 +1079,38 @@ func (client *Client) ConstructCredentials(msg []*gabi.IssueSignatureMessage, re
 		gabicreds = append(gabicreds, cred)
 	}
 
+	newcreds := make([]*credential, 0, len(gabicreds))
 	for _, gabicred := range gabicreds {
 		newcred, err := newCredential(gabicred, client.Configuration)
 		if err != nil {
 			return err
 		}
-		if err = client.addCredential(newcred, true); err != nil {
-			return err
-		}
+		newcreds = append(newcreds, newcred)
 	}
 
-	return nil
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.transaction(func(tx StorageTransaction) error {
+		for _, newcred := range newcreds {
+			if err := client.addCredential(tx, newcred); err != nil {
+				return err
+			}
+		}
+		if err := client.storeAttributes(tx); err != nil {
+			return err
+		}
+		if log == nil {
+			return nil
+		}
+		return tx.AddLogEntry(log)
+	})
 }
 
 // Keyshare server handling
 
 func (client *Client) genSchemeManagersList(enrolled bool) []irma.SchemeManagerIdentifier {
 	list := []irma.SchemeManagerIdentifier{}
-	for name, manager := range client.Configuration.SchemeManagers {
+	for name, manager := range client.Configuration.Snapshot().SchemeManagers {
 		if _, contains := client.keyshareServers[name]; manager.Distributed() && contains == enrolled {
 			list = append(list, manager.Identifier())
 		}
@@ -818,10 +1119,14 @@ func (client *Client) genSchemeManagersList(enrolled bool) []irma.SchemeManagerI
 }
 
 func (client *Client) UnenrolledSchemeManagers() []irma.SchemeManagerIdentifier {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 	return client.genSchemeManagersList(false)
 }
 
 func (client *Client) EnrolledSchemeManagers() []irma.SchemeManagerIdentifier {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 	return client.genSchemeManagersList(true)
 }
 
@@ -836,8 +1141,8 @@ func (client *Client) KeyshareEnroll(manager irma.SchemeManagerIdentifier, email
 }
 
 func (client *Client) keyshareEnrollWorker(managerID irma.SchemeManagerIdentifier, email *string, pin string, lang string) error {
-	manager, ok := client.Configuration.SchemeManagers[managerID]
-	if !ok {
+	manager := client.Configuration.SchemeManager(managerID)
+	if manager == nil {
 		return errors.New("Unknown scheme manager")
 	}
 	if len(manager.KeyshareServer) == 0 {
@@ -869,7 +1174,9 @@ func (client *Client) keyshareEnrollWorker(managerID irma.SchemeManagerIdentifie
 	// keyshare.go needs the relevant keyshare server to be present in the client.
 	// If the session succeeds or fails, the keyshare server is stored to disk or
 	// removed from the client by the keyshareEnrollmentHandler.
+	client.lock.Lock()
 	client.keyshareServers[managerID] = kss
+	client.lock.Unlock()
 	client.newQrSession(qr, &keyshareEnrollmentHandler{
 		client: client,
 		pin:    pin,
@@ -883,7 +1190,7 @@ func (client *Client) keyshareEnrollWorker(managerID irma.SchemeManagerIdentifie
 // if not, how many tries are left, or for how long the user is blocked. If an error is returned
 // it is of type *irma.SessionError.
 func (client *Client) KeyshareVerifyPin(pin string, schemeid irma.SchemeManagerIdentifier) (bool, int, int, error) {
-	scheme := client.Configuration.SchemeManagers[schemeid]
+	scheme := client.Configuration.SchemeManager(schemeid)
 	if scheme == nil || !scheme.Distributed() {
 		return false, 0, 0, &irma.SessionError{
 			Err:       errors.Errorf("Can't verify pin of scheme %s", schemeid.String()),
@@ -891,7 +1198,9 @@ func (client *Client) KeyshareVerifyPin(pin string, schemeid irma.SchemeManagerI
 			Info:      schemeid.String(),
 		}
 	}
+	client.lock.Lock()
 	kss := client.keyshareServers[schemeid]
+	client.lock.Unlock()
 	return verifyPinWorker(pin, kss, irma.NewHTTPTransport(scheme.KeyshareServer))
 }
 
@@ -905,12 +1214,14 @@ func (client *Client) KeyshareChangePin(manager irma.SchemeManagerIdentifier, ol
 }
 
 func (client *Client) keyshareChangePinWorker(managerID irma.SchemeManagerIdentifier, oldPin string, newPin string) error {
+	client.lock.Lock()
 	kss, ok := client.keyshareServers[managerID]
+	client.lock.Unlock()
 	if !ok {
 		return errors.New("Unknown keyshare server")
 	}
 
-	transport := irma.NewHTTPTransport(client.Configuration.SchemeManagers[managerID].KeyshareServer)
+	transport := irma.NewHTTPTransport(client.Configuration.SchemeManager(managerID).KeyshareServer)
 	message := keyshareChangepin{
 		Username: kss.Username,
 		OldPin:   kss.HashedPin(oldPin),
@@ -947,17 +1258,34 @@ func (client *Client) keyshareChangePinWorker(managerID irma.SchemeManagerIdenti
 
 // KeyshareRemove unenrolls the keyshare server of the specified scheme manager.
 func (client *Client) KeyshareRemove(manager irma.SchemeManagerIdentifier) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 	if _, contains := client.keyshareServers[manager]; !contains {
 		return errors.New("Can't uninstall unknown keyshare server")
 	}
 	delete(client.keyshareServers, manager)
-	return client.storage.StoreKeyshareServers(client.keyshareServers)
+	return client.storeKeyshareServers()
 }
 
 // KeyshareRemoveAll removes all keyshare server registrations.
 func (client *Client) KeyshareRemoveAll() error {
-	client.keyshareServers = map[irma.SchemeManagerIdentifier]*keyshareServer{}
-	return client.storage.StoreKeyshareServers(client.keyshareServers)
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.keyshareServers = map[irma.SchemeManagerIdentifier]*KeyshareServer{}
+	return client.storeKeyshareServers()
+}
+
+func (client *Client) storeKeyshareServers() error {
+	return client.transaction(func(tx StorageTransaction) error {
+		return tx.StoreKeyshareServers(client.keyshareServers)
+	})
+}
+
+// addLogEntry stores the specified log entry. The caller need not hold the lock of the client.
+func (client *Client) addLogEntry(entry *LogEntry) error {
+	return client.storage.Transaction(func(tx StorageTransaction) error {
+		return tx.AddLogEntry(entry)
+	})
 }
 
 // Add, load and store log entries
@@ -974,11 +1302,28 @@ func (client *Client) LoadLogsBefore(beforeIndex uint64, max int) ([]*LogEntry,
 	return client.storage.LoadLogsBefore(beforeIndex, max)
 }
 
+// storePreferences stores the specified preferences, and sets them as the preferences of the client
+// if that succeeds.
+func (client *Client) storePreferences(prefs Preferences) error {
+	err := client.storage.Transaction(func(tx StorageTransaction) error {
+		return tx.StorePreferences(prefs)
+	})
+	if err != nil {
+		return err
+	}
+	client.Preferences = prefs
+	return nil
+}
+
 // SetCrashReportingPreference toggles whether or not crash reports should be sent to Sentry.
 // Has effect only after restarting.
 func (client *Client) SetCrashReportingPreference(enable bool) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 	client.Preferences.EnableCrashReporting = enable
-	_ = client.storage.StorePreferences(client.Preferences)
+	_ = client.storage.Transaction(func(tx StorageTransaction) error {
+		return tx.StorePreferences(client.Preferences)
+	})
 	client.applyPreferences()
 }
 
@@ -998,6 +1343,8 @@ func (client *Client) ConfigurationUpdated(downloaded *irma.IrmaIdentifierSet) e
 	if downloaded == nil || len(downloaded.CredentialTypes) == 0 {
 		return nil
 	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
 
 	var contains bool
 	for id := range downloaded.CredentialTypes {
@@ -1006,7 +1353,7 @@ func (client *Client) ConfigurationUpdated(downloaded *irma.IrmaIdentifierSet) e
 		}
 		for i := range client.attributes[id] {
 			attrs := client.attributes[id][i].Ints
-			diff := len(client.Configuration.CredentialTypes[id].AttributeTypes) - (len(attrs) - 1)
+			diff := len(client.Configuration.CredentialType(id).AttributeTypes) - (len(attrs) - 1)
 			if diff <= 0 {
 				continue
 			}
@@ -1030,5 +1377,5 @@ func (client *Client) ConfigurationUpdated(downloaded *irma.IrmaIdentifierSet) e
 		}
 	}
 
-	return client.storage.StoreAttributes(client.attributes)
+	return client.transaction(client.storeAttributes)
 }
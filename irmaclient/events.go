@@ -0,0 +1,291 @@
+package irmaclient
+
+import (
+	"sync"
+
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains an alternative to the Handler interface for following sessions: a stream
+// of events sent over a channel, implemented as a Handler that converts its callbacks to events.
+
+// SessionEvent is an event of a session started with Client.NewSessionEvents(). It is one of
+// *StatusUpdateEvent, *PermissionRequestEvent, *SchemeManagerPermissionRequestEvent,
+// *PinRequestEvent, *SuccessEvent, *CancelledEvent, *FailureEvent, *UnsatisfiableRequestEvent
+// or *KeyshareEvent.
+type SessionEvent interface {
+	// Final returns whether or not the session ends with this event, i.e., whether this is
+	// the last event sent over the channel of the session.
+	Final() bool
+}
+
+// StatusUpdateEvent is sent when the status of the session changes.
+type StatusUpdateEvent struct {
+	Action irma.Action
+	Status irma.Status
+}
+
+// PermissionRequestEvent is sent when the session needs the permission of the user to continue.
+// Exactly one of its Approve() and Deny() methods must be called for the session to continue.
+type PermissionRequestEvent struct {
+	Action irma.Action
+	// Request is an *irma.DisclosureRequest, *irma.SignatureRequest or *irma.IssuanceRequest,
+	// depending on the Action
+	Request irma.SessionRequest
+	// Candidates are sorted by preference, like the candidates passed to the Handler
+	Candidates [][][]*irma.AttributeIdentifier
+	Requestor  *RequestorInfo
+
+	callback PermissionHandler
+	once     sync.Once
+}
+
+// SchemeManagerPermissionRequestEvent is sent when the user is asked to install a new scheme manager.
+// Exactly one of its Approve() and Deny() methods must be called for the session to continue.
+type SchemeManagerPermissionRequestEvent struct {
+	Manager *irma.SchemeManager
+
+	callback func(proceed bool)
+	once     sync.Once
+}
+
+// PinRequestEvent is sent when the PIN of the user is required by the keyshare server.
+// Exactly one of its Enter() and Cancel() methods must be called for the session to continue.
+type PinRequestEvent struct {
+	// RemainingAttempts is -1 on the first attempt
+	RemainingAttempts int
+
+	callback PinHandler
+	once     sync.Once
+}
+
+// SuccessEvent is sent when the session has succeeded.
+type SuccessEvent struct {
+	Result string
+}
+
+// CancelledEvent is sent when the session was cancelled, by the user or the server.
+type CancelledEvent struct{}
+
+// FailureEvent is sent when the session has failed.
+type FailureEvent struct {
+	Err *irma.SessionError
+}
+
+// UnsatisfiableRequestEvent is sent when the session request cannot be satisfied with the
+// credentials of the user.
+type UnsatisfiableRequestEvent struct {
+	Request    irma.SessionRequest
+	ServerName irma.TranslatedString
+	Missing    MissingAttributes
+}
+
+// KeyshareProblem is a problem with the keyshare server of a scheme manager.
+type KeyshareProblem string
+
+const (
+	KeyshareProblemBlocked              = KeyshareProblem("blocked")
+	KeyshareProblemEnrollmentIncomplete = KeyshareProblem("enrollmentIncomplete")
+	KeyshareProblemEnrollmentMissing    = KeyshareProblem("enrollmentMissing")
+	KeyshareProblemEnrollmentDeleted    = KeyshareProblem("enrollmentDeleted")
+)
+
+// KeyshareEvent is sent when the session failed because of a problem with the keyshare server
+// of the specified scheme manager.
+type KeyshareEvent struct {
+	Problem KeyshareProblem
+	Manager irma.SchemeManagerIdentifier
+	// Duration is the amount of seconds that the user is blocked, if the Problem is KeyshareProblemBlocked
+	Duration int
+}
+
+func (*StatusUpdateEvent) Final() bool                   { return false }
+func (*PermissionRequestEvent) Final() bool              { return false }
+func (*SchemeManagerPermissionRequestEvent) Final() bool { return false }
+func (*PinRequestEvent) Final() bool                     { return false }
+func (*SuccessEvent) Final() bool                        { return true }
+func (*CancelledEvent) Final() bool                      { return true }
+func (*FailureEvent) Final() bool                        { return true }
+func (*UnsatisfiableRequestEvent) Final() bool           { return true }
+func (*KeyshareEvent) Final() bool                       { return true }
+
+// Approve gives permission for the session, disclosing the specified choice of attributes.
+func (e *PermissionRequestEvent) Approve(choice *irma.DisclosureChoice) {
+	e.once.Do(func() { e.callback(true, choice) })
+}
+
+// Deny refuses permission for the session, cancelling it.
+func (e *PermissionRequestEvent) Deny() {
+	e.once.Do(func() { e.callback(false, nil) })
+}
+
+// ProposedChoice returns the choice consisting of the first candidate of each disjunction,
+// i.e. the most preferred choice (see Client.ProposeChoice()).
+func (e *PermissionRequestEvent) ProposedChoice() *irma.DisclosureChoice {
+	choice := &irma.DisclosureChoice{Attributes: [][]*irma.AttributeIdentifier{}}
+	for _, discon := range e.Candidates {
+		if len(discon) > 0 {
+			choice.Attributes = append(choice.Attributes, discon[0])
+		}
+	}
+	return choice
+}
+
+// Approve gives permission to install the scheme manager.
+func (e *SchemeManagerPermissionRequestEvent) Approve() {
+	e.once.Do(func() { e.callback(true) })
+}
+
+// Deny refuses permission to install the scheme manager, cancelling the session.
+func (e *SchemeManagerPermissionRequestEvent) Deny() {
+	e.once.Do(func() { e.callback(false) })
+}
+
+// Enter provides the PIN of the user to the keyshare server.
+func (e *PinRequestEvent) Enter(pin string) {
+	e.once.Do(func() { e.callback(true, pin) })
+}
+
+// Cancel refuses to provide the PIN, cancelling the session.
+func (e *PinRequestEvent) Cancel() {
+	e.once.Do(func() { e.callback(false, "") })
+}
+
+// NewSessionEvents starts a new IRMA session like NewSession(), returning a channel over which
+// the events of the session are sent instead of calling the methods of a Handler. The channel
+// is closed after the final event of the session (see SessionEvent.Final()); any callbacks
+// made by the session after that are ignored. The returned SessionDismisser is nil if the
+// session could not be started, in which case a *FailureEvent is sent.
+func (client *Client) NewSessionEvents(sessionrequest string) (<-chan SessionEvent, SessionDismisser) {
+	handler := newEventHandler()
+	return handler.events, client.NewSession(sessionrequest, handler)
+}
+
+// eventHandler is a Handler that sends its callbacks as SessionEvents over its channel.
+// As the session may call the Handler before NewSession() returns, and the receiver of the
+// channel should not be able to block the session, the events are queued and sent to the
+// channel from a separate goroutine.
+type eventHandler struct {
+	events chan SessionEvent
+	notify chan struct{}
+
+	lock  sync.Mutex
+	queue []SessionEvent
+	done  bool
+}
+
+var _ Handler = (*eventHandler)(nil)
+
+func newEventHandler() *eventHandler {
+	h := &eventHandler{
+		events: make(chan SessionEvent),
+		notify: make(chan struct{}, 1),
+	}
+	go h.forward()
+	return h
+}
+
+// send enqueues the specified event, unless the final event of the session has already been sent.
+func (h *eventHandler) send(event SessionEvent) {
+	h.lock.Lock()
+	if h.done {
+		h.lock.Unlock()
+		return
+	}
+	h.queue = append(h.queue, event)
+	h.done = event.Final()
+	h.lock.Unlock()
+
+	select {
+	case h.notify <- struct{}{}:
+	default: // the forwarding goroutine has yet to handle an earlier notification
+	}
+}
+
+// forward sends the queued events to the channel, closing it after the final event.
+func (h *eventHandler) forward() {
+	for range h.notify {
+		h.lock.Lock()
+		queue, done := h.queue, h.done
+		h.queue = nil
+		h.lock.Unlock()
+
+		for _, event := range queue {
+			h.events <- event
+		}
+		if done {
+			close(h.events)
+			return
+		}
+	}
+}
+
+func (h *eventHandler) StatusUpdate(action irma.Action, status irma.Status) {
+	h.send(&StatusUpdateEvent{Action: action, Status: status})
+}
+
+func (h *eventHandler) Success(result string) {
+	h.send(&SuccessEvent{Result: result})
+}
+
+func (h *eventHandler) Cancelled() {
+	h.send(&CancelledEvent{})
+}
+
+func (h *eventHandler) Failure(err *irma.SessionError) {
+	h.send(&FailureEvent{Err: err})
+}
+
+func (h *eventHandler) UnsatisfiableRequest(request irma.SessionRequest, serverName irma.TranslatedString, missing MissingAttributes) {
+	h.send(&UnsatisfiableRequestEvent{Request: request, ServerName: serverName, Missing: missing})
+}
+
+func (h *eventHandler) KeyshareBlocked(manager irma.SchemeManagerIdentifier, duration int) {
+	h.send(&KeyshareEvent{Problem: KeyshareProblemBlocked, Manager: manager, Duration: duration})
+}
+
+func (h *eventHandler) KeyshareEnrollmentIncomplete(manager irma.SchemeManagerIdentifier) {
+	h.send(&KeyshareEvent{Problem: KeyshareProblemEnrollmentIncomplete, Manager: manager})
+}
+
+func (h *eventHandler) KeyshareEnrollmentMissing(manager irma.SchemeManagerIdentifier) {
+	h.send(&KeyshareEvent{Problem: KeyshareProblemEnrollmentMissing, Manager: manager})
+}
+
+func (h *eventHandler) KeyshareEnrollmentDeleted(manager irma.SchemeManagerIdentifier) {
+	h.send(&KeyshareEvent{Problem: KeyshareProblemEnrollmentDeleted, Manager: manager})
+}
+
+func (h *eventHandler) RequestIssuancePermission(request *irma.IssuanceRequest,
+	candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
+	h.requestPermission(irma.ActionIssuing, request, candidates, requestor, callback)
+}
+
+func (h *eventHandler) RequestVerificationPermission(request *irma.DisclosureRequest,
+	candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
+	h.requestPermission(irma.ActionDisclosing, request, candidates, requestor, callback)
+}
+
+func (h *eventHandler) RequestSignaturePermission(request *irma.SignatureRequest,
+	candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
+	h.requestPermission(irma.ActionSigning, request, candidates, requestor, callback)
+}
+
+func (h *eventHandler) requestPermission(action irma.Action, request irma.SessionRequest,
+	candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
+	h.send(&PermissionRequestEvent{
+		Action:     action,
+		Request:    request,
+		Candidates: candidates,
+		Requestor:  requestor,
+		callback:   callback,
+	})
+}
+
+func (h *eventHandler) RequestSchemeManagerPermission(manager *irma.SchemeManager, callback func(proceed bool)) {
+	h.send(&SchemeManagerPermissionRequestEvent{Manager: manager, callback: callback})
+}
+
+func (h *eventHandler) RequestPin(remainingAttempts int, callback PinHandler) {
+	h.send(&PinRequestEvent{RemainingAttempts: remainingAttempts, callback: callback})
+}
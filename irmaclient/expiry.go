@@ -0,0 +1,164 @@
+package irmaclient
+
+import (
+	"sort"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains the expiry monitor of a Client, which reports credentials that are about
+// to expire and optionally removes expired credentials.
+
+// ExpiryCheckInterval is the interval at which a Client checks the expiry of its credentials,
+// in addition to the check right after it is created. Setting it to 0 disables the periodic checks.
+var ExpiryCheckInterval = 12 * time.Hour
+
+// ExpiringCredential is a credential that expires within the expiry warning window
+// of the Client (see Preferences), or that has already expired.
+type ExpiringCredential struct {
+	*irma.CredentialInfo
+	// IssueURL is where the credential can be renewed, if specified by its credential type.
+	IssueURL irma.TranslatedString
+}
+
+// SetExpiryPreferences sets the amount of days in advance that credentials about to expire are
+// reported to the ClientHandler (0 to report expired credentials only), and whether or not expired
+// credentials are removed automatically. The credentials are checked immediately.
+func (client *Client) SetExpiryPreferences(warningDays int, removeExpired bool) error {
+	if warningDays < 0 {
+		return errors.New("Expiry warning window must not be negative")
+	}
+	client.lock.Lock()
+	prefs := client.Preferences
+	prefs.ExpiryWarningDays = warningDays
+	prefs.RemoveExpiredCredentials = removeExpired
+	err := client.storePreferences(prefs)
+	client.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return client.CheckExpiry()
+}
+
+// CheckExpiry removes the expired credentials if enabled in the preferences, and reports the
+// credentials expiring within the expiry warning window to the ClientHandler, if any.
+func (client *Client) CheckExpiry() error {
+	client.lock.Lock()
+	removed, err := client.removeExpired()
+	var expiring []*ExpiringCredential
+	if err == nil {
+		expiring = client.expiringCredentials()
+	}
+	client.lock.Unlock()
+
+	// Call the handler only after releasing the lock, so that it may use the client
+	if removed {
+		client.handler.UpdateAttributes()
+	}
+	if err != nil || len(expiring) == 0 {
+		return err
+	}
+	client.handler.CredentialsExpiring(expiring)
+	return nil
+}
+
+// expiringCredentials returns the credentials expiring within the expiry warning window,
+// the credentials that expire first first.
+func (client *Client) expiringCredentials() []*ExpiringCredential {
+	deadline := irma.Timestamp(time.Now().AddDate(0, 0, client.Preferences.ExpiryWarningDays))
+	var expiring []*ExpiringCredential
+	for _, info := range client.credentialInfoList() {
+		if !info.Expires.Before(deadline) {
+			continue
+		}
+		cred := &ExpiringCredential{CredentialInfo: info}
+		if credtype := info.GetCredentialType(client.Configuration); credtype != nil {
+			cred.IssueURL = credtype.IssueURL
+		}
+		expiring = append(expiring, cred)
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].Expires.Before(expiring[j].Expires)
+	})
+	return expiring
+}
+
+// removeExpired removes all expired credentials if enabled in the preferences, along with a
+// log entry of the removed credentials. It returns whether or not any credentials were removed.
+func (client *Client) removeExpired() (bool, error) {
+	if !client.Preferences.RemoveExpiredCredentials {
+		return false, nil
+	}
+	expired := map[irma.CredentialTypeIdentifier][]*irma.AttributeList{}
+	for id, list := range client.attributes {
+		for _, attrs := range list {
+			// Credentials of unknown credential types are left alone, like in RepairIntegrity()
+			if attrs.CredentialType() != nil && !attrs.MetadataAttribute.IsValid() {
+				expired[id] = append(expired[id], attrs)
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return false, nil
+	}
+
+	err := client.transaction(func(tx StorageTransaction) error {
+		return client.removeCredentials(tx, expired)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// startExpiryMonitor checks the expiry of the credentials in the background, once immediately
+// and then periodically until Close() is called.
+func (client *Client) startExpiryMonitor() {
+	interval := ExpiryCheckInterval
+	stop, done := make(chan struct{}), make(chan struct{})
+	client.expiryMonitorStop, client.expiryMonitorDone = stop, done
+	go func() {
+		defer close(done)
+		check := func() {
+			if err := client.CheckExpiry(); err != nil {
+				irma.Logger.Warn(errors.WrapPrefix(err, "Failed to check credential expiry", 0).ErrorStack())
+			}
+		}
+		check()
+		if interval == 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				check()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background activities of the client, i.e. the expiry monitor, and releases
+// its storage. The client must not be used afterwards, and Close must not be called from
+// within the ClientHandler.
+func (client *Client) Close() error {
+	client.lock.Lock()
+	stop, done := client.expiryMonitorStop, client.expiryMonitorDone
+	client.expiryMonitorStop = nil
+	client.lock.Unlock()
+
+	// Wait for a running check to finish, as it may use the storage
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.storage.Close()
+}
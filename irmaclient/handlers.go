@@ -10,7 +10,7 @@ import (
 type keyshareEnrollmentHandler struct {
 	pin    string
 	client *Client
-	kss    *keyshareServer
+	kss    *KeyshareServer
 }
 
 // Force keyshareEnrollmentHandler to implement the Handler interface
@@ -18,7 +18,7 @@ var _ Handler = (*keyshareEnrollmentHandler)(nil)
 
 // Session handlers in the order they are called
 
-func (h *keyshareEnrollmentHandler) RequestIssuancePermission(request *irma.IssuanceRequest, candidates [][][]*irma.AttributeIdentifier, ServerName irma.TranslatedString, callback PermissionHandler) {
+func (h *keyshareEnrollmentHandler) RequestIssuancePermission(request *irma.IssuanceRequest, candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
 	// Fetch the username from the credential request and save it along with the scheme manager
 	for _, attr := range request.Credentials[0].Attributes {
 		h.kss.Username = attr
@@ -38,7 +38,9 @@ func (h *keyshareEnrollmentHandler) RequestPin(remainingAttempts int, callback P
 }
 
 func (h *keyshareEnrollmentHandler) Success(result string) {
-	_ = h.client.storage.StoreKeyshareServers(h.client.keyshareServers) // TODO handle err?
+	h.client.lock.Lock()
+	_ = h.client.storeKeyshareServers() // TODO handle err?
+	h.client.lock.Unlock()
 	h.client.handler.EnrollmentSuccess(h.kss.SchemeManagerIdentifier)
 }
 
@@ -48,7 +50,9 @@ func (h *keyshareEnrollmentHandler) Failure(err *irma.SessionError) {
 
 // fail is a helper to ensure the kss is removed from the client in case of any problem
 func (h *keyshareEnrollmentHandler) fail(err error) {
+	h.client.lock.Lock()
 	delete(h.client.keyshareServers, h.kss.SchemeManagerIdentifier)
+	h.client.lock.Unlock()
 	h.client.handler.EnrollmentFailure(h.kss.SchemeManagerIdentifier, err)
 }
 
@@ -56,10 +60,10 @@ func (h *keyshareEnrollmentHandler) fail(err error) {
 func (h *keyshareEnrollmentHandler) StatusUpdate(action irma.Action, status irma.Status) {}
 
 // The methods below should never be called, so we let each of them fail the session
-func (h *keyshareEnrollmentHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, ServerName irma.TranslatedString, callback PermissionHandler) {
+func (h *keyshareEnrollmentHandler) RequestVerificationPermission(request *irma.DisclosureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
 	callback(false, nil)
 }
-func (h *keyshareEnrollmentHandler) RequestSignaturePermission(request *irma.SignatureRequest, candidates [][][]*irma.AttributeIdentifier, ServerName irma.TranslatedString, callback PermissionHandler) {
+func (h *keyshareEnrollmentHandler) RequestSignaturePermission(request *irma.SignatureRequest, candidates [][][]*irma.AttributeIdentifier, requestor *RequestorInfo, callback PermissionHandler) {
 	callback(false, nil)
 }
 func (h *keyshareEnrollmentHandler) RequestSchemeManagerPermission(manager *irma.SchemeManager, callback func(proceed bool)) {
@@ -0,0 +1,196 @@
+package irmaclient
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/privacybydesign/gabi/big"
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains the integrity check of the stored credentials of a Client.
+
+// IntegrityProblem is the kind of an IntegrityIssue.
+type IntegrityProblem string
+
+const (
+	// IntegrityOrphanSignature is a stored signature without attributes.
+	IntegrityOrphanSignature = IntegrityProblem("orphanSignature")
+	// IntegrityMissingSignature is a credential whose signature is not stored.
+	IntegrityMissingSignature = IntegrityProblem("missingSignature")
+	// IntegrityUnknownCredentialType is a credential whose credential type is not in the configuration.
+	IntegrityUnknownCredentialType = IntegrityProblem("unknownCredentialType")
+	// IntegrityUnknownPublicKey is a credential whose issuer public key is not in the configuration.
+	IntegrityUnknownPublicKey = IntegrityProblem("unknownPublicKey")
+	// IntegrityInvalidSignature is a credential whose signature does not verify against its issuer public key.
+	IntegrityInvalidSignature = IntegrityProblem("invalidSignature")
+	// IntegrityDuplicateSingleton is an instance of a singleton credential type of which the client
+	// has more than one instance, other than the newest instance without any other problem.
+	IntegrityDuplicateSingleton = IntegrityProblem("duplicateSingleton")
+)
+
+// IntegrityIssue is an inconsistency in the stored credentials of a Client.
+type IntegrityIssue struct {
+	Problem        IntegrityProblem
+	CredentialType irma.CredentialTypeIdentifier
+	Hash           string // Hash of the attributes of the credential or signature concerned
+	Repaired       bool
+}
+
+func (issue *IntegrityIssue) String() string {
+	s := string(issue.Problem) + " " + issue.Hash
+	if !issue.CredentialType.Empty() {
+		s = fmt.Sprintf("%s (%s)", s, issue.CredentialType)
+	}
+	if issue.Repaired {
+		s += ": repaired"
+	}
+	return s
+}
+
+// repairable returns whether the issue can be repaired by removing the credential or signature
+// concerned. Credentials of unknown credential types or public keys are left alone, as these may
+// become known again when the configuration is updated.
+func (issue *IntegrityIssue) repairable() bool {
+	return issue.Problem != IntegrityUnknownCredentialType && issue.Problem != IntegrityUnknownPublicKey
+}
+
+// CheckIntegrity returns the inconsistencies in the stored credentials of the client (e.g.
+// missing, orphaned or invalid signatures), without changing anything.
+func (client *Client) CheckIntegrity() ([]*IntegrityIssue, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	issues, _, err := client.checkIntegrity()
+	return issues, err
+}
+
+// RepairIntegrity checks the integrity of the stored credentials of the client like CheckIntegrity,
+// and repairs the issues found where possible by removing the credentials and signatures concerned,
+// along with a log entry of the removed credentials. Credentials of unknown credential types or
+// with unknown public keys are not removed. The issues that were repaired have their Repaired
+// field set.
+func (client *Client) RepairIntegrity() ([]*IntegrityIssue, error) {
+	client.lock.Lock()
+	issues, removed, err := client.repairIntegrity()
+	client.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if removed {
+		client.handler.UpdateAttributes()
+	}
+	return issues, nil
+}
+
+// repairIntegrity repairs the integrity issues, returning whether or not credentials were removed.
+func (client *Client) repairIntegrity() ([]*IntegrityIssue, bool, error) {
+	issues, attrs, err := client.checkIntegrity()
+	if err != nil {
+		return nil, false, err
+	}
+
+	creds := map[irma.CredentialTypeIdentifier][]*irma.AttributeList{}
+	err = client.transaction(func(tx StorageTransaction) error {
+		for _, issue := range issues {
+			if !issue.repairable() {
+				continue
+			}
+			if issue.Problem == IntegrityOrphanSignature {
+				if err := tx.DeleteSignature(issue.Hash); err != nil {
+					return err
+				}
+				continue
+			}
+			creds[issue.CredentialType] = append(creds[issue.CredentialType], attrs[issue])
+		}
+		return client.removeCredentials(tx, creds)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, issue := range issues {
+		issue.Repaired = issue.repairable()
+	}
+	return issues, len(creds) > 0, nil
+}
+
+// checkIntegrity returns the integrity issues, along with the attributes of the credentials that
+// the issues concern.
+func (client *Client) checkIntegrity() ([]*IntegrityIssue, map[*IntegrityIssue]*irma.AttributeList, error) {
+	var issues []*IntegrityIssue
+	attrs := map[*IntegrityIssue]*irma.AttributeList{}
+	hashes := map[string]struct{}{}
+	add := func(problem IntegrityProblem, id irma.CredentialTypeIdentifier, al *irma.AttributeList) {
+		issue := &IntegrityIssue{Problem: problem, CredentialType: id, Hash: al.Hash()}
+		issues = append(issues, issue)
+		attrs[issue] = al
+	}
+
+	// Iterate over the credential types in a fixed order so that the issues are deterministic
+	ids := make([]irma.CredentialTypeIdentifier, 0, len(client.attributes))
+	for id := range client.attributes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	for _, id := range ids {
+		list := client.attributes[id]
+		problems := make([]IntegrityProblem, len(list))
+		newestValid := -1 // Credentials are appended when issued, so later instances are newer
+		for index, al := range list {
+			hashes[al.Hash()] = struct{}{}
+			problem, err := client.checkCredential(al)
+			if err != nil {
+				return nil, nil, err
+			}
+			problems[index] = problem
+			if problem == "" {
+				newestValid = index
+			}
+		}
+		for index, al := range list {
+			switch {
+			case problems[index] != "":
+				add(problems[index], id, al)
+			case al.CredentialType().IsSingleton && index != newestValid:
+				add(IntegrityDuplicateSingleton, id, al)
+			}
+		}
+	}
+
+	stored, err := client.storage.LoadSignatureHashes()
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(stored)
+	for _, hash := range stored {
+		if _, ok := hashes[hash]; !ok {
+			issues = append(issues, &IntegrityIssue{Problem: IntegrityOrphanSignature, Hash: hash})
+		}
+	}
+
+	return issues, attrs, nil
+}
+
+// checkCredential returns the problem with the credential having the specified attributes, if any.
+func (client *Client) checkCredential(al *irma.AttributeList) (IntegrityProblem, error) {
+	if al.CredentialType() == nil {
+		return IntegrityUnknownCredentialType, nil
+	}
+	sig, err := client.storage.LoadSignature(al)
+	if err != nil {
+		return "", err
+	}
+	if sig == nil {
+		return IntegrityMissingSignature, nil
+	}
+	pk, err := al.PublicKey()
+	if err != nil || pk == nil {
+		return IntegrityUnknownPublicKey, nil
+	}
+	if !sig.Verify(pk, append([]*big.Int{client.secretkey.Key}, al.Ints...)) {
+		return IntegrityInvalidSignature, nil
+	}
+	return "", nil
+}
@@ -1,14 +1,24 @@
 package irmaclient
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
+	gobig "math/big"
 
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/gabi/big"
 	"github.com/privacybydesign/irmago"
 	"github.com/privacybydesign/irmago/internal/fs"
 	"github.com/privacybydesign/irmago/internal/test"
@@ -36,6 +46,7 @@ func parseStorage(t *testing.T) *Client {
 		filepath.Join("..", "testdata", "irma_configuration"),
 		"",
 		&TestClientHandler{t: t},
+		nil,
 	)
 	require.NoError(t, err)
 	return client
@@ -97,6 +108,410 @@ func TestStorageDeserialization(t *testing.T) {
 	verifyClientIsUnmarshaled(t, client)
 	verifyCredentials(t, client)
 	verifyKeyshareIsUnmarshaled(t, client)
+
+	// The files of the test storage should have been moved into the database
+	for _, file := range []string{skFile, attributesFile, kssFile, signaturesDir} {
+		exists, err := fs.PathExists(filepath.Join("..", "testdata", "storage", "test", file))
+		require.NoError(t, err)
+		require.False(t, exists, "%s was not removed", file)
+	}
+}
+
+func TestFailedMigration(t *testing.T) {
+	test.SetupTestStorage(t)
+	defer test.ClearTestStorage(t)
+	storagePath := filepath.Join("..", "testdata", "storage", "test")
+	require.NoError(t, fs.CopyDirectory(filepath.Join("..", "testdata", "teststorage"), storagePath))
+	newClient := func() (*Client, error) {
+		return New(storagePath, filepath.Join("..", "testdata", "irma_configuration"), "", &TestClientHandler{t: t}, nil)
+	}
+
+	// Make the migration of the files into the database fail by corrupting a signature
+	infos, err := ioutil.ReadDir(filepath.Join(storagePath, signaturesDir))
+	require.NoError(t, err)
+	require.NotEmpty(t, infos)
+	sigpath := filepath.Join(storagePath, signaturesDir, infos[0].Name())
+	sig, err := ioutil.ReadFile(sigpath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(sigpath, []byte("corrupted"), 0600))
+	_, err = newClient()
+	require.Error(t, err)
+
+	// The failed migration is performed again on the next start, instead of being skipped
+	_, err = newClient()
+	require.Error(t, err)
+	exists, err := fs.PathExists(filepath.Join(storagePath, skFile))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// No new secret key is generated while the old one has not been migrated
+	s := &boltStorage{storagePath: storagePath}
+	require.NoError(t, s.EnsureStorageExists())
+	require.Error(t, (&Client{storage: s}).loadSecretKey())
+	sk, err := s.LoadSecretKey()
+	require.NoError(t, err)
+	require.Nil(t, sk)
+	require.NoError(t, s.Close())
+
+	// Once the migration succeeds, the existing credentials are usable
+	require.NoError(t, ioutil.WriteFile(sigpath, sig, 0600))
+	client, err := newClient()
+	require.NoError(t, err)
+	verifyClientIsUnmarshaled(t, client)
+	verifyCredentials(t, client)
+}
+
+func TestOpen(t *testing.T) {
+	test.SetupTestStorage(t)
+	defer test.ClearTestStorage(t)
+	storagePath := filepath.Join("..", "testdata", "storage", "test")
+	confPath := filepath.Join("..", "testdata", "irma_configuration")
+	require.NoError(t, fs.CopyDirectory(filepath.Join("..", "testdata", "teststorage"), storagePath))
+
+	// Storage that has not been migrated is not opened
+	_, err := Open(storagePath, confPath, &TestClientHandler{t: t})
+	require.Error(t, err)
+	exists, err := fs.PathExists(filepath.Join(storagePath, skFile))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	client, err := New(storagePath, confPath, "", &TestClientHandler{t: t}, nil)
+	require.NoError(t, err)
+	creds := client.CredentialInfoList()
+	logs, err := client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	// Once migrated, the storage is opened as is
+	client, err = Open(storagePath, confPath, &TestClientHandler{t: t})
+	require.NoError(t, err)
+	require.Nil(t, client.expiryMonitorStop)
+	require.ElementsMatch(t, creds, client.CredentialInfoList())
+	opened, err := client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Len(t, opened, len(logs))
+	issues, err := client.CheckIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, issues)
+	verifyCredentials(t, client)
+	require.NoError(t, client.Close())
+}
+
+func TestFailedTransaction(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	id := irma.NewCredentialTypeIdentifier("irma-demo.RU.studentCard")
+	err := client.transaction(func(tx StorageTransaction) error {
+		_, err := client.remove(tx, id, 0)
+		require.NoError(t, err)
+		require.NoError(t, client.storeAttributes(tx))
+		return errors.New("test")
+	})
+	require.Error(t, err)
+
+	// Both the attributes and the signature of the credential should still be present
+	require.Len(t, client.attrs(id), 1)
+	verifyClientIsUnmarshaled(t, client)
+	verifyCredentials(t, client)
+}
+
+func TestIntegrity(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	issues, err := client.CheckIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, issues)
+
+	studentCardID := irma.NewCredentialTypeIdentifier("irma-demo.RU.studentCard")
+	mijnirmaID := irma.NewCredentialTypeIdentifier("test.test.mijnirma")
+	studentCard := client.attrs(studentCardID)[0]
+	mijnirma := client.attrs(mijnirmaID)[0]
+	sig, err := client.storage.LoadSignature(studentCard)
+	require.NoError(t, err)
+	ints := append([]*big.Int{}, studentCard.Ints...)
+	ints[1] = big.NewInt(42)
+	orphan := irma.NewAttributeListFromInts(ints, client.Configuration)
+
+	// Delete the signature of one credential, replace that of another one,
+	// and store a signature without credential
+	require.NoError(t, client.storage.Transaction(func(tx StorageTransaction) error {
+		if err := tx.DeleteSignature(studentCard.Hash()); err != nil {
+			return err
+		}
+		if err := tx.StoreSignature(mijnirma, sig); err != nil {
+			return err
+		}
+		return tx.StoreSignature(orphan, sig)
+	}))
+	client.credentialsCache = make(map[irma.CredentialTypeIdentifier]map[int]*credential)
+
+	expected := []*IntegrityIssue{
+		{Problem: IntegrityMissingSignature, CredentialType: studentCardID, Hash: studentCard.Hash()},
+		{Problem: IntegrityInvalidSignature, CredentialType: mijnirmaID, Hash: mijnirma.Hash()},
+		{Problem: IntegrityOrphanSignature, Hash: orphan.Hash()},
+	}
+	issues, err = client.CheckIntegrity()
+	require.NoError(t, err)
+	require.Equal(t, expected, issues)
+
+	for _, issue := range expected {
+		issue.Repaired = true
+	}
+	issues, err = client.RepairIntegrity()
+	require.NoError(t, err)
+	require.Equal(t, expected, issues)
+	require.Empty(t, client.attrs(studentCardID))
+	require.Empty(t, client.attrs(mijnirmaID))
+
+	issues, err = client.CheckIntegrity()
+	require.NoError(t, err)
+	require.Empty(t, issues)
+	logs, err := client.LoadNewestLogs(1)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Len(t, logs[0].Removed, 2)
+}
+
+func TestIntegritySingleton(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	// Add two newer instances of a singleton credential type with invalid signatures
+	id := irma.NewCredentialTypeIdentifier("test.test.mijnirma")
+	require.Len(t, client.attrs(id), 1)
+	valid := client.attrs(id)[0]
+	sig, err := client.storage.LoadSignature(valid)
+	require.NoError(t, err)
+	var invalid []*irma.AttributeList
+	for _, i := range []int64{42, 43} {
+		ints := append([]*big.Int{}, valid.Ints...)
+		ints[1] = big.NewInt(i)
+		invalid = append(invalid, irma.NewAttributeListFromInts(ints, client.Configuration))
+	}
+	require.NoError(t, client.transaction(func(tx StorageTransaction) error {
+		for _, al := range invalid {
+			client.attributes[id] = append(client.attributes[id], al)
+			if err := tx.StoreSignature(al, sig); err != nil {
+				return err
+			}
+		}
+		return client.storeAttributes(tx)
+	}))
+
+	// The older, valid instance is kept instead of being considered a duplicate
+	issues, err := client.RepairIntegrity()
+	require.NoError(t, err)
+	require.Equal(t, []*IntegrityIssue{
+		{Problem: IntegrityInvalidSignature, CredentialType: id, Hash: invalid[0].Hash(), Repaired: true},
+		{Problem: IntegrityInvalidSignature, CredentialType: id, Hash: invalid[1].Hash(), Repaired: true},
+	}, issues)
+	require.Equal(t, []*irma.AttributeList{valid}, client.attrs(id))
+	verifyCredentials(t, client)
+
+	// Both removed instances are logged
+	logs, err := client.LoadNewestLogs(1)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, append(invalid[0].Strings(), invalid[1].Strings()...), logs[0].Removed[id])
+}
+
+func TestMemoryStorage(t *testing.T) {
+	fileclient := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	storage := NewMemoryStorage()
+	require.NoError(t, storage.Transaction(func(tx StorageTransaction) error {
+		if err := tx.StoreSecretKey(fileclient.secretkey); err != nil {
+			return err
+		}
+		return tx.StoreKeyshareServers(fileclient.keyshareServers)
+	}))
+	newClient := func() *Client {
+		client, err := New(
+			filepath.Join("..", "testdata", "storage", "test"),
+			filepath.Join("..", "testdata", "irma_configuration"),
+			"",
+			&TestClientHandler{t: t},
+			storage,
+		)
+		require.NoError(t, err)
+		return client
+	}
+
+	// Copy the credentials of the client using the default storage
+	client := newClient()
+	require.Empty(t, client.CredentialInfoList())
+	require.NoError(t, client.transaction(func(tx StorageTransaction) error {
+		for id, attrlistlist := range fileclient.attributes {
+			for index := range attrlistlist {
+				cred, err := fileclient.credential(id, index)
+				require.NoError(t, err)
+				require.NoError(t, client.addCredential(tx, cred))
+			}
+		}
+		return client.storeAttributes(tx)
+	}))
+
+	// A new client using the same storage should find everything
+	client = newClient()
+	verifyClientIsUnmarshaled(t, client)
+	verifyCredentials(t, client)
+	verifyKeyshareIsUnmarshaled(t, client)
+
+	require.NoError(t, client.RemoveCredential(irma.NewCredentialTypeIdentifier("irma-demo.RU.studentCard"), 0))
+	require.NoError(t, client.RemoveAllCredentials())
+	logs, err := newClient().LoadNewestLogs(10)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, uint64(2), logs[0].ID)
+	logs, err = client.LoadLogsBefore(logs[0].ID, 10)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, uint64(1), logs[0].ID)
+}
+
+func TestCredentialViews(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	// The views are sorted by credential type and then by signing date, in the same order every time
+	views := client.CredentialViews()
+	require.Len(t, views, len(client.CredentialInfoList()))
+	for i := 1; i < len(views); i++ {
+		prev, cur := views[i-1], views[i]
+		require.True(t, prev.ID.String() <= cur.ID.String())
+		if prev.ID == cur.ID {
+			require.False(t, cur.SignedOn.Before(prev.SignedOn))
+		}
+	}
+	for i := 0; i < 5; i++ {
+		require.Equal(t, views, client.CredentialViews())
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	interval := ExpiryCheckInterval
+	ExpiryCheckInterval = 0
+	defer func() { ExpiryCheckInterval = interval }()
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+	handler := client.handler.(*TestClientHandler)
+	count := len(client.CredentialInfoList())
+	require.NotZero(t, count)
+
+	// The first check is done in the background after New() has returned
+	<-client.expiryMonitorDone
+	require.Equal(t, client.expiringCredentials(), handler.expiring)
+
+	// With a large enough window all credentials are reported, the first to expire first
+	require.NoError(t, client.SetExpiryPreferences(100000, false))
+	require.Len(t, handler.expiring, count)
+	for i, cred := range handler.expiring {
+		if i > 0 {
+			require.False(t, cred.Expires.Before(handler.expiring[i-1].Expires))
+		}
+		if cred.ID == "studentCard" {
+			require.Equal(t, cred.GetCredentialType(client.Configuration).IssueURL, cred.IssueURL)
+		}
+	}
+
+	// Expired credentials are removed along with a removal log entry
+	var expired int
+	for _, cred := range handler.expiring {
+		if cred.IsExpired() {
+			expired++
+		}
+	}
+	handler.expiring = nil
+	require.NoError(t, client.SetExpiryPreferences(0, true))
+	require.Len(t, client.CredentialInfoList(), count-expired)
+	require.Empty(t, handler.expiring)
+	if expired > 0 {
+		logs, err := client.LoadNewestLogs(1)
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		require.Equal(t, ActionRemoval, logs[0].Type)
+	}
+}
+
+// addTestLogEntry stores a log entry of the specified age in days, disclosing the studentID attribute
+// if disclose is true and a removal log entry otherwise.
+func addTestLogEntry(t *testing.T, client *Client, days int, disclose bool) {
+	entry := &LogEntry{
+		Type: ActionRemoval,
+		Time: irma.Timestamp(time.Now().AddDate(0, 0, -days)),
+	}
+	if disclose {
+		attrtype := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+		request := irma.NewDisclosureRequest(attrtype)
+		candidates, missing := client.Candidates(request.Disclose[0])
+		require.Empty(t, missing)
+		disclosure, _, err := client.Proofs(&irma.DisclosureChoice{Attributes: candidates}, request)
+		require.NoError(t, err)
+		entry.Type = irma.ActionDisclosing
+		entry.Disclosure = disclosure
+		entry.request = request
+		require.NoError(t, entry.setSessionRequest())
+	}
+	require.NoError(t, client.addLogEntry(entry))
+}
+
+func TestLogRetention(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+	require.NoError(t, client.DeleteAllLogEntries())
+
+	for _, days := range []int{10, 8, 6, 4, 2, 0} {
+		addTestLogEntry(t, client, days, days%4 == 0)
+	}
+	logs, err := client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Len(t, logs, 6)
+
+	// Delete the entry of 2 days ago
+	require.NoError(t, client.DeleteLogEntry(logs[1].ID))
+	logs, err = client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Len(t, logs, 5)
+
+	// Strip the proofs of the disclosure of 4 days ago, keeping the summary
+	require.NoError(t, client.SetLogRetention(LogRetention{StripProofsAfterDays: 3}))
+	logs, err = client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Len(t, logs, 5)
+	require.False(t, logs[0].Stripped)
+	require.NotNil(t, logs[0].Disclosure)
+	require.True(t, logs[1].Stripped)
+	require.Nil(t, logs[1].Disclosure)
+	disclosed, err := logs[1].GetDisclosedCredentials(client.Configuration)
+	require.NoError(t, err)
+	require.Len(t, disclosed, 1)
+	require.Equal(t, "456", disclosed[0][0].Value["en"])
+
+	// The preferences are stored
+	prefs, err := client.storage.LoadPreferences()
+	require.NoError(t, err)
+	require.Equal(t, 3, prefs.LogRetention.StripProofsAfterDays)
+
+	// Delete the entries older than 7 days
+	require.NoError(t, client.SetLogRetention(LogRetention{MaxAgeDays: 7}))
+	logs, err = client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Len(t, logs, 3)
+
+	// Keep only the newest 2 entries
+	require.NoError(t, client.SetLogRetention(LogRetention{MaxEntries: 2}))
+	logs, err = client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, irma.ActionDisclosing, logs[0].Type)
+
+	require.NoError(t, client.DeleteAllLogEntries())
+	logs, err = client.LoadNewestLogs(100)
+	require.NoError(t, err)
+	require.Empty(t, logs)
 }
 
 // TestCandidates tests the correctness of the function of the client that, given a disjunction of attributes
@@ -156,6 +571,121 @@ func TestCandidates(t *testing.T) {
 	require.Empty(t, attrs)
 }
 
+func TestProposeChoice(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	studentid := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	condiscon := irma.AttributeConDisCon{
+		irma.AttributeDisCon{
+			irma.AttributeCon{irma.AttributeRequest{Type: studentid}},
+			irma.AttributeCon{},
+		},
+	}
+	hostname := "example.com"
+
+	// Without disclosure rule, disclosing nothing is preferred in optional disjunctions
+	candidates, missing := client.CheckSatisfiability(condiscon)
+	require.Empty(t, missing)
+	require.Len(t, candidates[0], 2)
+	choice, remembered := client.ProposeChoice(hostname, candidates)
+	require.False(t, remembered)
+	require.Empty(t, candidates[0][0])
+	require.Equal(t, [][]*irma.AttributeIdentifier{{}}, choice.Attributes)
+
+	// Remember disclosing the studentID
+	require.NoError(t, client.SetDisclosureRule(hostname, &irma.DisclosureChoice{
+		Attributes: [][]*irma.AttributeIdentifier{candidates[0][1]},
+	}, true))
+	prefs, err := client.storage.LoadPreferences()
+	require.NoError(t, err)
+	require.Len(t, prefs.DisclosureRules, 1)
+	require.True(t, client.DisclosureRule(hostname).AutoApprove)
+	require.True(t, client.DisclosureRule("EXAMPLE.com").AutoApprove)
+
+	candidates, _ = client.CheckSatisfiability(condiscon)
+	choice, remembered = client.ProposeChoice(hostname, candidates)
+	require.True(t, remembered)
+	require.Len(t, choice.Attributes[0], 1)
+	require.Equal(t, studentid, choice.Attributes[0][0].Type)
+	require.Empty(t, candidates[0][1])
+
+	// The rule does not apply to other hostnames
+	candidates, _ = client.CheckSatisfiability(condiscon)
+	_, remembered = client.ProposeChoice("www.example.com", candidates)
+	require.False(t, remembered)
+
+	require.NoError(t, client.RemoveDisclosureRule(hostname))
+	require.Nil(t, client.DisclosureRule(hostname))
+	candidates, _ = client.CheckSatisfiability(condiscon)
+	_, remembered = client.ProposeChoice(hostname, candidates)
+	require.False(t, remembered)
+}
+
+func TestSignedSessionPolicy(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	studentid := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	request := irma.NewDisclosureRequest(studentid)
+	require.NoError(t, client.checkSessionPolicies("example.com", request))
+
+	// Write a policy file blocking subdomains of example.com, and its signature
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	policy, err := json.Marshal(&SessionPolicy{
+		Rules: []*SessionPolicyRule{{Hostname: "*.example.com", Block: true}},
+	})
+	require.NoError(t, err)
+	hash := sha256.Sum256(policy)
+	r, s, err := ecdsa.Sign(rand.Reader, sk, hash[:])
+	require.NoError(t, err)
+	sig, err := asn1.Marshal([]*gobig.Int{r, s})
+	require.NoError(t, err)
+	path := filepath.Join(test.FindTestdataFolder(t), "storage", "test", "policy.json")
+	require.NoError(t, ioutil.WriteFile(path, policy, 0600))
+	require.NoError(t, ioutil.WriteFile(path+".sig", sig, 0600))
+
+	// A policy signed by another key is rejected
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	require.Error(t, client.LoadSignedSessionPolicy(path, &other.PublicKey))
+	require.NoError(t, client.checkSessionPolicies("www.example.com", request))
+
+	require.NoError(t, client.LoadSignedSessionPolicy(path, &sk.PublicKey))
+	require.Error(t, client.checkSessionPolicies("www.example.com", request))
+	require.NoError(t, client.checkSessionPolicies("example.com", request))
+	// Manual sessions are not restricted
+	require.NoError(t, client.checkSessionPolicies("", request))
+}
+
+func TestSessionPolicyAttributes(t *testing.T) {
+	studentCard := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard")
+	studentid := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	level := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.level")
+	bsn := irma.NewAttributeTypeIdentifier("irma-demo.MijnOverheid.root.BSN")
+	check := func(allowed, requested irma.AttributeTypeIdentifier) error {
+		policy := &SessionPolicy{Rules: []*SessionPolicyRule{
+			{Hostname: "example.com", Attributes: []irma.AttributeTypeIdentifier{allowed}},
+		}}
+		return policy.Check("example.com", irma.NewDisclosureRequest(requested))
+	}
+
+	// A credential type allows all of its attributes
+	require.NoError(t, check(studentCard, studentid))
+	require.NoError(t, check(studentCard, level))
+	require.Error(t, check(studentCard, bsn))
+
+	// A credential type is allowed if one of its attributes is
+	require.NoError(t, check(studentid, studentCard))
+	require.NoError(t, check(studentCard, studentCard))
+	require.Error(t, check(bsn, studentCard))
+
+	// Attributes allow only themselves
+	require.NoError(t, check(studentid, studentid))
+	require.Error(t, check(studentid, level))
+}
+
 func TestCandidateConjunctionOrder(t *testing.T) {
 	client := parseStorage(t)
 
@@ -208,6 +738,74 @@ func TestCredentialRemoval(t *testing.T) {
 	require.Nil(t, cred)
 }
 
+// TestConcurrentUse uses the client from several goroutines at once; run with -race to detect data races.
+func TestConcurrentUse(t *testing.T) {
+	client := parseStorage(t)
+	defer test.ClearTestStorage(t)
+
+	studentid := irma.NewAttributeTypeIdentifier("irma-demo.RU.studentCard.studentID")
+	request := irma.NewDisclosureRequest(studentid)
+	hostname := "example.com"
+	removed := irma.NewCredentialTypeIdentifier("test.test.mijnirma")
+	require.NotEmpty(t, client.attrs(removed))
+
+	const rounds = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, 5*rounds)
+	run := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if err := f(); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	run(func() error {
+		client.CredentialInfoList()
+		client.CredentialViews()
+		client.EnrolledSchemeManagers()
+		return nil
+	})
+	run(func() error {
+		candidates, missing := client.CheckSatisfiability(request.Disclose)
+		if len(missing) > 0 {
+			return errors.New("request unsatisfiable")
+		}
+		choice, _ := client.ProposeChoice(hostname, candidates)
+		_, _, err := client.Proofs(choice, request)
+		return err
+	})
+	run(func() error {
+		_, err := client.CheckIntegrity()
+		return err
+	})
+	run(func() error {
+		return client.SetDisclosureRule(hostname, nil, false)
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for client.Attributes(removed, 0) != nil {
+			if err := client.RemoveCredential(removed, 0); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Empty(t, client.attrs(removed))
+	require.NotNil(t, client.Attributes(studentid.CredentialTypeIdentifier(), 0))
+}
+
 func TestWrongSchemeManager(t *testing.T) {
 	client := parseStorage(t)
 	defer test.ClearTestStorage(t)
@@ -254,12 +852,16 @@ func TestCredentialInfoListNewAttribute(t *testing.T) {
 // ------
 
 type TestClientHandler struct {
-	t *testing.T
-	c chan error
+	t        *testing.T
+	c        chan error
+	expiring []*ExpiringCredential
 }
 
 func (i *TestClientHandler) UpdateConfiguration(new *irma.IrmaIdentifierSet) {}
 func (i *TestClientHandler) UpdateAttributes()                               {}
+func (i *TestClientHandler) CredentialsExpiring(credentials []*ExpiringCredential) {
+	i.expiring = credentials
+}
 func (i *TestClientHandler) EnrollmentSuccess(manager irma.SchemeManagerIdentifier) {
 	select {
 	case i.c <- nil: // nop
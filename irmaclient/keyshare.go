@@ -45,15 +45,16 @@ type keyshareSession struct {
 	builders         gabi.ProofBuilderList
 	session          irma.SessionRequest
 	conf             *irma.Configuration
-	keyshareServers  map[irma.SchemeManagerIdentifier]*keyshareServer
-	keyshareServer   *keyshareServer // The one keyshare server in use in case of issuance
+	keyshareServers  map[irma.SchemeManagerIdentifier]*KeyshareServer
+	keyshareServer   *KeyshareServer // The one keyshare server in use in case of issuance
 	transports       map[irma.SchemeManagerIdentifier]*irma.HTTPTransport
 	issuerProofNonce *big.Int
 	timestamp        *atum.Timestamp
 	pinCheck         bool
 }
 
-type keyshareServer struct {
+// KeyshareServer contains the registration of the client at the keyshare server of a scheme manager.
+type KeyshareServer struct {
 	Username                string `json:"username"`
 	Nonce                   []byte `json:"nonce"`
 	SchemeManagerIdentifier irma.SchemeManagerIdentifier
@@ -126,8 +127,8 @@ const (
 	kssPinError       = "error"
 )
 
-func newKeyshareServer(schemeManagerIdentifier irma.SchemeManagerIdentifier) (ks *keyshareServer, err error) {
-	ks = &keyshareServer{
+func newKeyshareServer(schemeManagerIdentifier irma.SchemeManagerIdentifier) (ks *KeyshareServer, err error) {
+	ks = &KeyshareServer{
 		Nonce: make([]byte, 32),
 		SchemeManagerIdentifier: schemeManagerIdentifier,
 	}
@@ -135,7 +136,7 @@ func newKeyshareServer(schemeManagerIdentifier irma.SchemeManagerIdentifier) (ks
 	return
 }
 
-func (ks *keyshareServer) HashedPin(pin string) string {
+func (ks *KeyshareServer) HashedPin(pin string) string {
 	hash := sha256.Sum256(append(ks.Nonce, []byte(pin)...))
 	// We must be compatible with the old Android app here,
 	// which uses Base64.encodeToString(hash, Base64.DEFAULT),
@@ -154,13 +155,13 @@ func startKeyshareSession(
 	builders gabi.ProofBuilderList,
 	session irma.SessionRequest,
 	conf *irma.Configuration,
-	keyshareServers map[irma.SchemeManagerIdentifier]*keyshareServer,
+	keyshareServers map[irma.SchemeManagerIdentifier]*KeyshareServer,
 	issuerProofNonce *big.Int,
 	timestamp *atum.Timestamp,
 ) {
 	ksscount := 0
 	for managerID := range session.Identifiers().SchemeManagers {
-		if conf.SchemeManagers[managerID].Distributed() {
+		if conf.SchemeManager(managerID).Distributed() {
 			ksscount++
 			if _, enrolled := keyshareServers[managerID]; !enrolled {
 				err := errors.New("Not enrolled to keyshare server of scheme manager " + managerID.String())
@@ -189,7 +190,7 @@ func startKeyshareSession(
 	}
 
 	for managerID := range session.Identifiers().SchemeManagers {
-		scheme := ks.conf.SchemeManagers[managerID]
+		scheme := ks.conf.SchemeManager(managerID)
 		if !scheme.Distributed() {
 			continue
 		}
@@ -280,7 +281,7 @@ func (ks *keyshareSession) VerifyPin(attempts int) {
 	}))
 }
 
-func verifyPinWorker(pin string, kss *keyshareServer, transport *irma.HTTPTransport) (
+func verifyPinWorker(pin string, kss *KeyshareServer, transport *irma.HTTPTransport) (
 	success bool, tries int, blocked int, err error) {
 	pinmsg := keysharePinMessage{Username: kss.Username, Pin: kss.HashedPin(pin)}
 	pinresult := &keysharePinStatus{}
@@ -322,7 +323,7 @@ func verifyPinWorker(pin string, kss *keyshareServer, transport *irma.HTTPTransp
 func (ks *keyshareSession) verifyPinAttempt(pin string) (
 	success bool, tries int, blocked int, manager irma.SchemeManagerIdentifier, err error) {
 	for manager = range ks.session.Identifiers().SchemeManagers {
-		if !ks.conf.SchemeManagers[manager].Distributed() {
+		if !ks.conf.SchemeManager(manager).Distributed() {
 			continue
 		}
 
@@ -348,7 +349,7 @@ func (ks *keyshareSession) GetCommitments() {
 	for _, builder := range ks.builders {
 		pk := builder.PublicKey()
 		managerID := irma.NewIssuerIdentifier(pk.Issuer).SchemeManagerIdentifier()
-		if !ks.conf.SchemeManagers[managerID].Distributed() {
+		if !ks.conf.SchemeManager(managerID).Distributed() {
 			continue
 		}
 		if _, contains := pkids[managerID]; !contains {
@@ -360,7 +361,7 @@ func (ks *keyshareSession) GetCommitments() {
 	// Now inform each keyshare server of with respect to which public keys
 	// we want them to send us commitments
 	for managerID := range ks.session.Identifiers().SchemeManagers {
-		if !ks.conf.SchemeManagers[managerID].Distributed() {
+		if !ks.conf.SchemeManager(managerID).Distributed() {
 			continue
 		}
 
@@ -457,7 +458,7 @@ func (ks *keyshareSession) finishDisclosureOrSigning(challenge *big.Int, respons
 	for i, builder := range ks.builders {
 		// Parse each received JWT
 		managerID := irma.NewIssuerIdentifier(builder.PublicKey().Issuer).SchemeManagerIdentifier()
-		if !ks.conf.SchemeManagers[managerID].Distributed() {
+		if !ks.conf.SchemeManager(managerID).Distributed() {
 			continue
 		}
 		claims := struct {
@@ -0,0 +1,299 @@
+package irmaclient
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains searching through and exporting the log entries of a Client.
+
+// LogFilter selects log entries in Client.QueryLogs(). A log entry matches if it matches all
+// nonempty fields of the filter.
+type LogFilter struct {
+	// Types contains the types of the log entries to match.
+	Types []irma.Action
+	// ServerName is matched case-insensitively against all translations of the server name.
+	ServerName string
+	// CredentialTypes contains credential types of which an attribute was disclosed,
+	// or which were issued or removed.
+	CredentialTypes []irma.CredentialTypeIdentifier
+	// AttributeTypes contains attribute types that were disclosed or issued.
+	AttributeTypes []irma.AttributeTypeIdentifier
+	// From and Until bound the time of the log entries (inclusive).
+	From, Until time.Time
+	// Max is the maximum amount of log entries to return (0 for no maximum).
+	Max int
+}
+
+// logQueryBatchSize is the amount of log entries loaded from storage at once by QueryLogs().
+const logQueryBatchSize = 100
+
+// QueryLogs returns the log entries that match the specified filter, sorted from new to old.
+func (client *Client) QueryLogs(filter *LogFilter) ([]*LogEntry, error) {
+	if filter == nil {
+		filter = &LogFilter{}
+	}
+	result := []*LogEntry{}
+	logs, err := client.storage.LoadNewestLogs(logQueryBatchSize)
+	for ; err == nil && len(logs) > 0; logs, err = client.storage.LoadLogsBefore(logs[len(logs)-1].ID, logQueryBatchSize) {
+		for _, entry := range logs {
+			t := time.Time(entry.Time)
+			// The log entries are stored in chronological order, so we can stop here
+			if !filter.From.IsZero() && t.Before(filter.From) {
+				return result, nil
+			}
+			match, err := filter.matches(entry, client.Configuration)
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+			result = append(result, entry)
+			if filter.Max > 0 && len(result) == filter.Max {
+				return result, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (filter *LogFilter) matches(entry *LogEntry, conf *irma.Configuration) (bool, error) {
+	t := time.Time(entry.Time)
+	if (!filter.From.IsZero() && t.Before(filter.From)) || (!filter.Until.IsZero() && t.After(filter.Until)) {
+		return false, nil
+	}
+	if len(filter.Types) > 0 {
+		found := false
+		for _, typ := range filter.Types {
+			found = found || entry.Type == typ
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if filter.ServerName != "" {
+		found := false
+		for _, name := range entry.ServerName {
+			found = found || strings.Contains(strings.ToLower(name), strings.ToLower(filter.ServerName))
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if len(filter.CredentialTypes) == 0 && len(filter.AttributeTypes) == 0 {
+		return true, nil
+	}
+
+	credtypes, attrtypes, err := entry.involvedTypes(conf)
+	if err != nil {
+		return false, err
+	}
+	for _, credtype := range filter.CredentialTypes {
+		if _, ok := credtypes[credtype]; !ok {
+			return false, nil
+		}
+	}
+	for _, attrtype := range filter.AttributeTypes {
+		if _, ok := attrtypes[attrtype]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// involvedTypes returns the credential types of which attributes were disclosed, or which were
+// issued or removed in the session of the log entry, and the attribute types that were disclosed or issued.
+func (entry *LogEntry) involvedTypes(conf *irma.Configuration) (
+	map[irma.CredentialTypeIdentifier]struct{}, map[irma.AttributeTypeIdentifier]struct{}, error,
+) {
+	credtypes := map[irma.CredentialTypeIdentifier]struct{}{}
+	attrtypes := map[irma.AttributeTypeIdentifier]struct{}{}
+	for credtype := range entry.Removed {
+		credtypes[credtype] = struct{}{}
+	}
+	if entry.Type == ActionRemoval {
+		return credtypes, attrtypes, nil
+	}
+
+	disclosed, err := entry.GetDisclosedCredentials(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, attrs := range disclosed {
+		for _, attr := range attrs {
+			attrtypes[attr.Identifier] = struct{}{}
+			credtypes[attr.Identifier.CredentialTypeIdentifier()] = struct{}{}
+		}
+	}
+	issued, err := entry.GetIssuedCredentials(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cred := range issued {
+		for attrtype := range cred.Attributes {
+			attrtypes[attrtype] = struct{}{}
+			credtypes[attrtype.CredentialTypeIdentifier()] = struct{}{}
+		}
+	}
+	return credtypes, attrtypes, nil
+}
+
+// LogExport is the exported form of a log entry, containing the disclosed and issued attributes
+// and the signed message.
+type LogExport struct {
+	ID            uint64
+	Type          irma.Action
+	Time          irma.Timestamp
+	ServerName    irma.TranslatedString                                     `json:",omitempty"`
+	Disclosed     [][]*irma.DisclosedAttribute                              `json:",omitempty"`
+	Issued        irma.CredentialInfoList                                   `json:",omitempty"`
+	Removed       map[irma.CredentialTypeIdentifier][]irma.TranslatedString `json:",omitempty"`
+	SignedMessage *irma.SignedMessage                                       `json:",omitempty"`
+}
+
+// ExportLogs returns the exported form of the specified log entries.
+func (client *Client) ExportLogs(entries []*LogEntry) ([]*LogExport, error) {
+	exports := make([]*LogExport, 0, len(entries))
+	for _, entry := range entries {
+		export := &LogExport{
+			ID:         entry.ID,
+			Type:       entry.Type,
+			Time:       entry.Time,
+			ServerName: entry.ServerName,
+			Removed:    entry.Removed,
+		}
+		var err error
+		if entry.Type != ActionRemoval {
+			if export.Disclosed, err = entry.GetDisclosedCredentials(client.Configuration); err != nil {
+				return nil, errors.WrapPrefix(err, "Failed to export log entry "+strconv.FormatUint(entry.ID, 10), 0)
+			}
+		}
+		if export.Issued, err = entry.GetIssuedCredentials(client.Configuration); err != nil {
+			return nil, errors.WrapPrefix(err, "Failed to export log entry "+strconv.FormatUint(entry.ID, 10), 0)
+		}
+		if export.SignedMessage, err = entry.GetSignedMessage(); err != nil {
+			return nil, errors.WrapPrefix(err, "Failed to export log entry "+strconv.FormatUint(entry.ID, 10), 0)
+		}
+		exports = append(exports, export)
+	}
+	return exports, nil
+}
+
+// ExportLogsJSON writes the exported form of the specified log entries to w as a JSON array.
+func (client *Client) ExportLogsJSON(w io.Writer, entries []*LogEntry) error {
+	exports, err := client.ExportLogs(entries)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(exports)
+}
+
+// logCSVHeader contains the columns of ExportLogsCSV().
+var logCSVHeader = []string{"id", "type", "time", "server", "credential", "attribute", "value", "message"}
+
+// ExportLogsCSV writes the exported form of the specified log entries to w as CSV, with one row
+// per disclosed, issued or removed attribute (or one row for log entries without attributes).
+// Translated values are written in the specified language.
+func (client *Client) ExportLogsCSV(w io.Writer, entries []*LogEntry, lang string) error {
+	exports, err := client.ExportLogs(entries)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err = writer.Write(logCSVHeader); err != nil {
+		return err
+	}
+	for _, export := range exports {
+		var message string
+		if export.SignedMessage != nil {
+			message = export.SignedMessage.Message
+		}
+		prefix := []string{
+			strconv.FormatUint(export.ID, 10),
+			string(export.Type),
+			time.Time(export.Time).Format(time.RFC3339),
+			translate(export.ServerName, lang),
+		}
+		rows := export.csvRows(lang)
+		if len(rows) == 0 {
+			rows = [][]string{{"", "", ""}}
+		}
+		for _, row := range rows {
+			if err = writer.Write(append(append(append([]string{}, prefix...), row...), message)); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvRows returns the credential, attribute and value columns of the rows of the log export.
+func (export *LogExport) csvRows(lang string) [][]string {
+	var rows [][]string
+	for _, attrs := range export.Disclosed {
+		for _, attr := range attrs {
+			rows = append(rows, []string{
+				attr.Identifier.CredentialTypeIdentifier().String(), attr.Identifier.String(), translate(attr.Value, lang),
+			})
+		}
+	}
+	for _, cred := range export.Issued {
+		var attrtypes []irma.AttributeTypeIdentifier
+		for attrtype := range cred.Attributes {
+			attrtypes = append(attrtypes, attrtype)
+		}
+		sort.Slice(attrtypes, func(i, j int) bool { return attrtypes[i].String() < attrtypes[j].String() })
+		for _, attrtype := range attrtypes {
+			rows = append(rows, []string{
+				attrtype.CredentialTypeIdentifier().String(), attrtype.String(), translate(cred.Attributes[attrtype], lang),
+			})
+		}
+	}
+	var removed []irma.CredentialTypeIdentifier
+	for credtype := range export.Removed {
+		removed = append(removed, credtype)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].String() < removed[j].String() })
+	for _, credtype := range removed {
+		for _, value := range export.Removed[credtype] {
+			rows = append(rows, []string{credtype.String(), "", translate(value, lang)})
+		}
+	}
+	return rows
+}
+
+// translate returns the translation of ts in the specified language, falling back to English
+// and then to the first language in alphabetical order.
+func translate(ts irma.TranslatedString, lang string) string {
+	if value, ok := ts[lang]; ok {
+		return value
+	}
+	if value, ok := ts["en"]; ok {
+		return value
+	}
+	langs := make([]string, 0, len(ts))
+	for l := range ts {
+		langs = append(langs, l)
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.Strings(langs)
+	return ts[langs[0]]
+}
@@ -0,0 +1,120 @@
+package irmaclient
+
+import (
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains the retention policy of the log entries of a Client, and their deletion.
+
+// LogRetention specifies how long the log entries of a Client are kept. It is enforced when
+// the Client is created and after each session. Zero fields mean no limit.
+type LogRetention struct {
+	// MaxAgeDays is the amount of days after which log entries are deleted.
+	MaxAgeDays int
+	// MaxEntries is the maximum amount of log entries to keep; older ones are deleted.
+	MaxEntries int
+	// StripProofsAfterDays is the amount of days after which the proofs (Disclosure and
+	// IssueCommitment) are removed from log entries, keeping only a summary of the
+	// disclosed and issued attributes.
+	StripProofsAfterDays int
+}
+
+// SetLogRetention stores the specified log retention policy and enforces it immediately.
+func (client *Client) SetLogRetention(retention LogRetention) error {
+	if retention.MaxAgeDays < 0 || retention.MaxEntries < 0 || retention.StripProofsAfterDays < 0 {
+		return errors.New("Log retention limits must not be negative")
+	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	prefs := client.Preferences
+	prefs.LogRetention = retention
+	if err := client.storePreferences(prefs); err != nil {
+		return err
+	}
+	return client.enforceLogRetention()
+}
+
+// DeleteLogEntry deletes the log entry with the specified ID.
+func (client *Client) DeleteLogEntry(id uint64) error {
+	return client.storage.Transaction(func(tx StorageTransaction) error {
+		return tx.DeleteLogEntry(id)
+	})
+}
+
+// DeleteAllLogEntries deletes all log entries.
+func (client *Client) DeleteAllLogEntries() error {
+	logs, err := client.storage.LoadNewestLogs(1)
+	if err != nil || len(logs) == 0 {
+		return err
+	}
+	return client.storage.Transaction(func(tx StorageTransaction) error {
+		return tx.DeleteLogsBefore(logs[0].ID + 1)
+	})
+}
+
+// enforceLogRetention deletes the log entries that are too old or too many, and strips the
+// proofs from the log entries older than specified by the log retention policy.
+func (client *Client) enforceLogRetention() error {
+	retention := client.Preferences.LogRetention
+	if retention == (LogRetention{}) {
+		return nil
+	}
+
+	now := time.Now()
+	var deleteBefore uint64 // log entries stored before the log entry with this ID are deleted
+	var strip []*LogEntry
+	count := 0
+	logs, err := client.storage.LoadNewestLogs(logQueryBatchSize)
+loop:
+	for ; err == nil && len(logs) > 0; logs, err = client.storage.LoadLogsBefore(logs[len(logs)-1].ID, logQueryBatchSize) {
+		for _, entry := range logs {
+			count++
+			t := time.Time(entry.Time)
+			if (retention.MaxEntries > 0 && count > retention.MaxEntries) ||
+				(retention.MaxAgeDays > 0 && t.Before(now.AddDate(0, 0, -retention.MaxAgeDays))) {
+				deleteBefore = entry.ID + 1
+				break loop
+			}
+			if retention.StripProofsAfterDays == 0 || !t.Before(now.AddDate(0, 0, -retention.StripProofsAfterDays)) {
+				continue
+			}
+			if entry.Stripped {
+				// Log entries are stripped from old to new, so the older ones have been stripped
+				// as well; we only need to continue if older ones may have to be deleted
+				if retention.MaxAgeDays == 0 && retention.MaxEntries == 0 {
+					break loop
+				}
+				continue
+			}
+			if err := entry.stripProofs(client.Configuration); err != nil {
+				// Keep the log entry as it is, e.g. if its credential types are not known (anymore)
+				irma.Logger.Warnf("Failed to strip proofs from log entry %d: %s", entry.ID, err)
+				continue
+			}
+			if entry.Stripped {
+				strip = append(strip, entry)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if deleteBefore == 0 && len(strip) == 0 {
+		return nil
+	}
+
+	return client.storage.Transaction(func(tx StorageTransaction) error {
+		for _, entry := range strip {
+			if err := tx.UpdateLogEntry(entry); err != nil {
+				return err
+			}
+		}
+		if deleteBefore > 0 {
+			return tx.DeleteLogsBefore(deleteBefore)
+		}
+		return nil
+	})
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/bwesterb/go-atum"
 	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi"
 	"github.com/privacybydesign/irmago"
 )
 
@@ -33,6 +34,12 @@ type LogEntry struct {
 	Disclosure *irma.Disclosure      `json:",omitempty"`
 	Request    json.RawMessage       `json:",omitempty"` // Message that started the session
 	request    irma.SessionRequest   // cached parsed version of Request; get with LogEntry.SessionRequest()
+
+	// Summary of the disclosed and issued attributes, replacing the Disclosure and IssueCommitment
+	// once these have been stripped (see LogRetention)
+	Stripped            bool                         `json:",omitempty"`
+	DisclosedAttributes [][]*irma.DisclosedAttribute `json:",omitempty"`
+	IssuedCredentials   irma.CredentialInfoList      `json:",omitempty"`
 }
 
 const ActionRemoval = irma.Action("removal")
@@ -75,6 +82,9 @@ func (entry *LogEntry) GetDisclosedCredentials(conf *irma.Configuration) ([][]*i
 	if entry.Type == ActionRemoval {
 		return [][]*irma.DisclosedAttribute{}, nil
 	}
+	if entry.Stripped {
+		return entry.DisclosedAttributes, nil
+	}
 
 	request, err := entry.SessionRequest()
 	if err != nil {
@@ -96,6 +106,9 @@ func (entry *LogEntry) GetIssuedCredentials(conf *irma.Configuration) (list irma
 	if entry.Type != irma.ActionIssuing {
 		return irma.CredentialInfoList{}, nil
 	}
+	if entry.Stripped {
+		return entry.IssuedCredentials, nil
+	}
 	request, err := entry.SessionRequest()
 	if err != nil {
 		return nil, err
@@ -103,7 +116,8 @@ func (entry *LogEntry) GetIssuedCredentials(conf *irma.Configuration) (list irma
 	return request.(*irma.IssuanceRequest).GetCredentialInfoList(conf, entry.Version)
 }
 
-// GetSignedMessage gets the signed for a log entry
+// GetSignedMessage gets the signed for a log entry. If the proofs have been stripped from the log entry,
+// the Signature of the result is nil.
 func (entry *LogEntry) GetSignedMessage() (abs *irma.SignedMessage, err error) {
 	if entry.Type != irma.ActionSigning {
 		return nil, nil
@@ -113,9 +127,13 @@ func (entry *LogEntry) GetSignedMessage() (abs *irma.SignedMessage, err error) {
 		return nil, err
 	}
 	sigrequest := request.(*irma.SignatureRequest)
+	var proofs gabi.ProofList
+	if entry.Disclosure != nil {
+		proofs = entry.Disclosure.Proofs
+	}
 	return &irma.SignedMessage{
 		LDContext: entry.SignedMessageLDContext,
-		Signature: entry.Disclosure.Proofs,
+		Signature: proofs,
 		Nonce:     sigrequest.Nonce,
 		Context:   sigrequest.GetContext(),
 		Message:   string(entry.SignedMessage),
@@ -123,6 +141,28 @@ func (entry *LogEntry) GetSignedMessage() (abs *irma.SignedMessage, err error) {
 	}, nil
 }
 
+// stripProofs replaces the Disclosure and IssueCommitment of the log entry, which contain
+// the proofs sent to the server, by a summary of the disclosed and issued attributes.
+func (entry *LogEntry) stripProofs(conf *irma.Configuration) error {
+	if entry.Stripped || entry.Type == ActionRemoval {
+		return nil
+	}
+	disclosed, err := entry.GetDisclosedCredentials(conf)
+	if err != nil {
+		return err
+	}
+	issued, err := entry.GetIssuedCredentials(conf)
+	if err != nil {
+		return err
+	}
+	entry.DisclosedAttributes = disclosed
+	entry.IssuedCredentials = issued
+	entry.Disclosure = nil
+	entry.IssueCommitment = nil
+	entry.Stripped = true
+	return nil
+}
+
 func (session *session) createLogEntry(response interface{}) (*LogEntry, error) {
 	entry := &LogEntry{
 		Type:       session.Action,
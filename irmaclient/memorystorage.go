@@ -0,0 +1,275 @@
+package irmaclient
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/irmago"
+)
+
+// memoryStorage is a Storage that keeps everything in memory, e.g. for tests. Like boltStorage it
+// stores everything in serialized form, so that Clients using it behave the same.
+type memoryStorage struct {
+	sync.Mutex
+	values map[string][]byte
+	logs   [][]byte // the log entry with ID i is at index i-1; deleted log entries are nil
+}
+
+// memoryTransaction collects the changes of a transaction, which are applied to the
+// memoryStorage only when the transaction succeeds.
+type memoryTransaction struct {
+	storage *memoryStorage
+	values  map[string][]byte // nil values are deleted
+	logs    [][]byte
+	changed map[uint64][]byte // updated log entries by ID; nil values are deleted
+}
+
+// NewMemoryStorage returns a new Storage that keeps everything in memory. The Storage can be
+// passed to several Clients in succession, each of which then continues where the previous one
+// left off, but it is lost when the process exits.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{values: map[string][]byte{}}
+}
+
+const signaturePrefix = signaturesBucket + "/"
+
+func signatureKey(hash string) string {
+	return signaturePrefix + hash
+}
+
+func (s *memoryStorage) EnsureStorageExists() error {
+	return nil
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
+
+func (s *memoryStorage) Transaction(f func(tx StorageTransaction) error) error {
+	s.Lock()
+	defer s.Unlock()
+	tx := &memoryTransaction{storage: s, values: map[string][]byte{}, changed: map[uint64][]byte{}}
+	if err := f(tx); err != nil {
+		return err
+	}
+	for key, value := range tx.values {
+		if value == nil {
+			delete(s.values, key)
+		} else {
+			s.values[key] = value
+		}
+	}
+	s.logs = append(s.logs, tx.logs...)
+	for id, value := range tx.changed {
+		s.logs[id-1] = value
+	}
+	return nil
+}
+
+// load loads the value of the specified key into dest, returning whether it was present.
+func (s *memoryStorage) load(key string, dest interface{}) (bool, error) {
+	s.Lock()
+	bts, found := s.values[key]
+	s.Unlock()
+	if !found {
+		return false, nil
+	}
+	return true, json.Unmarshal(bts, dest)
+}
+
+func (tx *memoryTransaction) store(key string, contents interface{}) error {
+	bts, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	tx.values[key] = bts
+	return nil
+}
+
+func (s *memoryStorage) LoadSecretKey() (*SecretKey, error) {
+	sk := &SecretKey{}
+	found, err := s.load(skFile, sk)
+	if err != nil || !found {
+		return nil, err
+	}
+	return sk, nil
+}
+
+func (tx *memoryTransaction) StoreSecretKey(sk *SecretKey) error {
+	return tx.store(skFile, sk)
+}
+
+func (s *memoryStorage) LoadAttributes() ([]*irma.AttributeList, error) {
+	list := []*irma.AttributeList{}
+	if _, err := s.load(attributesFile, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (tx *memoryTransaction) StoreAttributes(attributes []*irma.AttributeList) error {
+	return tx.store(attributesFile, attributes)
+}
+
+func (s *memoryStorage) LoadSignature(attrs *irma.AttributeList) (*gabi.CLSignature, error) {
+	signature := new(gabi.CLSignature)
+	found, err := s.load(signatureKey(attrs.Hash()), signature)
+	if err != nil || !found {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func (tx *memoryTransaction) StoreSignature(attrs *irma.AttributeList, signature *gabi.CLSignature) error {
+	return tx.store(signatureKey(attrs.Hash()), signature)
+}
+
+func (s *memoryStorage) LoadSignatureHashes() ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+	hashes := []string{}
+	for key := range s.values {
+		if strings.HasPrefix(key, signaturePrefix) {
+			hashes = append(hashes, strings.TrimPrefix(key, signaturePrefix))
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+func (tx *memoryTransaction) DeleteSignature(hash string) error {
+	tx.values[signatureKey(hash)] = nil
+	return nil
+}
+
+func (s *memoryStorage) LoadKeyshareServers() (map[irma.SchemeManagerIdentifier]*KeyshareServer, error) {
+	ksses := make(map[irma.SchemeManagerIdentifier]*KeyshareServer)
+	if _, err := s.load(kssFile, &ksses); err != nil {
+		return nil, err
+	}
+	return ksses, nil
+}
+
+func (tx *memoryTransaction) StoreKeyshareServers(keyshareServers map[irma.SchemeManagerIdentifier]*KeyshareServer) error {
+	return tx.store(kssFile, keyshareServers)
+}
+
+func (s *memoryStorage) LoadUpdates() ([]Update, error) {
+	updates := []Update{}
+	if _, err := s.load(updatesFile, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+func (tx *memoryTransaction) StoreUpdates(updates []Update) error {
+	return tx.store(updatesFile, updates)
+}
+
+func (s *memoryStorage) LoadPreferences() (*Preferences, error) {
+	config := defaultPreferences
+	found, err := s.load(preferencesFile, &config)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (tx *memoryTransaction) StorePreferences(prefs Preferences) error {
+	return tx.store(preferencesFile, prefs)
+}
+
+func (tx *memoryTransaction) AddLogEntry(entry *LogEntry) error {
+	entry.ID = uint64(len(tx.storage.logs) + len(tx.logs) + 1)
+	bts, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tx.logs = append(tx.logs, bts)
+	return nil
+}
+
+// logCount returns the amount of log entries including the ones added in this transaction,
+// including deleted ones.
+func (tx *memoryTransaction) logCount() uint64 {
+	return uint64(len(tx.storage.logs) + len(tx.logs))
+}
+
+// logExists returns whether the log entry with the specified ID exists within this transaction.
+func (tx *memoryTransaction) logExists(id uint64) bool {
+	if id == 0 || id > tx.logCount() {
+		return false
+	}
+	if value, changed := tx.changed[id]; changed {
+		return value != nil
+	}
+	if id > uint64(len(tx.storage.logs)) {
+		return true
+	}
+	return tx.storage.logs[id-1] != nil
+}
+
+func (tx *memoryTransaction) UpdateLogEntry(entry *LogEntry) error {
+	if !tx.logExists(entry.ID) {
+		return errors.Errorf("Log entry %d not found", entry.ID)
+	}
+	bts, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tx.changed[entry.ID] = bts
+	return nil
+}
+
+func (tx *memoryTransaction) DeleteLogEntry(id uint64) error {
+	if tx.logExists(id) {
+		tx.changed[id] = nil
+	}
+	return nil
+}
+
+func (tx *memoryTransaction) DeleteLogsBefore(id uint64) error {
+	for i := uint64(1); i < id && i <= tx.logCount(); i++ {
+		tx.changed[i] = nil
+	}
+	return nil
+}
+
+func (s *memoryStorage) LoadNewestLogs(max int) ([]*LogEntry, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.loadLogs(uint64(len(s.logs)), max)
+}
+
+func (s *memoryStorage) LoadLogsBefore(index uint64, max int) ([]*LogEntry, error) {
+	s.Lock()
+	defer s.Unlock()
+	if index == 0 {
+		return []*LogEntry{}, nil
+	}
+	if index > uint64(len(s.logs)) {
+		index = uint64(len(s.logs)) + 1
+	}
+	return s.loadLogs(index-1, max)
+}
+
+// loadLogs returns the log entries with IDs up to and including the specified ID, sorted from new
+// to old with a maximum result length of max. The caller must hold the lock.
+func (s *memoryStorage) loadLogs(id uint64, max int) ([]*LogEntry, error) {
+	logs := make([]*LogEntry, 0, max)
+	for ; id > 0 && len(logs) < max; id-- {
+		if s.logs[id-1] == nil {
+			continue
+		}
+		var log LogEntry
+		if err := json.Unmarshal(s.logs[id-1], &log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, &log)
+	}
+	return logs, nil
+}
@@ -0,0 +1,219 @@
+package irmaclient
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains the disclosure choice policy of a Client: it ranks the candidates for
+// disclosure and proposes a DisclosureChoice, taking into account the choices remembered
+// per server hostname in the DisclosureRules of the Preferences.
+
+// DisclosureRule contains the remembered choice of the user for sessions with a server.
+type DisclosureRule struct {
+	// Choice contains the attribute types of each of the remembered candidates.
+	Choice [][]irma.AttributeTypeIdentifier
+	// AutoApprove enables performing disclosure sessions with the server without asking the user
+	// for permission, if the remembered Choice provides a candidate for each requested disjunction.
+	AutoApprove bool
+}
+
+// disclosureRuleKey returns the key of the DisclosureRules in the Preferences for the server with
+// the specified hostname. Rules are not keyed on the name of the server, as different servers
+// may have the same name, and the name of a server changes when it becomes a verified requestor.
+func disclosureRuleKey(hostname string) string {
+	return strings.ToLower(hostname)
+}
+
+// DisclosureRule returns the disclosure rule for the server with the specified hostname, if any.
+func (client *Client) DisclosureRule(hostname string) *DisclosureRule {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.disclosureRule(hostname)
+}
+
+func (client *Client) disclosureRule(hostname string) *DisclosureRule {
+	return client.Preferences.DisclosureRules[disclosureRuleKey(hostname)]
+}
+
+// SetDisclosureRule remembers the specified choice for later sessions with the server with the
+// specified hostname (see RequestorInfo), if autoApprove is true performing these without asking
+// for permission if possible.
+func (client *Client) SetDisclosureRule(hostname string, choice *irma.DisclosureChoice, autoApprove bool) error {
+	rule := &DisclosureRule{Choice: [][]irma.AttributeTypeIdentifier{}, AutoApprove: autoApprove}
+	if choice != nil {
+		for _, con := range choice.Attributes {
+			rule.Choice = append(rule.Choice, candidateTypes(con))
+		}
+	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.storeDisclosureRule(hostname, rule)
+}
+
+// RemoveDisclosureRule removes the disclosure rule for the server with the specified hostname.
+func (client *Client) RemoveDisclosureRule(hostname string) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.storeDisclosureRule(hostname, nil)
+}
+
+func (client *Client) storeDisclosureRule(hostname string, rule *DisclosureRule) error {
+	prefs := client.Preferences
+	// Copy the map so that the current preferences remain intact if storing fails
+	prefs.DisclosureRules = make(map[string]*DisclosureRule, len(client.Preferences.DisclosureRules)+1)
+	for key, r := range client.Preferences.DisclosureRules {
+		prefs.DisclosureRules[key] = r
+	}
+	if rule == nil {
+		delete(prefs.DisclosureRules, disclosureRuleKey(hostname))
+	} else {
+		prefs.DisclosureRules[disclosureRuleKey(hostname)] = rule
+	}
+	return client.storePreferences(prefs)
+}
+
+// candidateTypes returns the attribute types of the attributes in the candidate.
+func candidateTypes(candidate []*irma.AttributeIdentifier) []irma.AttributeTypeIdentifier {
+	types := make([]irma.AttributeTypeIdentifier, 0, len(candidate))
+	for _, attr := range candidate {
+		types = append(types, attr.Type)
+	}
+	return types
+}
+
+// candidateScore contains the properties of a candidate by which candidates are ranked.
+type candidateScore struct {
+	empty   bool      // whether the candidate discloses nothing (in an optional disjunction)
+	expired int       // amount of expired credentials
+	oldest  time.Time // signing date of the least recently issued credential
+	extra   int       // amount of attributes in the credentials that are not disclosed
+}
+
+func (client *Client) scoreCandidate(candidate []*irma.AttributeIdentifier) candidateScore {
+	score := candidateScore{empty: len(candidate) == 0}
+	disclosed := map[string]int{} // amount of disclosed attributes per credential hash
+	for _, attr := range candidate {
+		disclosed[attr.CredentialHash]++
+	}
+	for hash, count := range disclosed {
+		attrs, _ := client.attributesByHash(hash)
+		if attrs == nil {
+			continue
+		}
+		if !attrs.IsValid() {
+			score.expired++
+		}
+		if signed := attrs.SigningDate(); score.oldest.IsZero() || signed.Before(score.oldest) {
+			score.oldest = signed
+		}
+		for _, value := range attrs.Strings() {
+			if value != nil {
+				score.extra++
+			}
+		}
+		score.extra -= count
+	}
+	return score
+}
+
+// betterThan returns whether a candidate having score s is preferred over one having score o.
+func (s candidateScore) betterThan(o candidateScore) bool {
+	if s.empty != o.empty {
+		return s.empty
+	}
+	if s.expired != o.expired {
+		return s.expired < o.expired
+	}
+	if !s.oldest.Equal(o.oldest) {
+		return s.oldest.After(o.oldest)
+	}
+	return s.extra < o.extra
+}
+
+// RankCandidates sorts the candidates (as returned by CheckSatisfiability()) of each disjunction from
+// most to least preferred: disclosing nothing in optional disjunctions, then candidates
+// without expired credentials, then candidates with the most recently issued credentials,
+// then candidates whose credentials contain the least attributes besides the disclosed ones.
+func (client *Client) RankCandidates(candidates [][][]*irma.AttributeIdentifier) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.rankCandidates(candidates)
+}
+
+func (client *Client) rankCandidates(candidates [][][]*irma.AttributeIdentifier) {
+	for i, discon := range candidates {
+		ranked := make([]struct {
+			candidate []*irma.AttributeIdentifier
+			score     candidateScore
+		}, len(discon))
+		for j, candidate := range discon {
+			ranked[j].candidate = candidate
+			ranked[j].score = client.scoreCandidate(candidate)
+		}
+		sort.SliceStable(ranked, func(j, k int) bool {
+			return ranked[j].score.betterThan(ranked[k].score)
+		})
+		for j := range ranked {
+			candidates[i][j] = ranked[j].candidate
+		}
+	}
+}
+
+// ProposeChoice ranks the candidates (see RankCandidates()) and then moves the candidates
+// remembered in the disclosure rule for the server with the specified hostname (if any) to the front,
+// so that the first candidates of each of the disjunctions together constitute the proposed
+// choice, which it returns. The boolean indicates whether the remembered choice provided a
+// candidate for each disjunction.
+func (client *Client) ProposeChoice(hostname string, candidates [][][]*irma.AttributeIdentifier) (
+	*irma.DisclosureChoice, bool,
+) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.rankCandidates(candidates)
+
+	rule := client.disclosureRule(hostname)
+	remembered := rule != nil
+	choice := &irma.DisclosureChoice{Attributes: make([][]*irma.AttributeIdentifier, 0, len(candidates))}
+	for _, discon := range candidates {
+		found := -1
+		if rule != nil {
+		search:
+			for i, candidate := range discon {
+				for _, types := range rule.Choice {
+					if equalTypes(candidateTypes(candidate), types) {
+						found = i
+						break search
+					}
+				}
+			}
+		}
+		if found < 0 {
+			remembered = false
+		} else {
+			// Move the remembered candidate to the front, keeping the order of the others
+			candidate := discon[found]
+			copy(discon[1:found+1], discon[:found])
+			discon[0] = candidate
+		}
+		if len(discon) > 0 {
+			choice.Attributes = append(choice.Attributes, discon[0])
+		}
+	}
+	return choice, remembered
+}
+
+func equalTypes(a, b []irma.AttributeTypeIdentifier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
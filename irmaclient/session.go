@@ -42,17 +42,19 @@ type Handler interface {
 	KeyshareEnrollmentMissing(manager irma.SchemeManagerIdentifier)
 	KeyshareEnrollmentDeleted(manager irma.SchemeManagerIdentifier)
 
+	// The candidates passed to the Request...Permission methods are sorted by preference, the first
+	// candidates of each disjunction together being the proposed choice (see Client.ProposeChoice()).
 	RequestIssuancePermission(request *irma.IssuanceRequest,
 		candidates [][][]*irma.AttributeIdentifier,
-		ServerName irma.TranslatedString,
+		requestor *RequestorInfo,
 		callback PermissionHandler)
 	RequestVerificationPermission(request *irma.DisclosureRequest,
 		candidates [][][]*irma.AttributeIdentifier,
-		ServerName irma.TranslatedString,
+		requestor *RequestorInfo,
 		callback PermissionHandler)
 	RequestSignaturePermission(request *irma.SignatureRequest,
 		candidates [][][]*irma.AttributeIdentifier,
-		ServerName irma.TranslatedString,
+		requestor *RequestorInfo,
 		callback PermissionHandler)
 	RequestSchemeManagerPermission(manager *irma.SchemeManager,
 		callback func(proceed bool))
@@ -60,6 +62,24 @@ type Handler interface {
 	RequestPin(remainingAttempts int, callback PinHandler)
 }
 
+// RequestorInfo describes the requestor of a session to the user, when asking for permission.
+type RequestorInfo struct {
+	// Name of the requestor: from the requestor schemes if the requestor is verified, otherwise
+	// the name of the issuer (in issuance sessions involving a single issuer) or the hostname
+	Name irma.TranslatedString
+	// Logo is the path to the logo of the requestor, if it is verified and has one
+	Logo string
+	// Verified indicates that the hostname of the requestor is listed in a requestor scheme
+	Verified bool
+	// UndeclaredAttributes contains the requested attributes that a verified requestor
+	// did not declare in its requestor scheme
+	UndeclaredAttributes []irma.AttributeTypeIdentifier
+	// Warning is a message (in English) that should be shown to the user if nonempty
+	Warning string
+	// Hostname of the requestor, by which its disclosure rule is remembered (see Client.SetDisclosureRule())
+	Hostname string
+}
+
 // SessionDismisser can dismiss the current IRMA session.
 type SessionDismisser interface {
 	Dismiss()
@@ -70,6 +90,7 @@ type session struct {
 	Handler    Handler
 	Version    *irma.ProtocolVersion
 	ServerName irma.TranslatedString
+	Requestor  *RequestorInfo
 
 	choice      *irma.DisclosureChoice
 	attrIndices irma.DisclosedAttributeIndices
@@ -107,6 +128,10 @@ var maxVersion = &irma.ProtocolVersion{Major: 2, Minor: supportedVersions[2][len
 
 // NewSession starts a new IRMA session, given (along with a handler to pass feedback to) a session request.
 // When the request is not suitable to start an IRMA session from, it calls the Failure method of the specified Handler.
+// Only one session runs at a time: while another session is running, it calls the Failure method
+// of the specified Handler with an error of type irma.ErrorSessionInProgress. A session stops running
+// as soon as (and before) it calls the Success, Failure, Cancelled, UnsatisfiableRequest or
+// KeyshareEnrollment* methods of its Handler, so that these may start a new session.
 func (client *Client) NewSession(sessionrequest string, handler Handler) SessionDismisser {
 	bts := []byte(sessionrequest)
 
@@ -143,6 +168,9 @@ func (client *Client) newManualSession(request irma.SessionRequest, handler Hand
 		Version: minVersion,
 		request: request,
 	}
+	if !session.register() {
+		return nil
+	}
 	session.Handler.StatusUpdate(session.Action, irma.StatusManualStarted)
 
 	session.processSessionInfo()
@@ -157,6 +185,9 @@ func (client *Client) newSchemeSession(qr *irma.SchemeManagerRequest, handler Ha
 		Handler:   handler,
 		client:    client,
 	}
+	if !session.register() {
+		return nil
+	}
 	session.Handler.StatusUpdate(session.Action, irma.StatusCommunicating)
 
 	go session.managerSession()
@@ -187,6 +218,9 @@ func (client *Client) newQrSession(qr *irma.Qr, handler Handler) SessionDismisse
 		Handler:   handler,
 		client:    client,
 	}
+	if !session.register() {
+		return nil
+	}
 
 	session.Handler.StatusUpdate(session.Action, irma.StatusCommunicating)
 	min := minVersion
@@ -235,6 +269,36 @@ func (session *session) getSessionInfo() {
 	session.processSessionInfo()
 }
 
+// requestorInfo returns information on the requestor of the session, verifying it using the
+// requestor schemes.
+func requestorInfo(hostname string, request irma.SessionRequest, conf *irma.Configuration) *RequestorInfo {
+	requestor := conf.Requestor(hostname)
+	if requestor == nil {
+		return &RequestorInfo{Name: serverName(hostname, request, conf), Hostname: hostname}
+	}
+
+	info := &RequestorInfo{
+		Name:                 requestor.Name,
+		Logo:                 requestor.LogoPath(conf),
+		Verified:             true,
+		UndeclaredAttributes: requestor.UndeclaredAttributes(request),
+		Hostname:             hostname,
+	}
+	if len(info.UndeclaredAttributes) > 0 {
+		attrs := make([]string, 0, len(info.UndeclaredAttributes))
+		for _, attr := range info.UndeclaredAttributes {
+			attrs = append(attrs, attr.String())
+		}
+		name := requestor.Name["en"]
+		if name == "" {
+			name = hostname
+		}
+		info.Warning = fmt.Sprintf("%s requests attributes that it did not declare to request: %s",
+			name, strings.Join(attrs, ", "))
+	}
+	return info
+}
+
 func serverName(hostname string, request irma.SessionRequest, conf *irma.Configuration) irma.TranslatedString {
 	sn := irma.NewTranslatedString(&hostname)
 
@@ -242,7 +306,7 @@ func serverName(hostname string, request irma.SessionRequest, conf *irma.Configu
 		// If there is only one issuer in the current request, use its name as ServerName
 		var iss irma.TranslatedString
 		for _, credreq := range ir.Credentials {
-			credIssuer := conf.Issuers[credreq.CredentialTypeID.IssuerIdentifier()].Name
+			credIssuer := conf.Issuer(credreq.CredentialTypeID.IssuerIdentifier()).Name
 			if !reflect.DeepEqual(credIssuer, iss) { // Can't just test pointer equality: credIssuer != iss
 				if len(iss) != 0 {
 					return sn
@@ -277,7 +341,16 @@ func (session *session) processSessionInfo() {
 		baserequest.ProtocolVersion = session.Version
 	}
 
-	session.ServerName = serverName(session.Hostname, session.request, session.client.Configuration)
+	session.Requestor = requestorInfo(session.Hostname, session.request, session.client.Configuration)
+	session.ServerName = session.Requestor.Name
+
+	session.client.lock.Lock()
+	err := session.client.checkSessionPolicies(session.Hostname, session.request)
+	session.client.lock.Unlock()
+	if err != nil {
+		session.fail(&irma.SessionError{ErrorType: irma.ErrorBlocked, Err: err, Info: err.Error()})
+		return
+	}
 
 	if session.Action == irma.ActionIssuing {
 		ir := session.request.(*irma.IssuanceRequest)
@@ -289,36 +362,50 @@ func (session *session) processSessionInfo() {
 
 		// Calculate singleton credentials to be removed
 		ir.RemovalCredentialInfoList = irma.CredentialInfoList{}
+		session.client.lock.Lock()
 		for _, credreq := range ir.Credentials {
 			preexistingCredentials := session.client.attrs(credreq.CredentialTypeID)
 			if len(preexistingCredentials) != 0 && preexistingCredentials[0].IsValid() && preexistingCredentials[0].CredentialType().IsSingleton {
 				ir.RemovalCredentialInfoList = append(ir.RemovalCredentialInfoList, preexistingCredentials[0].Info())
 			}
 		}
+		session.client.lock.Unlock()
 	}
 
 	candidates, missing := session.client.CheckSatisfiability(session.request.Disclosure().Disclose)
 	if len(missing) > 0 {
+		session.finish()
 		session.Handler.UnsatisfiableRequest(session.request, session.ServerName, missing)
 		return
 	}
 
+	choice, remembered := session.client.ProposeChoice(session.Hostname, candidates)
+
 	// Ask for permission to execute the session
 	callback := PermissionHandler(func(proceed bool, choice *irma.DisclosureChoice) {
 		session.choice = choice
 		go session.doSession(proceed)
 	})
 	session.Handler.StatusUpdate(session.Action, irma.StatusConnected)
+
+	// Disclosure sessions with servers for which the user chose to do so are approved
+	// automatically, if the remembered choice can be used
+	if rule := session.client.DisclosureRule(session.Hostname); session.Action == irma.ActionDisclosing &&
+		rule != nil && rule.AutoApprove && remembered {
+		callback(true, choice)
+		return
+	}
+
 	switch session.Action {
 	case irma.ActionDisclosing:
 		session.Handler.RequestVerificationPermission(
-			session.request.(*irma.DisclosureRequest), candidates, session.ServerName, callback)
+			session.request.(*irma.DisclosureRequest), candidates, session.Requestor, callback)
 	case irma.ActionSigning:
 		session.Handler.RequestSignaturePermission(
-			session.request.(*irma.SignatureRequest), candidates, session.ServerName, callback)
+			session.request.(*irma.SignatureRequest), candidates, session.Requestor, callback)
 	case irma.ActionIssuing:
 		session.Handler.RequestIssuancePermission(
-			session.request.(*irma.IssuanceRequest), candidates, session.ServerName, callback)
+			session.request.(*irma.IssuanceRequest), candidates, session.Requestor, callback)
 	default:
 		panic("Invalid session type") // does not happen, session.Action has been checked earlier
 	}
@@ -349,13 +436,19 @@ func (session *session) doSession(proceed bool) {
 		if err != nil {
 			session.fail(&irma.SessionError{ErrorType: irma.ErrorCrypto, Err: err})
 		}
+		session.client.lock.Lock()
+		keyshareServers := make(map[irma.SchemeManagerIdentifier]*KeyshareServer, len(session.client.keyshareServers))
+		for id, kss := range session.client.keyshareServers {
+			keyshareServers[id] = kss
+		}
+		session.client.lock.Unlock()
 		startKeyshareSession(
 			session,
 			session.Handler,
 			session.builders,
 			session.request,
 			session.client.Configuration,
-			session.client.keyshareServers,
+			keyshareServers,
 			session.issuerProofNonce,
 			session.timestamp,
 		)
@@ -429,24 +522,34 @@ func (session *session) sendResponse(message interface{}) {
 			session.fail(err.(*irma.SessionError))
 			return
 		}
-		if err = session.client.ConstructCredentials(response, session.request.(*irma.IssuanceRequest), session.builders); err != nil {
-			session.fail(&irma.SessionError{ErrorType: irma.ErrorCrypto, Err: err})
-			return
-		}
 		log, err = session.createLogEntry(message)
 		if err != nil {
 			irma.Logger.Warn(errors.WrapPrefix(err, "Failed to create log entry", 0).ErrorStack())
 			raven.CaptureError(err, nil)
 		}
+		// Store the new credentials along with the log entry
+		if err = session.client.constructCredentials(response, session.request.(*irma.IssuanceRequest), session.builders, log); err != nil {
+			session.fail(&irma.SessionError{ErrorType: irma.ErrorCrypto, Err: err})
+			return
+		}
 	}
 
-	if err = session.client.storage.AddLogEntry(log); err != nil {
-		irma.Logger.Warn(errors.WrapPrefix(err, "Failed to write log entry", 0).ErrorStack())
+	if session.Action != irma.ActionIssuing && log != nil {
+		if err = session.client.addLogEntry(log); err != nil {
+			irma.Logger.Warn(errors.WrapPrefix(err, "Failed to write log entry", 0).ErrorStack())
+		}
+	}
+	session.client.lock.Lock()
+	err = session.client.enforceLogRetention()
+	session.client.lock.Unlock()
+	if err != nil {
+		irma.Logger.Warn(errors.WrapPrefix(err, "Failed to enforce log retention", 0).ErrorStack())
 	}
+	session.done = true
+	session.finish()
 	if session.Action == irma.ActionIssuing {
 		session.client.handler.UpdateAttributes()
 	}
-	session.done = true
 	session.Handler.Success(string(messageJson))
 }
 
@@ -459,16 +562,20 @@ func (session *session) managerSession() {
 	// when asking installation permission.
 	manager, err := irma.DownloadSchemeManager(session.ServerURL)
 	if err != nil {
+		session.finish()
 		session.Handler.Failure(&irma.SessionError{ErrorType: irma.ErrorConfigurationDownload, Err: err})
 		return
 	}
 
 	session.Handler.RequestSchemeManagerPermission(manager, func(proceed bool) {
 		if !proceed {
+			session.finish()
 			session.Handler.Cancelled() // No need to DELETE session here
 			return
 		}
-		if err := session.client.Configuration.InstallSchemeManager(manager, nil); err != nil {
+		err := session.client.Configuration.InstallSchemeManager(manager, nil)
+		session.finish()
+		if err != nil {
 			session.Handler.Failure(&irma.SessionError{ErrorType: irma.ErrorConfigurationDownload, Err: err})
 			return
 		}
@@ -528,9 +635,12 @@ func (session *session) getProof() (interface{}, error) {
 // and aborts the session if not
 func (session *session) checkKeyshareEnrollment() bool {
 	for id := range session.request.Identifiers().SchemeManagers {
-		distributed := session.client.Configuration.SchemeManagers[id].Distributed()
+		distributed := session.client.Configuration.SchemeManager(id).Distributed()
+		session.client.lock.Lock()
 		_, enrolled := session.client.keyshareServers[id]
+		session.client.lock.Unlock()
 		if distributed && !enrolled {
+			session.finish()
 			session.Handler.KeyshareEnrollmentMissing(id)
 			return false
 		}
@@ -576,7 +686,7 @@ func (session *session) Distributed() bool {
 	if session.Action == irma.ActionIssuing {
 		for _, credreq := range session.request.(*irma.IssuanceRequest).Credentials {
 			smi = credreq.CredentialTypeID.IssuerIdentifier().SchemeManagerIdentifier()
-			if session.client.Configuration.SchemeManagers[smi].Distributed() {
+			if session.client.Configuration.SchemeManager(smi).Distributed() {
 				return true
 			}
 		}
@@ -589,7 +699,7 @@ func (session *session) Distributed() bool {
 	for _, attrlist := range session.choice.Attributes {
 		for _, ai := range attrlist {
 			smi = ai.Type.CredentialTypeIdentifier().IssuerIdentifier().SchemeManagerIdentifier()
-			if session.client.Configuration.SchemeManagers[smi].Distributed() {
+			if session.client.Configuration.SchemeManager(smi).Distributed() {
 				return true
 			}
 		}
@@ -602,6 +712,7 @@ func (session *session) Distributed() bool {
 
 func (session *session) recoverFromPanic() {
 	if e := recover(); e != nil {
+		session.finish()
 		if session.Handler != nil {
 			session.Handler.Failure(panicToError(e))
 		}
@@ -623,8 +734,37 @@ func panicToError(e interface{}) *irma.SessionError {
 	return &irma.SessionError{ErrorType: irma.ErrorPanic, Info: info + "\n\n" + string(debug.Stack())}
 }
 
+// register makes the session the currently running session of the client, returning whether or
+// not it succeeded. If another session is running, it calls the Failure method of the Handler.
+func (session *session) register() bool {
+	session.client.lock.Lock()
+	running := session.client.session != nil
+	if !running {
+		session.client.session = session
+	}
+	session.client.lock.Unlock()
+
+	if running {
+		session.Handler.Failure(&irma.SessionError{
+			ErrorType: irma.ErrorSessionInProgress,
+			Err:       errors.New("Another session is in progress"),
+		})
+	}
+	return !running
+}
+
+// finish idempotently marks the session as no longer running, allowing new sessions to be started.
+func (session *session) finish() {
+	session.client.lock.Lock()
+	defer session.client.lock.Unlock()
+	if session.client.session == session {
+		session.client.session = nil
+	}
+}
+
 // Idempotently send DELETE to remote server, returning whether or not we did something
 func (session *session) delete() bool {
+	session.finish()
 	if !session.done {
 		if session.IsInteractive() {
 			session.transport.Delete()
@@ -676,14 +816,17 @@ func (session *session) KeyshareCancelled() {
 }
 
 func (session *session) KeyshareEnrollmentIncomplete(manager irma.SchemeManagerIdentifier) {
+	session.finish()
 	session.Handler.KeyshareEnrollmentIncomplete(manager)
 }
 
 func (session *session) KeyshareEnrollmentDeleted(manager irma.SchemeManagerIdentifier) {
+	session.finish()
 	session.Handler.KeyshareEnrollmentDeleted(manager)
 }
 
 func (session *session) KeyshareBlocked(manager irma.SchemeManagerIdentifier, duration int) {
+	session.finish()
 	session.Handler.KeyshareBlocked(manager, duration)
 }
 
@@ -0,0 +1,160 @@
+package irmaclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/json"
+	"io/ioutil"
+	gobig "math/big"
+	"strings"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago"
+)
+
+// This file contains session policies, with which the user or an administrator can restrict the
+// hosts with which a Client performs sessions, and the attributes that these hosts may request.
+
+// SessionPolicy contains rules restricting the sessions that a Client performs. A Client enforces
+// both the session policy in its Preferences, set by the user, and the session policy loaded
+// with LoadSignedSessionPolicy(), e.g. by an administrator. Manual sessions, which involve no
+// host, are not restricted.
+type SessionPolicy struct {
+	// AllowedHostsOnly blocks sessions with hosts that match none of the Rules.
+	AllowedHostsOnly bool `json:"allowedHostsOnly,omitempty"`
+	// Rules apply to the sessions with the hosts that they match; all matching rules are enforced.
+	Rules []*SessionPolicyRule `json:"rules"`
+}
+
+// SessionPolicyRule restricts the sessions with the hosts matching its Hostname.
+type SessionPolicyRule struct {
+	// Hostname is the hostname of the hosts to which the rule applies, "*.example.com"
+	// for all subdomains of example.com, or "*" for all hosts.
+	Hostname string `json:"hostname"`
+	// Block blocks all sessions with the hosts.
+	Block bool `json:"block,omitempty"`
+	// Attributes, if nonempty, are the only attributes that the hosts may request. A credential
+	// type in Attributes allows all attributes of that credential type, like in requestor schemes.
+	// A request for a credential type itself (i.e. for only its metadata) is allowed if any of its
+	// attributes is allowed.
+	Attributes []irma.AttributeTypeIdentifier `json:"attributes,omitempty"`
+}
+
+// matches returns whether the rule applies to the specified hostname.
+func (rule *SessionPolicyRule) matches(hostname string) bool {
+	pattern, hostname := strings.ToLower(rule.Hostname), strings.ToLower(hostname)
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(hostname, pattern[1:])
+	default:
+		return pattern == hostname
+	}
+}
+
+// allows returns whether the rule allows the specified attribute to be requested.
+func (rule *SessionPolicyRule) allows(attr irma.AttributeTypeIdentifier) bool {
+	if len(rule.Attributes) == 0 {
+		return true
+	}
+	for _, allowed := range rule.Attributes {
+		if allowed == attr {
+			return true
+		}
+		sameCredType := allowed.CredentialTypeIdentifier() == attr.CredentialTypeIdentifier()
+		if sameCredType && (allowed.IsCredential() || attr.IsCredential()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error explaining why the policy blocks a session with the specified host,
+// requesting the attributes of the specified session request, or nil if it does not.
+func (policy *SessionPolicy) Check(hostname string, request irma.SessionRequest) error {
+	if policy == nil || hostname == "" {
+		return nil
+	}
+	matched := false
+	for _, rule := range policy.Rules {
+		if !rule.matches(hostname) {
+			continue
+		}
+		matched = true
+		if rule.Block {
+			return errors.Errorf("Sessions with %s are blocked", hostname)
+		}
+		err := request.Disclosure().Disclose.Iterate(func(attr *irma.AttributeRequest) error {
+			if !rule.allows(attr.Type) {
+				return errors.Errorf("%s may not request %s", hostname, attr.Type)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !matched && policy.AllowedHostsOnly {
+		return errors.Errorf("%s is not an allowed host", hostname)
+	}
+	return nil
+}
+
+// SetSessionPolicy stores the specified session policy of the user in the preferences.
+func (client *Client) SetSessionPolicy(policy *SessionPolicy) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	prefs := client.Preferences
+	prefs.SessionPolicy = policy
+	return client.storePreferences(prefs)
+}
+
+// LoadSignedSessionPolicy reads the session policy in JSON from the file at the specified path,
+// and enforces it in addition to the session policy in the preferences until the client is
+// recreated. The file at the path with ".sig" appended must contain a signature over the
+// policy file by the specified public key, in the same format as the signatures of scheme
+// indices: an ASN.1-encoded ECDSA signature over the SHA256 hash of the file.
+func (client *Client) LoadSignedSessionPolicy(path string, pk *ecdsa.PublicKey) error {
+	bts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig, err := ioutil.ReadFile(path + ".sig")
+	if err != nil {
+		return err
+	}
+	if err = verifySessionPolicySignature(bts, sig, pk); err != nil {
+		return err
+	}
+	policy := &SessionPolicy{}
+	if err = json.Unmarshal(bts, policy); err != nil {
+		return errors.WrapPrefix(err, "Failed to parse session policy", 0)
+	}
+	client.lock.Lock()
+	client.managedSessionPolicy = policy
+	client.lock.Unlock()
+	return nil
+}
+
+func verifySessionPolicySignature(bts, sig []byte, pk *ecdsa.PublicKey) error {
+	ints := make([]*gobig.Int, 0, 2)
+	if _, err := asn1.Unmarshal(sig, &ints); err != nil {
+		return errors.WrapPrefix(err, "Failed to parse session policy signature", 0)
+	}
+	hash := sha256.Sum256(bts)
+	if len(ints) != 2 || !ecdsa.Verify(pk, hash[:], ints[0], ints[1]) {
+		return errors.New("Session policy signature was invalid")
+	}
+	return nil
+}
+
+// checkSessionPolicies returns an error if the session policy of the user or the managed
+// session policy blocks a session with the specified host and session request.
+func (client *Client) checkSessionPolicies(hostname string, request irma.SessionRequest) error {
+	if err := client.managedSessionPolicy.Check(hostname, request); err != nil {
+		return err
+	}
+	return client.Preferences.SessionPolicy.Check(hostname, request)
+}
@@ -8,23 +8,83 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi"
 	"github.com/privacybydesign/irmago"
 	"github.com/privacybydesign/irmago/internal/fs"
 	"go.etcd.io/bbolt"
 )
 
-// This file contains the storage struct and its methods,
-// and some general filesystem functions.
+// This file contains the Storage interface, the default implementation of it
+// using a bbolt database, and some general filesystem functions.
+
+// Storage persists everything that a Client stores: its secret key, attributes and their
+// signatures, keyshare server registrations, executed updates, preferences, and log entries.
+// Embedders may pass their own implementation to New(); by default a Client stores itself in
+// a bbolt database within its storage path. The Load methods return nil values
+// (and no error) if nothing was stored yet.
+type Storage interface {
+	// EnsureStorageExists is called by New() before anything is loaded or stored.
+	EnsureStorageExists() error
+	// Close releases the storage. It is called by Client.Close(), and by New() if it fails
+	// after EnsureStorageExists().
+	Close() error
+
+	// Transaction calls f with a StorageTransaction through which f makes its changes, committing
+	// all of them atomically if f returns nil and discarding all of them otherwise.
+	// f must not call the methods of the Storage itself.
+	Transaction(f func(tx StorageTransaction) error) error
+
+	LoadSecretKey() (*SecretKey, error)
+	LoadAttributes() ([]*irma.AttributeList, error)
+	LoadSignature(attrs *irma.AttributeList) (*gabi.CLSignature, error)
+	// LoadSignatureHashes returns the hashes of the attributes of all stored signatures.
+	LoadSignatureHashes() ([]string, error)
+	LoadKeyshareServers() (map[irma.SchemeManagerIdentifier]*KeyshareServer, error)
+	LoadUpdates() ([]Update, error)
+	LoadPreferences() (*Preferences, error)
+
+	// LoadNewestLogs returns the newest log entries sorted from new to old,
+	// with a maximum result length of max.
+	LoadNewestLogs(max int) ([]*LogEntry, error)
+	// LoadLogsBefore returns the log entries stored before the log entry with the specified ID,
+	// sorted from new to old, with a maximum result length of max.
+	LoadLogsBefore(index uint64, max int) ([]*LogEntry, error)
+}
+
+// StorageTransaction makes changes to a Storage within Storage.Transaction().
+type StorageTransaction interface {
+	StoreSecretKey(sk *SecretKey) error
+	StoreAttributes(attributes []*irma.AttributeList) error
+	StoreSignature(attrs *irma.AttributeList, signature *gabi.CLSignature) error
+	// DeleteSignature deletes the signature of the attributes having the specified hash.
+	DeleteSignature(hash string) error
+	StoreKeyshareServers(keyshareServers map[irma.SchemeManagerIdentifier]*KeyshareServer) error
+	StoreUpdates(updates []Update) error
+	StorePreferences(prefs Preferences) error
+
+	// AddLogEntry stores the log entry, assigning it the next ID in the ID field.
+	AddLogEntry(entry *LogEntry) error
+	// UpdateLogEntry overwrites the stored log entry having the ID of the specified log entry.
+	UpdateLogEntry(entry *LogEntry) error
+	// DeleteLogEntry deletes the log entry with the specified ID, if present.
+	DeleteLogEntry(id uint64) error
+	// DeleteLogsBefore deletes all log entries stored before the log entry with the specified ID.
+	DeleteLogsBefore(id uint64) error
+}
+
+// boltStorage is the default Storage, storing everything in a bbolt database.
+type boltStorage struct {
+	storagePath string
+	db          *bbolt.DB
+}
 
-// Storage provider for a Client
-type storage struct {
-	storagePath   string
-	db            *bbolt.DB
-	Configuration *irma.Configuration
+type boltTransaction struct {
+	*bbolt.Tx
 }
 
-// Filenames in which we store stuff
+// Keys under which we store stuff in the userdata bucket, being the names
+// of the files in which older versions stored them
 const (
 	skFile          = "sk"
 	attributesFile  = "attrs"
@@ -39,10 +99,12 @@ const (
 
 // Bucketnames bbolt
 const (
-	logsBucket = "logs"
+	userdataBucket   = "userdata"
+	signaturesBucket = "sigs" // Keys are the hashes of the attributes of the credentials
+	logsBucket       = "logs"
 )
 
-func (s *storage) path(p string) string {
+func (s *boltStorage) path(p string) string {
 	return filepath.Join(s.storagePath, p)
 }
 
@@ -51,19 +113,34 @@ func (s *storage) path(p string) string {
 // NOTE: we do not create the folder if it does not exist!
 // Setting it up in a properly protected location (e.g., with automatic
 // backups to iCloud/Google disabled) is the responsibility of the user.
-func (s *storage) EnsureStorageExists() error {
+func (s *boltStorage) EnsureStorageExists() error {
 	var err error
 	if err = fs.AssertPathExists(s.storagePath); err != nil {
 		return err
 	}
-	if err = fs.EnsureDirectoryExists(s.path(signaturesDir)); err != nil {
-		return err
-	}
 	s.db, err = bbolt.Open(s.path(databaseFile), 0600, &bbolt.Options{Timeout: 1 * time.Second})
 	return err
 }
 
-func (s *storage) load(dest interface{}, path string) (err error) {
+func (s *boltStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltStorage) Transaction(f func(tx StorageTransaction) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return f(boltTransaction{tx})
+	})
+}
+
+// hasLegacySecretKey returns whether the file in which older versions stored the secret key still
+// exists, i.e. the migration to bbolt of the secret key has not (successfully) been done.
+func (s *boltStorage) hasLegacySecretKey() (bool, error) {
+	return fs.PathExists(s.path(skFile))
+}
+
+// loadFile loads the specified file in which older versions stored stuff
+// (see the migration to bbolt in clientUpdates).
+func (s *boltStorage) loadFile(dest interface{}, path string) (err error) {
 	exists, err := fs.PathExists(s.path(path))
 	if err != nil || !exists {
 		return
@@ -75,61 +152,74 @@ func (s *storage) load(dest interface{}, path string) (err error) {
 	return json.Unmarshal(bytes, dest)
 }
 
-func (s *storage) store(contents interface{}, file string) error {
+// load loads the value of the specified key from the specified bucket into dest,
+// returning whether it was present.
+func (s *boltStorage) load(bucket, key string, dest interface{}) (found bool, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, dest)
+	})
+	return
+}
+
+func (tx boltTransaction) store(bucket, key string, contents interface{}) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
 	bts, err := json.Marshal(contents)
 	if err != nil {
 		return err
 	}
-	return fs.SaveFile(s.path(file), bts)
+	return b.Put([]byte(key), bts)
+}
+
+func (tx boltTransaction) DeleteSignature(hash string) error {
+	b := tx.Bucket([]byte(signaturesBucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(hash))
 }
 
-func (s *storage) signatureFilename(attrs *irma.AttributeList) string {
-	// We take the SHA256 hash over all attributes as the filename for the signature.
+func (tx boltTransaction) StoreSignature(attrs *irma.AttributeList, signature *gabi.CLSignature) error {
+	// We take the SHA256 hash over all attributes as the key for the signature.
 	// This means that the signatures of two credentials that have identical attributes
-	// will be written to the same file, one overwriting the other - but that doesn't
+	// will be written to the same key, one overwriting the other - but that doesn't
 	// matter, because either one of the signatures is valid over both attribute lists,
 	// so keeping one of them suffices.
-	return filepath.Join(signaturesDir, attrs.Hash())
+	return tx.store(signaturesBucket, attrs.Hash(), signature)
 }
 
-func (s *storage) DeleteSignature(attrs *irma.AttributeList) error {
-	return os.Remove(s.path(s.signatureFilename(attrs)))
+func (tx boltTransaction) StoreSecretKey(sk *SecretKey) error {
+	return tx.store(userdataBucket, skFile, sk)
 }
 
-func (s *storage) StoreSignature(cred *credential) error {
-	return s.store(cred.Signature, s.signatureFilename(cred.AttributeList()))
+func (tx boltTransaction) StoreAttributes(attributes []*irma.AttributeList) error {
+	return tx.store(userdataBucket, attributesFile, attributes)
 }
 
-func (s *storage) StoreSecretKey(sk *secretKey) error {
-	return s.store(sk, skFile)
+func (tx boltTransaction) StoreKeyshareServers(keyshareServers map[irma.SchemeManagerIdentifier]*KeyshareServer) error {
+	return tx.store(userdataBucket, kssFile, keyshareServers)
 }
 
-func (s *storage) StoreAttributes(attributes map[irma.CredentialTypeIdentifier][]*irma.AttributeList) error {
-	temp := []*irma.AttributeList{}
-	for _, attrlistlist := range attributes {
-		for _, attrlist := range attrlistlist {
-			temp = append(temp, attrlist)
-		}
-	}
-
-	return s.store(temp, attributesFile)
+func (tx boltTransaction) StorePreferences(prefs Preferences) error {
+	return tx.store(userdataBucket, preferencesFile, prefs)
 }
 
-func (s *storage) StoreKeyshareServers(keyshareServers map[irma.SchemeManagerIdentifier]*keyshareServer) error {
-	return s.store(keyshareServers, kssFile)
+func (tx boltTransaction) StoreUpdates(updates []Update) error {
+	return tx.store(userdataBucket, updatesFile, updates)
 }
 
-func (s *storage) StoreLogs(logs []*LogEntry) error {
-	return s.store(logs, logsFile)
-}
-
-func (s *storage) AddLogEntry(entry *LogEntry) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
-		return s.TxAddLogEntry(tx, entry)
-	})
-}
-
-func (s *storage) TxAddLogEntry(tx *bbolt.Tx, entry *LogEntry) error {
+func (tx boltTransaction) AddLogEntry(entry *LogEntry) error {
 	b, err := tx.CreateBucketIfNotExists([]byte(logsBucket))
 	if err != nil {
 		return err
@@ -139,140 +229,278 @@ func (s *storage) TxAddLogEntry(tx *bbolt.Tx, entry *LogEntry) error {
 	if err != nil {
 		return err
 	}
-	k := s.logEntryKeyToBytes(entry.ID)
+	k := logEntryKeyToBytes(entry.ID)
 	v, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
 
 	return b.Put(k, v)
 }
 
-func (s *storage) logEntryKeyToBytes(id uint64) []byte {
-	k := make([]byte, 8)
-	binary.BigEndian.PutUint64(k, id)
-	return k
+func (tx boltTransaction) UpdateLogEntry(entry *LogEntry) error {
+	b := tx.Bucket([]byte(logsBucket))
+	k := logEntryKeyToBytes(entry.ID)
+	if b == nil || b.Get(k) == nil {
+		return errors.Errorf("Log entry %d not found", entry.ID)
+	}
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, v)
 }
 
-func (s *storage) StorePreferences(prefs Preferences) error {
-	return s.store(prefs, preferencesFile)
+func (tx boltTransaction) DeleteLogEntry(id uint64) error {
+	b := tx.Bucket([]byte(logsBucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete(logEntryKeyToBytes(id))
+}
+
+func (tx boltTransaction) DeleteLogsBefore(id uint64) error {
+	b := tx.Bucket([]byte(logsBucket))
+	if b == nil {
+		return nil
+	}
+	// Modifying the bucket while iterating over it with a cursor is not safe,
+	// so we first collect the keys and then delete them
+	var keys [][]byte
+	err := iterateLogs(b, logsBefore(id), func(k, _ []byte) (bool, error) {
+		keys = append(keys, k)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *storage) StoreUpdates(updates []update) (err error) {
-	return s.store(updates, updatesFile)
+func logEntryKeyToBytes(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
 }
 
-func (s *storage) LoadSignature(attrs *irma.AttributeList) (signature *gabi.CLSignature, err error) {
-	sigpath := s.signatureFilename(attrs)
-	if err := fs.AssertPathExists(s.path(sigpath)); err != nil {
-		return nil, err
-	}
-	signature = new(gabi.CLSignature)
-	if err := s.load(signature, sigpath); err != nil {
+func (s *boltStorage) LoadSignature(attrs *irma.AttributeList) (*gabi.CLSignature, error) {
+	signature := new(gabi.CLSignature)
+	found, err := s.load(signaturesBucket, attrs.Hash(), signature)
+	if err != nil || !found {
 		return nil, err
 	}
 	return signature, nil
 }
 
-// LoadSecretKey retrieves and returns the secret key from storage, or if no secret key
-// was found in storage, it generates, saves, and returns a new secret key.
-func (s *storage) LoadSecretKey() (*secretKey, error) {
-	var err error
-	sk := &secretKey{}
-	if err = s.load(sk, skFile); err != nil {
-		return nil, err
-	}
-	if sk.Key != nil {
-		return sk, nil
-	}
+func (s *boltStorage) LoadSignatureHashes() ([]string, error) {
+	hashes := []string{}
+	return hashes, s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(signaturesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			hashes = append(hashes, string(k))
+			return nil
+		})
+	})
+}
 
-	if sk, err = generateSecretKey(); err != nil {
-		return nil, err
-	}
-	if err = s.StoreSecretKey(sk); err != nil {
+func (s *boltStorage) LoadSecretKey() (*SecretKey, error) {
+	sk := &SecretKey{}
+	found, err := s.load(userdataBucket, skFile, sk)
+	if err != nil || !found {
 		return nil, err
 	}
 	return sk, nil
 }
 
-func (s *storage) LoadAttributes() (list map[irma.CredentialTypeIdentifier][]*irma.AttributeList, err error) {
+func (s *boltStorage) LoadAttributes() ([]*irma.AttributeList, error) {
 	// The attributes are stored as a list of instances of AttributeList
-	temp := []*irma.AttributeList{}
-	if err = s.load(&temp, attributesFile); err != nil {
-		return
-	}
-
-	list = make(map[irma.CredentialTypeIdentifier][]*irma.AttributeList)
-	for _, attrlist := range temp {
-		attrlist.MetadataAttribute = irma.MetadataFromInt(attrlist.Ints[0], s.Configuration)
-		id := attrlist.CredentialType()
-		var ct irma.CredentialTypeIdentifier
-		if id != nil {
-			ct = id.Identifier()
-		}
-		if _, contains := list[ct]; !contains {
-			list[ct] = []*irma.AttributeList{}
-		}
-		list[ct] = append(list[ct], attrlist)
+	list := []*irma.AttributeList{}
+	if _, err := s.load(userdataBucket, attributesFile, &list); err != nil {
+		return nil, err
 	}
-
 	return list, nil
 }
 
-func (s *storage) LoadKeyshareServers() (ksses map[irma.SchemeManagerIdentifier]*keyshareServer, err error) {
-	ksses = make(map[irma.SchemeManagerIdentifier]*keyshareServer)
-	if err := s.load(&ksses, kssFile); err != nil {
+func (s *boltStorage) LoadKeyshareServers() (map[irma.SchemeManagerIdentifier]*KeyshareServer, error) {
+	ksses := make(map[irma.SchemeManagerIdentifier]*KeyshareServer)
+	if _, err := s.load(userdataBucket, kssFile, &ksses); err != nil {
 		return nil, err
 	}
 	return ksses, nil
 }
 
-// Returns all logs stored before log with ID 'index' sorted from new to old with
-// a maximum result length of 'max'.
-func (s *storage) LoadLogsBefore(index uint64, max int) ([]*LogEntry, error) {
-	return s.loadLogs(max, func(c *bbolt.Cursor) (key, value []byte) {
-		c.Seek(s.logEntryKeyToBytes(index))
-		return c.Prev()
-	})
+func (s *boltStorage) LoadLogsBefore(index uint64, max int) ([]*LogEntry, error) {
+	return s.loadLogs(max, logsBefore(index))
 }
 
-// Returns the latest logs stored sorted from new to old with a maximum result length of 'max'
-func (s *storage) LoadNewestLogs(max int) ([]*LogEntry, error) {
+func (s *boltStorage) LoadNewestLogs(max int) ([]*LogEntry, error) {
 	return s.loadLogs(max, func(c *bbolt.Cursor) (key, value []byte) {
 		return c.Last()
 	})
 }
 
+// logsBefore returns a starting position for iterateLogs() at the log entry stored before the
+// log entry with the specified ID.
+func logsBefore(index uint64) func(*bbolt.Cursor) (key, value []byte) {
+	return func(c *bbolt.Cursor) (key, value []byte) {
+		if k, _ := c.Seek(logEntryKeyToBytes(index)); k == nil {
+			// There are no log entries at or after index, so start at the last one
+			return c.Last()
+		}
+		return c.Prev()
+	}
+}
+
+// iterateLogs calls f on the keys and values of the log entries in the bucket from new to old,
+// where the starting position of the bbolt cursor can be manipulated by the anonymous function
+// 'startAt' (see loadLogs()), until f returns false or an error.
+func iterateLogs(bucket *bbolt.Bucket, startAt func(*bbolt.Cursor) (key, value []byte), f func(k, v []byte) (bool, error)) error {
+	c := bucket.Cursor()
+	for k, v := startAt(c); k != nil; k, v = c.Prev() {
+		if cont, err := f(k, v); err != nil || !cont {
+			return err
+		}
+	}
+	return nil
+}
+
 // Returns the logs stored sorted from new to old with a maximum result length of 'max' where the starting position
 // of the bbolt cursor can be manipulated by the anonymous function 'startAt'. 'startAt' should return
 // the key and the value of the first element from the bbolt database that should be loaded.
-func (s *storage) loadLogs(max int, startAt func(*bbolt.Cursor) (key, value []byte)) ([]*LogEntry, error) {
+func (s *boltStorage) loadLogs(max int, startAt func(*bbolt.Cursor) (key, value []byte)) ([]*LogEntry, error) {
 	logs := make([]*LogEntry, 0, max)
 	return logs, s.db.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(logsBucket))
 		if bucket == nil {
 			return nil
 		}
-		c := bucket.Cursor()
-
-		for k, v := startAt(c); k != nil && len(logs) < max; k, v = c.Prev() {
+		return iterateLogs(bucket, startAt, func(_, v []byte) (bool, error) {
+			if len(logs) >= max {
+				return false, nil
+			}
 			var log LogEntry
 			if err := json.Unmarshal(v, &log); err != nil {
-				return err
+				return false, err
 			}
-
 			logs = append(logs, &log)
-		}
-		return nil
+			return true, nil
+		})
 	})
 }
 
-func (s *storage) LoadUpdates() (updates []update, err error) {
-	updates = []update{}
-	if err := s.load(&updates, updatesFile); err != nil {
+// LoadUpdates loads the updates from the database, or if not present there, from the file in
+// which older versions stored them (as the updates determine whether or not the migration
+// to bbolt still has to be done).
+func (s *boltStorage) LoadUpdates() ([]Update, error) {
+	updates := []Update{}
+	found, err := s.load(userdataBucket, updatesFile, &updates)
+	if err != nil {
 		return nil, err
 	}
+	if !found {
+		if err = s.loadFile(&updates, updatesFile); err != nil {
+			return nil, err
+		}
+	}
 	return updates, nil
 }
 
-func (s *storage) LoadPreferences() (Preferences, error) {
+// LoadPreferences loads the preferences from the database, or if not present there, from the file
+// in which older versions stored them (as the preferences are loaded before the migration to bbolt).
+func (s *boltStorage) LoadPreferences() (*Preferences, error) {
 	config := defaultPreferences
-	return config, s.load(&config, preferencesFile)
+	found, err := s.load(userdataBucket, preferencesFile, &config)
+	if err != nil || found {
+		return &config, err
+	}
+	exists, err := fs.PathExists(s.path(preferencesFile))
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &config, s.loadFile(&config, preferencesFile)
+}
+
+// migrateFiles moves the secret key, attributes, signatures, keyshare servers and preferences
+// from the files in which older versions stored them into the database in a single transaction,
+// removing the files afterwards.
+func (s *boltStorage) migrateFiles() error {
+	var sk *SecretKey
+	var attrs []*irma.AttributeList
+	var ksses map[irma.SchemeManagerIdentifier]*KeyshareServer
+	files := []struct {
+		name string
+		dest interface{}
+	}{{skFile, &sk}, {attributesFile, &attrs}, {kssFile, &ksses}}
+	for _, file := range files {
+		if err := s.loadFile(file.dest, file.name); err != nil {
+			return errors.WrapPrefix(err, "Failed to read "+file.name, 0)
+		}
+	}
+	prefs, err := s.LoadPreferences()
+	if err != nil {
+		return err
+	}
+
+	sigs := map[string]*gabi.CLSignature{}
+	infos, err := ioutil.ReadDir(s.path(signaturesDir))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, info := range infos {
+		sig := new(gabi.CLSignature)
+		if err = s.loadFile(sig, filepath.Join(signaturesDir, info.Name())); err != nil {
+			return errors.WrapPrefix(err, "Failed to read signature "+info.Name(), 0)
+		}
+		sigs[info.Name()] = sig
+	}
+
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		btx := boltTransaction{tx}
+		if sk != nil {
+			if err := btx.StoreSecretKey(sk); err != nil {
+				return err
+			}
+		}
+		if attrs != nil {
+			if err := btx.StoreAttributes(attrs); err != nil {
+				return err
+			}
+		}
+		if ksses != nil {
+			if err := btx.StoreKeyshareServers(ksses); err != nil {
+				return err
+			}
+		}
+		if prefs != nil {
+			if err := btx.StorePreferences(*prefs); err != nil {
+				return err
+			}
+		}
+		for hash, sig := range sigs {
+			if err := btx.store(signaturesBucket, hash, sig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The updates file is left alone: once the updates are stored in the database
+	// after this migration, the file is ignored
+	for _, file := range []string{skFile, attributesFile, kssFile, preferencesFile, signaturesDir} {
+		if err = os.RemoveAll(s.path(file)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -4,14 +4,15 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/go-errors/errors"
 	"github.com/privacybydesign/irmago"
-	"go.etcd.io/bbolt"
 )
 
 // This file contains the update mechanism for Client
 // as well as updates themselves.
 
-type update struct {
+// Update records the execution of one of the clientUpdates.
+type Update struct {
 	When    irma.Timestamp
 	Number  int
 	Success bool
@@ -44,38 +45,76 @@ var clientUpdates = []func(client *Client) error{
 
 	// 7: Concert log entries to bbolt database
 	func(client *Client) error {
+		// Only the default storage may contain log entries in the old format
+		s, ok := client.storage.(*boltStorage)
+		if !ok {
+			return nil
+		}
 		var logs []*LogEntry
-		var err error
-		if err = client.storage.load(&logs, logsFile); err != nil {
+		if err := s.loadFile(&logs, logsFile); err != nil {
 			return err
 		}
+		for _, log := range logs {
+			// As log.Request is a json.RawMessage it would not get updated to the new session request
+			// format by re-marshaling the containing struct, as normal struct members would,
+			// so update it manually now by marshaling the session request into it.
+			req, err := log.SessionRequest()
+			if err != nil {
+				return err
+			}
+			log.Request, err = json.Marshal(req)
+			if err != nil {
+				return err
+			}
+		}
 		// Open one bolt transaction to process all our log entries in
-		err = client.storage.db.Update(func(tx *bbolt.Tx) error {
+		return client.storage.Transaction(func(tx StorageTransaction) error {
 			for _, log := range logs {
-				// As log.Request is a json.RawMessage it would not get updated to the new session request
-				// format by re-marshaling the containing struct, as normal struct members would,
-				// so update it manually now by marshaling the session request into it.
-				req, err := log.SessionRequest()
-				if err != nil {
-					return err
-				}
-				log.Request, err = json.Marshal(req)
-				if err != nil {
-					return err
-				}
-				if err = client.storage.TxAddLogEntry(tx, log); err != nil {
+				if err := tx.AddLogEntry(log); err != nil {
 					return err
 				}
 			}
 			return nil
 		})
-		return err
 	},
+
+	// 8: Move the secret key, attributes, signatures, keyshare servers and preferences
+	// out of their separate files into the bbolt database
+	func(client *Client) error {
+		// Only the default storage may contain these files
+		s, ok := client.storage.(*boltStorage)
+		if !ok {
+			return nil
+		}
+		return s.migrateFiles()
+	},
+}
+
+// assertUpdated returns an error if not all updates from clientUpdates have been performed
+// successfully.
+func (client *Client) assertUpdated() error {
+	updates, err := client.storage.LoadUpdates()
+	if err != nil {
+		return err
+	}
+	done := map[int]bool{}
+	for _, u := range updates {
+		if u.Success {
+			done[u.Number] = true
+		}
+	}
+	for i := range clientUpdates {
+		if !done[i] {
+			return errors.Errorf("Storage has not been migrated (update %d is pending)", i)
+		}
+	}
+	client.updates = updates
+	return nil
 }
 
 // update performs any function from clientUpdates that has not
-// already been executed in the past, keeping track of previously executed updates
-// in the file at updatesFile.
+// already been executed successfully in the past, keeping track of previously executed updates
+// in storage. A failed update is recorded, but performed again the next time.
 func (client *Client) update() error {
 	// Load and parse file containing info about already performed updates
 	var err error
@@ -83,13 +122,19 @@ func (client *Client) update() error {
 		return err
 	}
 
-	// Perform all new updates
-	for i := len(client.updates); i < len(clientUpdates); i++ {
+	// Perform all new updates, starting after the last successful one
+	next := 0
+	for _, u := range client.updates {
+		if u.Success && u.Number >= next {
+			next = u.Number + 1
+		}
+	}
+	for i := next; i < len(clientUpdates); i++ {
 		err = nil
 		if clientUpdates[i] != nil {
 			err = clientUpdates[i](client)
 		}
-		u := update{
+		u := Update{
 			When:    irma.Timestamp(time.Now()),
 			Number:  i,
 			Success: err == nil,
@@ -104,7 +149,9 @@ func (client *Client) update() error {
 		}
 	}
 
-	storeErr := client.storage.StoreUpdates(client.updates)
+	storeErr := client.storage.Transaction(func(tx StorageTransaction) error {
+		return tx.StoreUpdates(client.updates)
+	})
 	if storeErr != nil {
 		return storeErr
 	}
@@ -4,12 +4,13 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/xml"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"crypto/sha256"
@@ -53,17 +54,40 @@ type Configuration struct {
 	// (i.e., invalid signature, parsing error), and the problem that occurred when parsing them
 	DisabledSchemeManagers map[SchemeManagerIdentifier]*SchemeManagerError
 
+	// RequestorSchemes contains the requestor schemes, listing requestors by hostname;
+	// DisabledRequestorSchemes the ones that did not parse or verify successfully
+	RequestorSchemes         map[RequestorSchemeIdentifier]*RequestorScheme
+	DisabledRequestorSchemes map[RequestorSchemeIdentifier]error
+
 	Warnings []string
 
-	kssPublicKeys map[SchemeManagerIdentifier]map[int]*rsa.PublicKey
-	publicKeys    map[IssuerIdentifier]map[int]*gabi.PublicKey
-	privateKeys   map[IssuerIdentifier]*gabi.PrivateKey
-	reverseHashes map[string]CredentialTypeIdentifier
-	initialized   bool
-	assets        string
-	readOnly      bool
-	cronchan      chan bool
-	scheduler     *gocron.Scheduler
+	kssPublicKeys      map[SchemeManagerIdentifier]map[int]*rsa.PublicKey
+	publicKeys         *publicKeyCache
+	privateKeys        map[IssuerIdentifier]*gabi.PrivateKey
+	reverseHashes      map[string]CredentialTypeIdentifier
+	requestors         map[string]*RequestorInfo
+	initialized        bool
+	assets             string
+	filesystem         ConfigurationFS // nil means the OS file system
+	readOnly           bool
+	cronchan           chan bool
+	scheduler          *gocron.Scheduler
+	schemeMirrors      map[SchemeManagerIdentifier][]string
+	publicKeyCacheSize int
+	requiredLanguages  []string
+
+	// lock protects the fields above, which are replaced as a whole when updating (see swap()),
+	// keyLock the key caches which are populated lazily, and updateLock serializes updates.
+	// If both lock and keyLock are needed, keyLock must be acquired first.
+	lock            sync.RWMutex
+	keyLock         sync.Mutex
+	updateLock      sync.Mutex
+	subscribers     []func()
+	updateListeners []*updateListener
+}
+
+type updateListener struct {
+	listener func(*ConfigurationDiff)
 }
 
 // ConfigurationFileHash encodes the SHA256 hash of an authenticated
@@ -99,6 +123,10 @@ const (
 	privkeyPattern = "%s/%s/%s/PrivateKeys/*.xml"
 )
 
+// PublicKeyExpiryWarningPeriod is the period before their expiry date in which warnings are
+// emitted about public keys that expire soon.
+const PublicKeyExpiryWarningPeriod = 31 * 24 * time.Hour
+
 func (sme SchemeManagerError) Error() string {
 	return fmt.Sprintf("Error parsing scheme manager %s: %s", sme.Manager.Name(), sme.Err.Error())
 }
@@ -154,20 +182,38 @@ func (conf *Configuration) clear() {
 	conf.AttributeTypes = make(map[AttributeTypeIdentifier]*AttributeType)
 	conf.DisabledSchemeManagers = make(map[SchemeManagerIdentifier]*SchemeManagerError)
 	conf.kssPublicKeys = make(map[SchemeManagerIdentifier]map[int]*rsa.PublicKey)
-	conf.publicKeys = make(map[IssuerIdentifier]map[int]*gabi.PublicKey)
+	conf.publicKeys = newPublicKeyCache(conf.publicKeyCacheSize)
 	conf.privateKeys = make(map[IssuerIdentifier]*gabi.PrivateKey)
 	conf.reverseHashes = make(map[string]CredentialTypeIdentifier)
+	conf.RequestorSchemes = make(map[RequestorSchemeIdentifier]*RequestorScheme)
+	conf.DisabledRequestorSchemes = make(map[RequestorSchemeIdentifier]error)
+	conf.requestors = make(map[string]*RequestorInfo)
 }
 
 // ParseFolder populates the current Configuration by parsing the storage path,
 // listing the containing scheme managers, issuers and credential types.
-func (conf *Configuration) ParseFolder() (err error) {
-	// Init all maps
-	conf.clear()
+// The folder is parsed into a fresh copy of the Configuration, which then atomically replaces
+// the current contents. If an error other than a *SchemeManagerError occurs, the current contents
+// are kept.
+func (conf *Configuration) ParseFolder() error {
+	conf.lock.RLock()
+	fresh := conf.emptyCopy()
+	conf.lock.RUnlock()
+	err := fresh.parseFolder()
+	if _, isSchemeMgrErr := err.(*SchemeManagerError); err != nil && !isSchemeMgrErr {
+		return err
+	}
+	conf.updateLock.Lock()
+	notify := conf.swap(fresh)
+	conf.updateLock.Unlock()
+	notify()
+	return err
+}
 
+func (conf *Configuration) parseFolder() (err error) {
 	// Copy any new or updated scheme managers out of the assets into storage
 	if conf.assets != "" {
-		err = iterateSubfolders(conf.assets, func(dir string, _ os.FileInfo) error {
+		err = iterateSubfolders(osFS{}, conf.assets, func(dir string, _ os.FileInfo) error {
 			scheme := NewSchemeManagerIdentifier(filepath.Base(dir))
 			uptodate, err := conf.isUpToDate(scheme)
 			if err != nil {
@@ -185,9 +231,19 @@ func (conf *Configuration) ParseFolder() (err error) {
 
 	// Parse scheme managers in storage
 	var mgrerr *SchemeManagerError
-	err = iterateSubfolders(conf.Path, func(dir string, _ os.FileInfo) error {
+	err = iterateSubfolders(conf.files(), conf.Path, func(dir string, _ os.FileInfo) error {
+		if isRequestorScheme, err := conf.isRequestorScheme(dir); err != nil || isRequestorScheme {
+			if err == nil {
+				err = conf.parseRequestorSchemeFolder(dir)
+			}
+			if err != nil {
+				// Failing requestor schemes only affect how requestors are shown, so continue
+				conf.DisabledRequestorSchemes[NewRequestorSchemeIdentifier(filepath.Base(dir))] = err
+			}
+			return nil
+		}
 		manager := NewSchemeManager(filepath.Base(dir))
-		err := conf.ParseSchemeManagerFolder(dir, manager)
+		err := conf.parseSchemeManagerFolder(dir, manager)
 		if err == nil {
 			return nil // OK, do next scheme manager folder
 		}
@@ -227,17 +283,18 @@ func (conf *Configuration) ParseOrRestoreFolder() error {
 		return err
 	}
 
-	for id := range conf.DisabledSchemeManagers {
-		if err = conf.ReinstallSchemeManager(conf.SchemeManagers[id]); err == nil {
+	conf.lock.RLock()
+	disabled := conf.DisabledSchemeManagers
+	conf.lock.RUnlock()
+	for id := range disabled {
+		if err = conf.ReinstallSchemeManager(conf.SchemeManager(id)); err == nil {
 			continue
 		}
 		if _, err = conf.CopyManagerFromAssets(id); err != nil {
 			return err // File system error, too serious, bail out now
 		}
 		name := id.String()
-		if err = conf.ParseSchemeManagerFolder(filepath.Join(conf.Path, name), NewSchemeManager(name)); err == nil {
-			delete(conf.DisabledSchemeManagers, id)
-		}
+		err = conf.ParseSchemeManagerFolder(filepath.Join(conf.Path, name), NewSchemeManager(name))
 	}
 
 	return err
@@ -245,7 +302,27 @@ func (conf *Configuration) ParseOrRestoreFolder() error {
 
 // ParseSchemeManagerFolder parses the entire tree of the specified scheme manager
 // If err != nil then a problem occured
-func (conf *Configuration) ParseSchemeManagerFolder(dir string, manager *SchemeManager) (err error) {
+func (conf *Configuration) ParseSchemeManagerFolder(dir string, manager *SchemeManager) error {
+	err := conf.update(func(fresh *Configuration) error {
+		err := fresh.parseSchemeManagerFolder(dir, manager)
+		if err == nil {
+			delete(fresh.DisabledSchemeManagers, manager.Identifier())
+		}
+		return err
+	})
+	if mgrerr, ok := err.(*SchemeManagerError); ok {
+		// The partially parsed scheme is not swapped in; only keep the manager, marked as disabled,
+		// as ParseFolder() does
+		_ = conf.update(func(fresh *Configuration) error {
+			fresh.SchemeManagers[manager.Identifier()] = manager
+			fresh.DisabledSchemeManagers[manager.Identifier()] = mgrerr
+			return nil
+		})
+	}
+	return err
+}
+
+func (conf *Configuration) parseSchemeManagerFolder(dir string, manager *SchemeManager) (err error) {
 	// From this point, keep it in our map even if it has an error. The user must check either:
 	// - manager.Status == SchemeManagerStatusValid, aka "VALID"
 	// - or equivalently, manager.Valid == true
@@ -292,7 +369,7 @@ func (conf *Configuration) ParseSchemeManagerFolder(dir string, manager *SchemeM
 	}
 
 	// Read timestamp indicating time of last modification
-	ts, exists, err := readTimestamp(dir + "/timestamp")
+	ts, exists, err := readTimestamp(conf.files(), dir+"/timestamp")
 	if err != nil || !exists {
 		return errors.WrapPrefix(err, "Could not read scheme manager timestamp", 0)
 	}
@@ -309,14 +386,18 @@ func (conf *Configuration) ParseSchemeManagerFolder(dir string, manager *SchemeM
 	return
 }
 
-// PrivateKey returns the specified private key, or nil if not present in the Configuration.
+// PrivateKey returns the private key of the specified issuer with the highest counter whose
+// public key is not expired (or the one with the highest counter, if all public keys are expired),
+// or nil if not present in the Configuration.
 func (conf *Configuration) PrivateKey(id IssuerIdentifier) (*gabi.PrivateKey, error) {
+	conf.keyLock.Lock()
+	defer conf.keyLock.Unlock()
 	if sk := conf.privateKeys[id]; sk != nil {
 		return sk, nil
 	}
 
 	path := fmt.Sprintf(privkeyPattern, conf.Path, id.SchemeManagerIdentifier().Name(), id.Name())
-	files, err := filepath.Glob(path)
+	files, err := conf.glob(path)
 	if err != nil {
 		return nil, err
 	}
@@ -337,10 +418,21 @@ func (conf *Configuration) PrivateKey(id IssuerIdentifier) (*gabi.PrivateKey, er
 	}
 	sort.Ints(counters)
 	counter := counters[len(counters)-1]
+	now := time.Now()
+	for i := len(counters) - 1; i >= 0; i-- {
+		pk, err := conf.publicKey(id, counters[i])
+		if err != nil {
+			return nil, err
+		}
+		if pk != nil && !PublicKeyExpired(pk, now) {
+			counter = counters[i]
+			break
+		}
+	}
 
 	// Read private key
 	file := strings.Replace(path, "*", strconv.Itoa(counter), 1)
-	sk, err := gabi.NewPrivateKeyFromFile(file)
+	sk, err := conf.readPrivateKey(file)
 	if err != nil {
 		return nil, err
 	}
@@ -354,21 +446,63 @@ func (conf *Configuration) PrivateKey(id IssuerIdentifier) (*gabi.PrivateKey, er
 
 // PublicKey returns the specified public key, or nil if not present in the Configuration.
 func (conf *Configuration) PublicKey(id IssuerIdentifier, counter int) (*gabi.PublicKey, error) {
-	var haveIssuer, haveKey bool
-	var err error
-	_, haveIssuer = conf.publicKeys[id]
-	if haveIssuer {
-		_, haveKey = conf.publicKeys[id][counter]
+	conf.keyLock.Lock()
+	defer conf.keyLock.Unlock()
+	return conf.publicKey(id, counter)
+}
+
+// publicKey returns the specified public key from the cache, parsing it if it is not present.
+// Public keys that are not found are not cached, as they might be added to the scheme later.
+func (conf *Configuration) publicKey(id IssuerIdentifier, counter int) (*gabi.PublicKey, error) {
+	if pk := conf.publicKeys.get(id, counter); pk != nil {
+		return pk, nil
 	}
+	pk, err := conf.parsePublicKey(id, counter)
+	if err != nil || pk == nil {
+		return nil, err
+	}
+	conf.publicKeys.put(id, counter, pk)
+	return pk, nil
+}
 
-	// If we have not seen this issuer or key before in conf.publicKeys,
-	// try to parse the public key folder; new keys might have been put there since we last parsed it
-	if !haveIssuer || !haveKey {
-		if err = conf.parseKeysFolder(id); err != nil {
+// SetPublicKeyCacheSize sets the maximum amount of parsed public keys that this Configuration
+// keeps in memory (default DefaultPublicKeyCacheSize). Public keys that are evicted from the
+// cache are parsed again when they are next used.
+func (conf *Configuration) SetPublicKeyCacheSize(size int) {
+	conf.keyLock.Lock()
+	defer conf.keyLock.Unlock()
+	conf.publicKeyCacheSize = size
+	conf.publicKeys = conf.publicKeys.copy(size)
+}
+
+// NewestValidPublicKey returns the public key of the specified issuer with the highest counter
+// that is valid at the specified time, or nil if there is no such key.
+func (conf *Configuration) NewestValidPublicKey(id IssuerIdentifier, t time.Time) (*gabi.PublicKey, error) {
+	indices, err := conf.PublicKeyIndices(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(indices) - 1; i >= 0; i-- {
+		pk, err := conf.PublicKey(id, indices[i])
+		if err != nil {
 			return nil, err
 		}
+		if pk != nil && !PublicKeyExpired(pk, t) {
+			return pk, nil
+		}
 	}
-	return conf.publicKeys[id][counter], nil
+	return nil, nil
+}
+
+// PublicKeyExpired returns whether the specified public key is expired at the specified time.
+func PublicKeyExpired(pk *gabi.PublicKey, t time.Time) bool {
+	return pk.ExpiryDate < t.Unix()
+}
+
+// PublicKeyExpiresSoon returns whether the specified public key is not expired at the specified
+// time, but will be within PublicKeyExpiryWarningPeriod.
+func PublicKeyExpiresSoon(pk *gabi.PublicKey, t time.Time) bool {
+	return !PublicKeyExpired(pk, t) && PublicKeyExpired(pk, t.Add(PublicKeyExpiryWarningPeriod))
 }
 
 // KeyshareServerKeyFunc returns a function that returns the public key with which to verify a keyshare server JWT,
@@ -388,11 +522,13 @@ func (conf *Configuration) KeyshareServerKeyFunc(scheme SchemeManagerIdentifier)
 
 // KeyshareServerPublicKey returns the i'th public key of the specified scheme.
 func (conf *Configuration) KeyshareServerPublicKey(scheme SchemeManagerIdentifier, i int) (*rsa.PublicKey, error) {
+	conf.keyLock.Lock()
+	defer conf.keyLock.Unlock()
 	if _, contains := conf.kssPublicKeys[scheme]; !contains {
 		conf.kssPublicKeys[scheme] = make(map[int]*rsa.PublicKey)
 	}
 	if _, contains := conf.kssPublicKeys[scheme][i]; !contains {
-		pkbts, err := ioutil.ReadFile(filepath.Join(conf.Path, scheme.Name(), fmt.Sprintf("kss-%d.pem", i)))
+		pkbts, err := conf.readFile(filepath.Join(conf.Path, scheme.Name(), fmt.Sprintf("kss-%d.pem", i)))
 		if err != nil {
 			return nil, err
 		}
@@ -416,6 +552,8 @@ func (conf *Configuration) addReverseHash(credid CredentialTypeIdentifier) {
 }
 
 func (conf *Configuration) hashToCredentialType(hash []byte) *CredentialType {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
 	if str, exists := conf.reverseHashes[base64.StdEncoding.EncodeToString(hash)]; exists {
 		return conf.CredentialTypes[str]
 	}
@@ -424,113 +562,142 @@ func (conf *Configuration) hashToCredentialType(hash []byte) *CredentialType {
 
 // IsInitialized indicates whether this instance has successfully been initialized.
 func (conf *Configuration) IsInitialized() bool {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
 	return conf.initialized
 }
 
 // Prune removes any invalid scheme managers and everything they own from this Configuration
 func (conf *Configuration) Prune() {
-	for _, manager := range conf.SchemeManagers {
+	conf.lock.RLock()
+	managers := conf.SchemeManagers
+	conf.lock.RUnlock()
+	for _, manager := range managers {
 		if !manager.Valid {
 			_ = conf.RemoveSchemeManager(manager.Identifier(), false) // does not return errors
 		}
 	}
 }
 
+// parseIssuerFolders parses the issuers of the specified scheme in parallel. Each issuer is parsed
+// into a separate Configuration, which are merged into this one afterwards in directory order.
 func (conf *Configuration) parseIssuerFolders(manager *SchemeManager, path string) error {
-	return iterateSubfolders(path, func(dir string, _ os.FileInfo) error {
-		issuer := &Issuer{}
-		exists, err := conf.pathToDescription(manager, dir+"/description.xml", issuer)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			return nil
-		}
-		if issuer.XMLVersion < 4 {
-			return errors.New("Unsupported issuer description")
-		}
-
-		if err = conf.validateIssuer(manager, issuer, dir); err != nil {
-			return err
-		}
-
-		conf.Issuers[issuer.Identifier()] = issuer
-		issuer.Valid = conf.SchemeManagers[issuer.SchemeManagerIdentifier()].Valid
-		return conf.parseCredentialsFolder(manager, issuer, dir+"/Issues/")
+	dirs, err := listFiles(conf.files(), path, true)
+	if err != nil {
+		return err
+	}
+	parsed := make([]*Configuration, len(dirs))
+	err = parallel(len(dirs), func(i int) error {
+		parsed[i] = conf.emptyCopy()
+		return parsed[i].parseIssuerFolder(manager, dirs[i])
 	})
+	if err != nil {
+		return err
+	}
+	for _, p := range parsed {
+		conf.merge(p)
+	}
+	return nil
 }
 
-func (conf *Configuration) DeleteSchemeManager(id SchemeManagerIdentifier) error {
-	delete(conf.SchemeManagers, id)
-	delete(conf.DisabledSchemeManagers, id)
-	name := id.String()
-	for iss := range conf.Issuers {
-		if iss.Root() == name {
-			delete(conf.Issuers, iss)
-		}
+func (conf *Configuration) parseIssuerFolder(manager *SchemeManager, dir string) error {
+	issuer := &Issuer{}
+	exists, err := conf.pathToDescription(manager, dir+"/description.xml", issuer)
+	if err != nil {
+		return err
 	}
-	for iss := range conf.publicKeys {
-		if iss.Root() == name {
-			delete(conf.publicKeys, iss)
-		}
+	if !exists {
+		return nil
 	}
-	for cred := range conf.CredentialTypes {
-		if cred.Root() == name {
-			delete(conf.CredentialTypes, cred)
-		}
+	if issuer.XMLVersion < 4 {
+		return errors.New("Unsupported issuer description")
 	}
-	if !conf.readOnly {
-		return os.RemoveAll(filepath.Join(conf.Path, id.Name()))
+
+	if err = conf.validateIssuer(manager, issuer, dir); err != nil {
+		return err
 	}
-	return nil
+
+	conf.Issuers[issuer.Identifier()] = issuer
+	issuer.Valid = manager.Valid
+	return conf.parseCredentialsFolder(manager, issuer, dir+"/Issues/")
 }
 
-// parse $schememanager/$issuer/PublicKeys/$i.xml for $i = 1, ...
-func (conf *Configuration) parseKeysFolder(issuerid IssuerIdentifier) error {
-	manager := conf.SchemeManagers[issuerid.SchemeManagerIdentifier()]
-	conf.publicKeys[issuerid] = map[int]*gabi.PublicKey{}
-	path := fmt.Sprintf(pubkeyPattern, conf.Path, issuerid.SchemeManagerIdentifier().Name(), issuerid.Name())
-	files, err := filepath.Glob(path)
-	if err != nil {
-		return err
+// merge adds the issuers, credential types and attribute types of the specified Configuration,
+// and its warnings, to this one.
+func (conf *Configuration) merge(other *Configuration) {
+	for id, issuer := range other.Issuers {
+		conf.Issuers[id] = issuer
+	}
+	for id, credtype := range other.CredentialTypes {
+		conf.CredentialTypes[id] = credtype
+	}
+	for id, attrtype := range other.AttributeTypes {
+		conf.AttributeTypes[id] = attrtype
 	}
+	for hash, id := range other.reverseHashes {
+		conf.reverseHashes[hash] = id
+	}
+	conf.Warnings = append(conf.Warnings, other.Warnings...)
+}
 
-	for _, file := range files {
-		filename := filepath.Base(file)
-		count := filename[:len(filename)-4]
-		i, err := strconv.Atoi(count)
-		if err != nil {
-			return err
-		}
-		relativepath, err := filepath.Rel(conf.Path, file)
-		if err != nil {
-			return err
-		}
-		bts, found, err := conf.ReadAuthenticatedFile(manager, relativepath)
-		if err != nil || !found {
-			return err
-		}
-		pk, err := gabi.NewPublicKeyFromBytes(bts)
-		if err != nil {
-			return err
+func (conf *Configuration) DeleteSchemeManager(id SchemeManagerIdentifier) error {
+	_ = conf.update(func(fresh *Configuration) error {
+		delete(fresh.SchemeManagers, id)
+		delete(fresh.DisabledSchemeManagers, id)
+		name := id.String()
+		for iss := range fresh.Issuers {
+			if iss.Root() == name {
+				delete(fresh.Issuers, iss)
+			}
 		}
-		if int(pk.Counter) != i {
-			return errors.Errorf("Public key %s of issuer %s has wrong <Counter>", file, issuerid.String())
+		fresh.publicKeys.removeScheme(id)
+		for cred := range fresh.CredentialTypes {
+			if cred.Root() == name {
+				delete(fresh.CredentialTypes, cred)
+			}
 		}
-		pk.Issuer = issuerid.String()
-		conf.publicKeys[issuerid][i] = pk
+		return nil
+	})
+	if !conf.readOnly && conf.onDisk() {
+		return os.RemoveAll(filepath.Join(conf.Path, id.Name()))
 	}
-
 	return nil
 }
 
+// parsePublicKey parses $schememanager/$issuer/PublicKeys/$counter.xml, returning nil if it
+// does not exist.
+func (conf *Configuration) parsePublicKey(issuerid IssuerIdentifier, counter int) (*gabi.PublicKey, error) {
+	manager := conf.SchemeManager(issuerid.SchemeManagerIdentifier())
+	if manager == nil {
+		return nil, nil
+	}
+	relativepath := filepath.Join(issuerid.SchemeManagerIdentifier().Name(), issuerid.Name(), "PublicKeys", strconv.Itoa(counter)+".xml")
+	exists, err := conf.pathExists(filepath.Join(conf.Path, relativepath))
+	if err != nil || !exists {
+		return nil, err
+	}
+	bts, found, err := conf.ReadAuthenticatedFile(manager, relativepath)
+	if err != nil || !found {
+		return nil, err
+	}
+	pk, err := gabi.NewPublicKeyFromBytes(bts)
+	if err != nil {
+		return nil, err
+	}
+	if int(pk.Counter) != counter {
+		return nil, errors.Errorf("Public key %s of issuer %s has wrong <Counter>", relativepath, issuerid.String())
+	}
+	pk.Issuer = issuerid.String()
+	return pk, nil
+}
+
 func (conf *Configuration) PublicKeyIndices(issuerid IssuerIdentifier) (i []int, err error) {
 	return conf.matchKeyPattern(issuerid, pubkeyPattern)
 }
 
 func (conf *Configuration) matchKeyPattern(issuerid IssuerIdentifier, pattern string) (i []int, err error) {
 	pkpath := fmt.Sprintf(pattern, conf.Path, issuerid.SchemeManagerIdentifier().Name(), issuerid.Name())
-	files, err := filepath.Glob(pkpath)
+	files, err := conf.glob(pkpath)
 	if err != nil {
 		return
 	}
@@ -548,54 +715,70 @@ func (conf *Configuration) matchKeyPattern(issuerid IssuerIdentifier, pattern st
 
 // parse $schememanager/$issuer/Issues/*/description.xml
 func (conf *Configuration) parseCredentialsFolder(manager *SchemeManager, issuer *Issuer, path string) error {
+	dirs, err := listFiles(conf.files(), path, true)
+	if err != nil {
+		return err
+	}
+	parsed := make([]*Configuration, len(dirs))
+	err = parallel(len(dirs), func(i int) error {
+		parsed[i] = conf.emptyCopy()
+		return parsed[i].parseCredentialFolder(manager, issuer, dirs[i])
+	})
 	var foundcred bool
-	err := iterateSubfolders(path, func(dir string, _ os.FileInfo) error {
-		cred := &CredentialType{}
-		exists, err := conf.pathToDescription(manager, dir+"/description.xml", cred)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			return nil
-		}
-		if err = conf.validateCredentialType(manager, issuer, cred, dir); err != nil {
-			return err
-		}
-		foundcred = true
-		cred.Valid = conf.SchemeManagers[cred.SchemeManagerIdentifier()].Valid
-		credid := cred.Identifier()
-		conf.CredentialTypes[credid] = cred
-		conf.addReverseHash(credid)
-		for index, attr := range cred.AttributeTypes {
-			attr.Index = index
-			attr.SchemeManagerID = cred.SchemeManagerID
-			attr.IssuerID = cred.IssuerID
-			attr.CredentialTypeID = cred.ID
-			conf.AttributeTypes[attr.GetAttributeTypeIdentifier()] = attr
+	for _, p := range parsed {
+		if p == nil {
+			continue
 		}
-		return nil
-	})
+		foundcred = foundcred || len(p.CredentialTypes) > 0
+		conf.merge(p)
+	}
 	if !foundcred {
 		conf.Warnings = append(conf.Warnings, fmt.Sprintf("Issuer %s has no credential types", issuer.Identifier().String()))
 	}
 	return err
 }
 
+func (conf *Configuration) parseCredentialFolder(manager *SchemeManager, issuer *Issuer, dir string) error {
+	cred := &CredentialType{}
+	exists, err := conf.pathToDescription(manager, dir+"/description.xml", cred)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if err = conf.validateCredentialType(manager, issuer, cred, dir); err != nil {
+		return err
+	}
+	cred.Valid = manager.Valid
+	credid := cred.Identifier()
+	conf.CredentialTypes[credid] = cred
+	conf.addReverseHash(credid)
+	for index, attr := range cred.AttributeTypes {
+		attr.Index = index
+		attr.SchemeManagerID = cred.SchemeManagerID
+		attr.IssuerID = cred.IssuerID
+		attr.CredentialTypeID = cred.ID
+		conf.AttributeTypes[attr.GetAttributeTypeIdentifier()] = attr
+	}
+	return nil
+}
+
 // iterateSubfolders iterates over the subfolders of the specified path,
 // calling the specified handler each time. If anything goes wrong, or
 // if the caller returns a non-nil error, an error is immediately returned.
-func iterateSubfolders(path string, handler func(string, os.FileInfo) error) error {
-	return iterateFiles(path, true, handler)
+func iterateSubfolders(fsys ConfigurationFS, path string, handler func(string, os.FileInfo) error) error {
+	return iterateFiles(fsys, path, true, handler)
 }
 
-func iterateFiles(path string, onlyDirs bool, handler func(string, os.FileInfo) error) error {
-	files, err := filepath.Glob(filepath.Join(path, "*"))
+func iterateFiles(fsys ConfigurationFS, path string, onlyDirs bool, handler func(string, os.FileInfo) error) error {
+	files, err := fsGlob(fsys, filepath.Join(path, "*"))
 	if err != nil {
 		return err
 	}
 
 	for _, file := range files {
-		stat, err := os.Stat(file)
+		stat, err := fsys.Stat(file) // unlike ReadDir(), follows symlinks
 		if err != nil {
 			return err
 		}
@@ -614,22 +797,68 @@ func iterateFiles(path string, onlyDirs bool, handler func(string, os.FileInfo)
 	return nil
 }
 
+// listFiles returns the files (or only the directories) that iterateFiles() would iterate over.
+func listFiles(fsys ConfigurationFS, path string, onlyDirs bool) ([]string, error) {
+	var files []string
+	err := iterateFiles(fsys, path, onlyDirs, func(file string, _ os.FileInfo) error {
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
+
+// parseWorkers is the maximum amount of goroutines with which parallel() invokes its function.
+var parseWorkers = runtime.NumCPU()
+
+// parallel invokes f for each i in 0, ..., n-1 concurrently using at most parseWorkers goroutines,
+// returning the error returned by f for the lowest i, if any.
+func parallel(n int, f func(i int) error) error {
+	errs := make([]error, n)
+	indices := make(chan int)
+	workers := parseWorkers
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // walkDir recursively walks the file tree rooted at path, following symlinks (unlike filepath.Walk).
 // Avoiding loops is the responsibility of the caller.
-func walkDir(path string, handler func(string, os.FileInfo) error) error {
-	return iterateFiles(path, false, func(p string, info os.FileInfo) error {
+func walkDir(fsys ConfigurationFS, path string, handler func(string, os.FileInfo) error) error {
+	return iterateFiles(fsys, path, false, func(p string, info os.FileInfo) error {
 		if info.IsDir() {
 			if err := handler(p, info); err != nil {
 				return err
 			}
-			return walkDir(p, handler)
+			return walkDir(fsys, p, handler)
 		}
 		return handler(p, info)
 	})
 }
 
 func (conf *Configuration) pathToDescription(manager *SchemeManager, path string, description interface{}) (bool, error) {
-	if _, err := os.Stat(path); err != nil {
+	if _, err := conf.files().Stat(path); err != nil {
 		return false, nil
 	}
 
@@ -658,14 +887,22 @@ func (conf *Configuration) pathToDescription(manager *SchemeManager, path string
 
 // ContainsCredentialType checks if the configuration contains the specified credential type.
 func (conf *Configuration) ContainsCredentialType(cred CredentialTypeIdentifier) bool {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+	return conf.containsCredentialType(cred)
+}
+
+func (conf *Configuration) containsCredentialType(cred CredentialTypeIdentifier) bool {
 	return conf.SchemeManagers[cred.IssuerIdentifier().SchemeManagerIdentifier()] != nil &&
 		conf.Issuers[cred.IssuerIdentifier()] != nil &&
 		conf.CredentialTypes[cred] != nil
 }
 
 func (conf *Configuration) ContainsAttributeType(attr AttributeTypeIdentifier) bool {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
 	_, contains := conf.AttributeTypes[attr]
-	return contains && conf.ContainsCredentialType(attr.CredentialTypeIdentifier())
+	return contains && conf.containsCredentialType(attr.CredentialTypeIdentifier())
 }
 
 func (conf *Configuration) isUpToDate(scheme SchemeManagerIdentifier) (bool, error) {
@@ -673,12 +910,12 @@ func (conf *Configuration) isUpToDate(scheme SchemeManagerIdentifier) (bool, err
 		return true, nil
 	}
 	name := scheme.String()
-	newTime, exists, err := readTimestamp(filepath.Join(conf.assets, name, "timestamp"))
+	newTime, exists, err := readTimestamp(osFS{}, filepath.Join(conf.assets, name, "timestamp"))
 	if err != nil || !exists {
 		return true, errors.WrapPrefix(err, "Could not read asset timestamp of scheme "+name, 0)
 	}
 	// The storage version of the manager does not need to have a timestamp. If it does not, it is outdated.
-	oldTime, exists, err := readTimestamp(filepath.Join(conf.Path, name, "timestamp"))
+	oldTime, exists, err := readTimestamp(osFS{}, filepath.Join(conf.Path, name, "timestamp"))
 	if err != nil {
 		return true, err
 	}
@@ -703,17 +940,13 @@ func (conf *Configuration) CopyManagerFromAssets(scheme SchemeManagerIdentifier)
 
 // DownloadSchemeManager downloads and returns a scheme manager description.xml file
 // from the specified URL.
-func DownloadSchemeManager(url string) (*SchemeManager, error) {
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = "https://" + url
-	}
-	if url[len(url)-1] == '/' {
-		url = url[:len(url)-1]
-	}
-	if strings.HasSuffix(url, "/description.xml") {
-		url = url[:len(url)-len("/description.xml")]
+func DownloadSchemeManager(url string, mirrors ...string) (*SchemeManager, error) {
+	url = normalizeSchemeURL(url)
+	urls := []string{url}
+	for _, mirror := range mirrors {
+		urls = append(urls, normalizeSchemeURL(mirror))
 	}
-	b, err := NewHTTPTransport(url).GetBytes("description.xml")
+	b, err := newSchemeTransport(urls).GetBytes("description.xml")
 	if err != nil {
 		return nil, err
 	}
@@ -730,24 +963,23 @@ func DownloadSchemeManager(url string) (*SchemeManager, error) {
 // public keys and credential types from this Configuration.
 func (conf *Configuration) RemoveSchemeManager(id SchemeManagerIdentifier, fromStorage bool) error {
 	// Remove everything falling under the manager's responsibility
-	for credid := range conf.CredentialTypes {
-		if credid.IssuerIdentifier().SchemeManagerIdentifier() == id {
-			delete(conf.CredentialTypes, credid)
-		}
-	}
-	for issid := range conf.Issuers {
-		if issid.SchemeManagerIdentifier() == id {
-			delete(conf.Issuers, issid)
+	_ = conf.update(func(fresh *Configuration) error {
+		for credid := range fresh.CredentialTypes {
+			if credid.IssuerIdentifier().SchemeManagerIdentifier() == id {
+				delete(fresh.CredentialTypes, credid)
+			}
 		}
-	}
-	for issid := range conf.publicKeys {
-		if issid.SchemeManagerIdentifier() == id {
-			delete(conf.publicKeys, issid)
+		for issid := range fresh.Issuers {
+			if issid.SchemeManagerIdentifier() == id {
+				delete(fresh.Issuers, issid)
+			}
 		}
-	}
-	delete(conf.SchemeManagers, id)
+		fresh.publicKeys.removeScheme(id)
+		delete(fresh.SchemeManagers, id)
+		return nil
+	})
 
-	if fromStorage || !conf.readOnly {
+	if (fromStorage || !conf.readOnly) && conf.onDisk() {
 		return os.RemoveAll(fmt.Sprintf("%s/%s", conf.Path, id.String()))
 	}
 	return nil
@@ -760,7 +992,7 @@ func (conf *Configuration) ReinstallSchemeManager(manager *SchemeManager) (err e
 
 	// Check if downloading stuff from the remote works before we uninstall the specified manager:
 	// If we can't download anything we should keep the broken version
-	manager, err = DownloadSchemeManager(manager.URL)
+	manager, err = DownloadSchemeManager(manager.URL, conf.schemeURLs(manager)[1:]...)
 	if err != nil {
 		return
 	}
@@ -783,7 +1015,7 @@ func (conf *Configuration) InstallSchemeManager(manager *SchemeManager, publicke
 		return err
 	}
 
-	t := NewHTTPTransport(manager.URL)
+	t := conf.schemeTransport(manager)
 	path := fmt.Sprintf("%s/%s", conf.Path, name)
 	if err := t.GetFile("description.xml", path+"/description.xml"); err != nil {
 		return err
@@ -800,7 +1032,10 @@ func (conf *Configuration) InstallSchemeManager(manager *SchemeManager, publicke
 	if err := conf.DownloadSchemeManagerSignature(manager); err != nil {
 		return err
 	}
-	conf.SchemeManagers[manager.Identifier()] = manager
+	_ = conf.update(func(fresh *Configuration) error {
+		fresh.SchemeManagers[manager.Identifier()] = manager
+		return nil
+	})
 	if err := conf.UpdateSchemeManager(manager.Identifier(), nil); err != nil {
 		return err
 	}
@@ -809,25 +1044,29 @@ func (conf *Configuration) InstallSchemeManager(manager *SchemeManager, publicke
 }
 
 // DownloadSchemeManagerSignature downloads, stores and verifies the latest version
-// of the index file and signature of the specified manager.
+// of the index file and signature (and key rotations, if any) of the specified manager.
 func (conf *Configuration) DownloadSchemeManagerSignature(manager *SchemeManager) (err error) {
 	if conf.readOnly {
 		return errors.New("cannot download into a read-only configuration")
 	}
 
-	t := NewHTTPTransport(manager.URL)
 	path := fmt.Sprintf("%s/%s", conf.Path, manager.ID)
 	index := filepath.Join(path, "index")
 	sig := filepath.Join(path, "index.sig")
 
-	if err = t.GetFile("index", index); err != nil {
-		return
-	}
-	if err = t.GetFile("index.sig", sig); err != nil {
-		return
-	}
-	err = conf.VerifySignature(manager.Identifier())
-	return
+	// The index and its signature must come from the same mirror
+	return conf.schemeTransport(manager).try(func(t *HTTPTransport) error {
+		if err := conf.downloadSchemeKeyRotations(manager, t); err != nil {
+			return err
+		}
+		if err := t.GetFile("index", index); err != nil {
+			return err
+		}
+		if err := t.GetFile("index.sig", sig); err != nil {
+			return err
+		}
+		return conf.VerifySignature(manager.Identifier())
+	})
 }
 
 func (e *UnknownIdentifierError) Error() string {
@@ -877,14 +1116,13 @@ func (conf *Configuration) Download(session SessionRequest) (downloaded *IrmaIde
 
 func (conf *Configuration) checkCredentialTypes(session SessionRequest, missing *IrmaIdentifierSet) {
 	var typ *CredentialType
-	var contains bool
 
 	switch s := session.(type) {
 	case *IssuanceRequest:
 		for _, credreq := range s.Credentials {
 			// First check if we have this credential type
-			typ, contains = conf.CredentialTypes[credreq.CredentialTypeID]
-			if !contains {
+			typ = conf.CredentialType(credreq.CredentialTypeID)
+			if typ == nil {
 				missing.CredentialTypes[credreq.CredentialTypeID] = struct{}{}
 				continue
 			}
@@ -895,7 +1133,7 @@ func (conf *Configuration) checkCredentialTypes(session SessionRequest, missing
 			// For each of the attributes in the credentialtype, see if it is present; if so remove it from newAttrs
 			// If not, check that it is optional; if not the credentialtype must be updated
 			for _, attrtyp := range typ.AttributeTypes {
-				_, contains = newAttrs[attrtyp.ID]
+				_, contains := newAttrs[attrtyp.ID]
 				if !contains && !attrtyp.IsOptional() {
 					missing.CredentialTypes[credreq.CredentialTypeID] = struct{}{}
 					break
@@ -911,7 +1149,7 @@ func (conf *Configuration) checkCredentialTypes(session SessionRequest, missing
 
 	_ = session.Disclosure().Disclose.Iterate(func(attr *AttributeRequest) error {
 		credid := attr.Type.CredentialTypeIdentifier()
-		if typ, contains = conf.CredentialTypes[credid]; !contains {
+		if typ = conf.CredentialType(credid); typ == nil {
 			missing.CredentialTypes[credid] = struct{}{}
 			return nil
 		}
@@ -938,8 +1176,8 @@ func (conf *Configuration) checkIdentifiers(session SessionRequest) (*IrmaIdenti
 // instance.
 func (conf *Configuration) checkSchemes(session SessionRequest, missing *IrmaIdentifierSet) {
 	for id := range session.Identifiers().SchemeManagers {
-		scheme, contains := conf.SchemeManagers[id]
-		if !contains || !scheme.Valid {
+		scheme := conf.SchemeManager(id)
+		if scheme == nil || !scheme.Valid {
 			missing.SchemeManagers[id] = struct{}{}
 		}
 	}
@@ -947,7 +1185,7 @@ func (conf *Configuration) checkSchemes(session SessionRequest, missing *IrmaIde
 
 func (conf *Configuration) checkIssuers(set *IrmaIdentifierSet, missing *IrmaIdentifierSet) error {
 	for issid := range set.Issuers {
-		if _, contains := conf.Issuers[issid]; !contains {
+		if conf.Issuer(issid) == nil {
 			missing.Issuers[issid] = struct{}{}
 		}
 	}
@@ -1014,10 +1252,10 @@ func (i SchemeManagerIndex) Scheme() SchemeManagerIdentifier {
 // parseIndex parses the index file of the specified manager.
 func (conf *Configuration) parseIndex(name string, manager *SchemeManager) (SchemeManagerIndex, error) {
 	path := filepath.Join(conf.Path, name, "index")
-	if err := fs.AssertPathExists(path); err != nil {
+	if exists, err := conf.pathExists(path); err != nil || !exists {
 		return nil, fmt.Errorf("Missing scheme manager index file; tried %s", path)
 	}
-	indexbts, err := ioutil.ReadFile(path)
+	indexbts, err := conf.readFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -1030,7 +1268,7 @@ func (conf *Configuration) parseIndex(name string, manager *SchemeManager) (Sche
 }
 
 func (conf *Configuration) checkUnsignedFiles(name string, index SchemeManagerIndex) error {
-	return walkDir(filepath.Join(conf.Path, name), func(path string, info os.FileInfo) error {
+	return walkDir(conf.files(), filepath.Join(conf.Path, name), func(path string, info os.FileInfo) error {
 		relpath, err := filepath.Rel(conf.Path, path)
 		if err != nil {
 			return err
@@ -1071,6 +1309,7 @@ var sigExceptions = []*regexp.Regexp{
 	regexp.MustCompile(`^.*?/sk\.pem$`),
 	regexp.MustCompile(`^.*?/index`),
 	regexp.MustCompile(`^.*?/index\.sig`),
+	regexp.MustCompile(`^.*?/keyrotations\.json$`),
 	regexp.MustCompile(`^.*?/AUTHORS$`),
 	regexp.MustCompile(`^.*?/LICENSE$`),
 	regexp.MustCompile(`^.*?/README\.md$`),
@@ -1087,7 +1326,7 @@ func (conf *Configuration) VerifySchemeManager(manager *SchemeManager) error {
 
 	var exists bool
 	for file := range manager.index {
-		exists, err = fs.PathExists(filepath.Join(conf.Path, file))
+		exists, err = conf.pathExists(filepath.Join(conf.Path, file))
 		if err != nil {
 			return err
 		}
@@ -1107,12 +1346,16 @@ func (conf *Configuration) VerifySchemeManager(manager *SchemeManager) error {
 // and verifies its authenticity by checking that the file hash
 // is present in the (signed) scheme manager index file.
 func (conf *Configuration) ReadAuthenticatedFile(manager *SchemeManager, path string) ([]byte, bool, error) {
-	signedHash, ok := manager.index[filepath.ToSlash(path)]
+	return conf.readAuthenticatedFile(manager.index, path)
+}
+
+func (conf *Configuration) readAuthenticatedFile(index SchemeManagerIndex, path string) ([]byte, bool, error) {
+	signedHash, ok := index[filepath.ToSlash(path)]
 	if !ok {
 		return nil, false, nil
 	}
 
-	bts, err := ioutil.ReadFile(filepath.Join(conf.Path, path))
+	bts, err := conf.readFile(filepath.Join(conf.Path, path))
 	if err != nil {
 		return nil, true, err
 	}
@@ -1126,7 +1369,8 @@ func (conf *Configuration) ReadAuthenticatedFile(manager *SchemeManager, path st
 
 // VerifySignature verifies the signature on the scheme manager index file
 // (which contains the SHA256 hashes of all files under this scheme manager,
-// which are used for verifying file authenticity).
+// which are used for verifying file authenticity), using the current signing key
+// of the scheme manager (see SchemeSigningKey()).
 func (conf *Configuration) VerifySignature(id SchemeManagerIdentifier) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -1139,29 +1383,27 @@ func (conf *Configuration) VerifySignature(id SchemeManagerIdentifier) (err erro
 	}()
 
 	dir := filepath.Join(conf.Path, id.String())
-	if err := fs.AssertPathExists(filepath.Join(dir, "index"), filepath.Join(dir, "index.sig"), filepath.Join(dir, "pk.pem")); err != nil {
-		return errors.New("Missing scheme manager index file, signature, or public key")
+	for _, file := range []string{"index", "index.sig", "pk.pem"} {
+		if exists, err := conf.pathExists(filepath.Join(dir, file)); err != nil || !exists {
+			return errors.New("Missing scheme manager index file, signature, or public key")
+		}
 	}
 
 	// Read and hash index file
-	indexbts, err := ioutil.ReadFile(filepath.Join(dir, "index"))
+	indexbts, err := conf.readFile(filepath.Join(dir, "index"))
 	if err != nil {
 		return err
 	}
 	indexhash := sha256.Sum256(indexbts)
 
-	// Read and parse scheme manager public key
-	pkbts, err := ioutil.ReadFile(filepath.Join(dir, "pk.pem"))
-	if err != nil {
-		return err
-	}
-	pk, err := ParsePemEcdsaPublicKey(pkbts)
+	// Determine the current scheme manager public key, following its key rotations if any
+	pk, err := conf.SchemeSigningKey(id)
 	if err != nil {
 		return err
 	}
 
 	// Read and parse signature
-	sig, err := ioutil.ReadFile(filepath.Join(dir, "index.sig"))
+	sig, err := conf.readFile(filepath.Join(dir, "index.sig"))
 	if err != nil {
 		return err
 	}
@@ -1205,13 +1447,13 @@ func (conf *Configuration) UpdateSchemeManager(id SchemeManagerIdentifier, downl
 	if conf.readOnly {
 		return errors.New("cannot update a read-only configuration")
 	}
-	manager, contains := conf.SchemeManagers[id]
-	if !contains {
+	manager := conf.SchemeManager(id)
+	if manager == nil {
 		return errors.Errorf("Cannot update unknown scheme manager %s", id)
 	}
 
 	// Check remote timestamp and see if we have to do anything
-	transport := NewHTTPTransport(manager.URL + "/")
+	transport := conf.schemeTransport(manager)
 	timestampBts, err := transport.GetBytes("timestamp")
 	if err != nil {
 		return err
@@ -1291,7 +1533,10 @@ func (conf *Configuration) UpdateSchemes() error {
 		Issuers:         map[IssuerIdentifier]struct{}{},
 		CredentialTypes: map[CredentialTypeIdentifier]struct{}{},
 	}
-	for id := range conf.SchemeManagers {
+	conf.lock.RLock()
+	managers := conf.SchemeManagers
+	conf.lock.RUnlock()
+	for id := range managers {
 		Logger.WithField("scheme", id).Info("Auto-updating scheme")
 		if err := conf.UpdateSchemeManager(id, &updated); err != nil {
 			return err
@@ -1304,6 +1549,10 @@ func (conf *Configuration) UpdateSchemes() error {
 }
 
 func (conf *Configuration) AutoUpdateSchemes(interval uint) {
+	if conf.readOnly {
+		Logger.Info("Not updating schemes of read-only configuration")
+		return
+	}
 	Logger.Infof("Updating schemes every %d minutes", interval)
 
 	conf.scheduler = gocron.NewScheduler()
@@ -1340,7 +1589,7 @@ func (conf *Configuration) validateIssuer(manager *SchemeManager, issuer *Issuer
 	conf.validateTranslations(fmt.Sprintf("Issuer %s", issuerid.String()), issuer)
 	// Check that the issuer has public keys
 	pkpath := fmt.Sprintf(pubkeyPattern, conf.Path, issuerid.SchemeManagerIdentifier().Name(), issuerid.Name())
-	files, err := filepath.Glob(pkpath)
+	files, err := conf.glob(pkpath)
 	if err != nil {
 		return err
 	}
@@ -1354,7 +1603,7 @@ func (conf *Configuration) validateIssuer(manager *SchemeManager, issuer *Issuer
 	if manager.ID != issuer.SchemeManagerID {
 		return errors.Errorf("Issuer %s has wrong SchemeManager %s", issuerid.String(), issuer.SchemeManagerID)
 	}
-	if err = fs.AssertPathExists(filepath.Join(dir, "logo.png")); err != nil {
+	if exists, _ := conf.pathExists(filepath.Join(dir, "logo.png")); !exists {
 		conf.Warnings = append(conf.Warnings, fmt.Sprintf("Issuer %s has no logo.png", issuerid.String()))
 	}
 	return nil
@@ -1375,12 +1624,20 @@ func (conf *Configuration) validateCredentialType(manager *SchemeManager, issuer
 	if cred.SchemeManagerID != manager.ID {
 		return errors.Errorf("Credential type %s has wrong SchemeManager %s", credid.String(), cred.SchemeManagerID)
 	}
-	if err := fs.AssertPathExists(filepath.Join(dir, "logo.png")); err != nil {
+	if exists, _ := conf.pathExists(filepath.Join(dir, "logo.png")); !exists {
 		conf.Warnings = append(conf.Warnings, fmt.Sprintf("Credential type %s has no logo.png", credid.String()))
 	}
+	conf.validateColor(credid, "ForegroundColor", cred.ForegroundColor)
+	conf.validateColor(credid, "BackgroundColor", cred.BackgroundColor)
 	return conf.validateAttributes(cred)
 }
 
+func (conf *Configuration) validateColor(credid CredentialTypeIdentifier, tag, color string) {
+	if color != "" && !colorRegexp.MatchString(color) {
+		conf.Warnings = append(conf.Warnings, fmt.Sprintf("Credential type %s has invalid colour %s in <%s> tag (expected #RRGGBB)", credid.String(), color, tag))
+	}
+}
+
 func (conf *Configuration) validateAttributes(cred *CredentialType) error {
 	name := cred.Identifier().String()
 	indices := make(map[int]struct{})
@@ -1415,7 +1672,7 @@ func (conf *Configuration) validateScheme(scheme *SchemeManager, dir string) err
 		return errors.Errorf("Scheme %s has wrong directory name %s", scheme.ID, filepath.Base(dir))
 	}
 	if scheme.KeyshareServer != "" {
-		if err := fs.AssertPathExists(filepath.Join(dir, "kss-0.pem")); err != nil {
+		if exists, _ := conf.pathExists(filepath.Join(dir, "kss-0.pem")); !exists {
 			scheme.Status = SchemeManagerStatusParsingError
 			return errors.Errorf("Scheme %s has keyshare URL but no keyshare public key kss-0.pem", scheme.ID)
 		}
@@ -1424,10 +1681,30 @@ func (conf *Configuration) validateScheme(scheme *SchemeManager, dir string) err
 	return nil
 }
 
+// DefaultRequiredLanguages are the languages in which the translated strings in schemes are
+// required to be present, unless configured otherwise with SetRequiredLanguages().
+var DefaultRequiredLanguages = []string{"en", "nl"}
+
+// SetRequiredLanguages sets the languages in which the translated strings in schemes (e.g. names,
+// descriptions and attribute value translations) are required to be present. Missing translations
+// are reported in the Warnings of this Configuration when it is next parsed.
+func (conf *Configuration) SetRequiredLanguages(langs ...string) {
+	conf.lock.Lock()
+	defer conf.lock.Unlock()
+	conf.requiredLanguages = langs
+}
+
+func (conf *Configuration) languages() []string {
+	if conf.requiredLanguages == nil {
+		return DefaultRequiredLanguages
+	}
+	return conf.requiredLanguages
+}
+
 // validateTranslations checks for each member of the interface o that is of type TranslatedString
-// that it contains all necessary translations.
+// or AttributeValueTranslations that it contains all required translations.
 func (conf *Configuration) validateTranslations(file string, o interface{}) {
-	langs := []string{"en", "nl"} // Hardcode these for now, TODO make configurable
+	langs := conf.languages()
 	v := reflect.ValueOf(o)
 
 	// Dereference in case of pointer or interface
@@ -1436,11 +1713,27 @@ func (conf *Configuration) validateTranslations(file string, o interface{}) {
 	}
 
 	for i := 0; i < v.NumField(); i++ {
-		if v.Field(i).Type() == reflect.TypeOf(TranslatedString{}) {
+		tag := v.Type().Field(i).Name
+		switch v.Field(i).Type() {
+		case reflect.TypeOf(TranslatedString{}):
 			val := v.Field(i).Interface().(TranslatedString)
 			for _, lang := range langs {
 				if _, exists := val[lang]; !exists {
-					conf.Warnings = append(conf.Warnings, fmt.Sprintf("%s misses %s translation in <%s> tag", file, lang, v.Type().Field(i).Name))
+					conf.Warnings = append(conf.Warnings, fmt.Sprintf("%s misses %s translation in <%s> tag", file, lang, tag))
+				}
+			}
+		case reflect.TypeOf(AttributeValueTranslations{}):
+			val := v.Field(i).Interface().(AttributeValueTranslations)
+			values := make([]string, 0, len(val))
+			for value := range val {
+				values = append(values, value)
+			}
+			sort.Strings(values)
+			for _, value := range values {
+				for _, lang := range langs {
+					if _, exists := val[value][lang]; !exists {
+						conf.Warnings = append(conf.Warnings, fmt.Sprintf("%s misses %s translation of value %s in <%s> tag", file, lang, value, tag))
+					}
 				}
 			}
 		}
@@ -1448,16 +1741,20 @@ func (conf *Configuration) validateTranslations(file string, o interface{}) {
 }
 
 func (conf *Configuration) ValidateKeys() error {
-	const expiryBoundary = int64(time.Hour/time.Second) * 24 * 31 // 1 month, TODO make configurable
-
-	for issuerid := range conf.Issuers {
-		if err := conf.parseKeysFolder(issuerid); err != nil {
-			return err
-		}
+	conf.lock.RLock()
+	issuers, credtypes := conf.Issuers, conf.CredentialTypes
+	conf.lock.RUnlock()
+	for issuerid := range issuers {
 		indices, err := conf.PublicKeyIndices(issuerid)
 		if err != nil {
 			return err
 		}
+		// Parse all public keys, bypassing the cache, so that invalid ones are detected
+		for _, counter := range indices {
+			if _, err = conf.parsePublicKey(issuerid, counter); err != nil {
+				return err
+			}
+		}
 		if len(indices) == 0 {
 			continue
 		}
@@ -1465,18 +1762,18 @@ func (conf *Configuration) ValidateKeys() error {
 		if err != nil {
 			return err
 		}
-		now := time.Now().Unix()
-		if latest == nil || latest.ExpiryDate < now {
+		now := time.Now()
+		if latest == nil || PublicKeyExpired(latest, now) {
 			conf.Warnings = append(conf.Warnings, fmt.Sprintf("Issuer %s has no nonexpired public keys", issuerid.String()))
 		}
-		if latest != nil && latest.ExpiryDate > now && latest.ExpiryDate < now+expiryBoundary {
+		if latest != nil && PublicKeyExpiresSoon(latest, now) {
 			conf.Warnings = append(conf.Warnings, fmt.Sprintf("Latest public key of issuer %s expires soon (at %s)",
 				issuerid.String(), time.Unix(latest.ExpiryDate, 0).String()))
 		}
 
 		// Check private keys if any
 		privkeypath := fmt.Sprintf(privkeyPattern, conf.Path, issuerid.SchemeManagerIdentifier().Name(), issuerid.Name())
-		privkeys, err := filepath.Glob(privkeypath)
+		privkeys, err := conf.glob(privkeypath)
 		if err != nil {
 			return err
 		}
@@ -1486,7 +1783,7 @@ func (conf *Configuration) ValidateKeys() error {
 			if err != nil {
 				return err
 			}
-			sk, err := gabi.NewPrivateKeyFromFile(privkey)
+			sk, err := conf.readPrivateKey(privkey)
 			if err != nil {
 				return err
 			}
@@ -1507,7 +1804,7 @@ func (conf *Configuration) ValidateKeys() error {
 
 		// Check that the current public key supports enough attributes for all credential types
 		// issued by this issuer
-		for id, typ := range conf.CredentialTypes {
+		for id, typ := range credtypes {
 			if id.IssuerIdentifier() != issuerid {
 				continue
 			}
@@ -1,12 +1,31 @@
 package irma
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	gobig "math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi/big"
 
 	"github.com/privacybydesign/irmago/internal/fs"
@@ -239,6 +258,29 @@ func TestVerifyInValidNonce(t *testing.T) {
 	require.Equal(t, status, ProofStatusInvalid)
 }
 
+func TestPublicKeyExpiry(t *testing.T) {
+	conf := parseConfiguration(t)
+	issuer := NewIssuerIdentifier("test.test")
+
+	pk, err := conf.PublicKey(issuer, 2)
+	require.NoError(t, err)
+	require.True(t, PublicKeyExpired(pk, time.Unix(pk.ExpiryDate+1, 0)))
+	require.False(t, PublicKeyExpired(pk, time.Unix(pk.ExpiryDate-1, 0)))
+	require.True(t, PublicKeyExpiresSoon(pk, time.Unix(pk.ExpiryDate, 0).Add(-PublicKeyExpiryWarningPeriod/2)))
+	require.False(t, PublicKeyExpiresSoon(pk, time.Unix(pk.ExpiryDate, 0).Add(-2*PublicKeyExpiryWarningPeriod)))
+
+	// Key 3 expires in 2020, key 1 in 2030, and keys 0 and 2 before 2019
+	newest, err := conf.NewestValidPublicKey(issuer, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, uint(3), newest.Counter)
+	newest, err = conf.NewestValidPublicKey(issuer, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, uint(1), newest.Counter)
+	newest, err = conf.NewestValidPublicKey(issuer, time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Nil(t, newest)
+}
+
 func TestEmptySignature(t *testing.T) {
 	msg := &SignedMessage{}
 	_, status, _ := msg.Verify(&Configuration{}, nil)
@@ -522,3 +564,659 @@ func TestConDisconSingletons(t *testing.T) {
 		}
 	}
 }
+
+func TestFileSignatureContainer(t *testing.T) {
+	document := []byte("%PDF-1.4 contents of a contract")
+	metadata, err := NewFileMetadata(bytes.NewReader(document), "contract.pdf", HashAlgorithmSHA512)
+	require.NoError(t, err)
+	require.NoError(t, metadata.Validate())
+	require.Len(t, metadata.Digest, 64)
+	require.Equal(t, int64(len(document)), metadata.Size)
+
+	// A signature over some other message must not be packaged
+	_, err = NewSignedFile(metadata, &SignedMessage{Message: "I owe you everything"})
+	require.Error(t, err)
+
+	signedFile, err := NewSignedFile(metadata, &SignedMessage{Message: metadata.Message()})
+	require.NoError(t, err)
+
+	bts, err := json.Marshal(signedFile)
+	require.NoError(t, err)
+	parsed := &SignedFile{}
+	require.NoError(t, UnmarshalValidate(bts, parsed))
+	require.Equal(t, metadata, parsed.Document)
+
+	// Verifying against a modified document fails on the digest, before the signature is considered
+	_, status, err := parsed.Verify(&Configuration{}, bytes.NewReader(append(document, '!')), nil)
+	require.NoError(t, err)
+	require.Equal(t, ProofStatusInvalidDigest, status)
+
+	// Verifying without a document must not silently skip the digest check
+	_, status, err = parsed.Verify(&Configuration{}, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, ProofStatusInvalid, status)
+
+	_, err = NewFileMetadata(bytes.NewReader(document), "", HashAlgorithm("md5"))
+	require.Error(t, err)
+}
+
+func TestSchemeKeyRotation(t *testing.T) {
+	scheme := NewSchemeManagerIdentifier("irma-demo")
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		var err error
+		keys[i], err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+	}
+
+	now := time.Now()
+	future := Timestamp(now.Add(time.Hour))
+	past := Timestamp(now.Add(-time.Hour))
+
+	r1, err := NewSchemeKeyRotation(scheme, keys[0], &keys[1].PublicKey, nil, nil)
+	require.NoError(t, err)
+	r2, err := NewSchemeKeyRotation(scheme, keys[1], &keys[2].PublicKey, &future, nil)
+	require.NoError(t, err)
+	chain := SchemeKeyRotations{r1, r2}
+
+	// The second key is current; the third one is not yet valid
+	pk, err := chain.Follow(scheme, &keys[0].PublicKey, now)
+	require.NoError(t, err)
+	require.True(t, ecdsaKeysEqual(pk, &keys[1].PublicKey))
+	pk, err = chain.Follow(scheme, &keys[0].PublicKey, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.True(t, ecdsaKeysEqual(pk, &keys[2].PublicKey))
+
+	// The chain can also be followed when trusting a key designated within it
+	pk, err = chain.Follow(scheme, &keys[1].PublicKey, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.True(t, ecdsaKeysEqual(pk, &keys[2].PublicKey))
+
+	// Statements are bound to their scheme
+	_, err = chain.Follow(NewSchemeManagerIdentifier("test"), &keys[0].PublicKey, now)
+	require.Error(t, err)
+
+	// Statements not signed by the previous key are rejected
+	forged, err := NewSchemeKeyRotation(scheme, keys[2], &keys[1].PublicKey, nil, nil)
+	require.NoError(t, err)
+	_, err = SchemeKeyRotations{forged}.Follow(scheme, &keys[0].PublicKey, now)
+	require.Error(t, err)
+
+	// Expired keys are rejected
+	expired, err := NewSchemeKeyRotation(scheme, keys[0], &keys[1].PublicKey, nil, &past)
+	require.NoError(t, err)
+	_, err = SchemeKeyRotations{expired}.Follow(scheme, &keys[0].PublicKey, now)
+	require.Error(t, err)
+
+	require.True(t, chain.extends(SchemeKeyRotations{r1}))
+	require.False(t, SchemeKeyRotations{r1}.extends(chain))
+	require.False(t, SchemeKeyRotations{expired}.extends(SchemeKeyRotations{r1}))
+}
+
+func TestDownloadSchemeKeyRotations(t *testing.T) {
+	test.CreateTestStorage(t)
+	defer test.ClearTestStorage(t)
+
+	path := filepath.Join("testdata", "storage", "test", "irma_configuration")
+	require.NoError(t, fs.CopyDirectory(filepath.Join("testdata", "irma_configuration"), path))
+	conf, err := NewConfiguration(path)
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+	id := NewSchemeManagerIdentifier("irma-demo")
+	scheme := conf.SchemeManager(id)
+
+	var served []byte
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(served)
+	}))
+	defer httpServer.Close()
+	transport := NewHTTPTransport(httpServer.URL)
+
+	skbts, err := ioutil.ReadFile(filepath.Join(path, "irma-demo", "sk.pem"))
+	require.NoError(t, err)
+	block, _ := pem.Decode(skbts)
+	sk, err := x509.ParseECPrivateKey(block.Bytes)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	next, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// A chain not signed by the key in pk.pem is not stored, even though we have no chain yet
+	forged, err := NewSchemeKeyRotation(id, other, &next.PublicKey, nil, nil)
+	require.NoError(t, err)
+	served, err = json.Marshal(SchemeKeyRotations{forged})
+	require.NoError(t, err)
+	require.Error(t, conf.downloadSchemeKeyRotations(scheme, transport))
+	chain, err := conf.SchemeKeyRotations(id)
+	require.NoError(t, err)
+	require.Nil(t, chain)
+
+	rotation, err := NewSchemeKeyRotation(id, sk, &next.PublicKey, nil, nil)
+	require.NoError(t, err)
+	served, err = json.Marshal(SchemeKeyRotations{rotation})
+	require.NoError(t, err)
+	require.NoError(t, conf.downloadSchemeKeyRotations(scheme, transport))
+	chain, err = conf.SchemeKeyRotations(id)
+	require.NoError(t, err)
+	require.Len(t, chain, 1)
+}
+
+func TestConfigurationDiff(t *testing.T) {
+	conf := parseConfiguration(t)
+	updated, err := NewConfigurationReadOnly(filepath.Join("testdata", "irma_configuration_updated"))
+	require.NoError(t, err)
+	require.NoError(t, updated.ParseFolder())
+
+	findDiff := func(diffs []*IdentifierDiff, id string) *IdentifierDiff {
+		for _, d := range diffs {
+			if d.ID == id {
+				return d
+			}
+		}
+		return nil
+	}
+
+	diff, err := conf.DiffScheme(updated, NewSchemeManagerIdentifier("irma-demo"))
+	require.NoError(t, err)
+	require.False(t, diff.Empty())
+	require.Empty(t, diff.Issuers)
+	require.Empty(t, diff.PublicKeys)
+
+	added := findDiff(diff.AttributeTypes, "irma-demo.RU.studentCard.newAttribute")
+	require.NotNil(t, added)
+	require.Equal(t, DiffKindAdded, added.Kind)
+
+	modified := findDiff(diff.AttributeTypes, "irma-demo.RU.studentCard.level")
+	require.NotNil(t, modified)
+	require.Equal(t, DiffKindModified, modified.Kind)
+	require.Len(t, modified.Fields, 1)
+	require.Equal(t, "Optional", modified.Fields[0].Field)
+
+	require.Nil(t, findDiff(diff.AttributeTypes, "irma-demo.RU.studentCard.university"))
+	require.Contains(t, diff.String(), "irma-demo.RU.studentCard.newAttribute")
+
+	// The updated configuration lacks the test scheme
+	diff, err = conf.Diff(updated)
+	require.NoError(t, err)
+	removed := findDiff(diff.SchemeManagers, "test")
+	require.NotNil(t, removed)
+	require.Equal(t, DiffKindRemoved, removed.Kind)
+	require.NotNil(t, findDiff(diff.PublicKeys, "test.test-0"))
+
+	diff, err = conf.Diff(conf)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+}
+
+// readTestdataFiles returns the files in the specified folder in testdata, keyed by their
+// slash-separated path relative to it.
+func readTestdataFiles(t testing.TB, dir string) map[string][]byte {
+	root := filepath.Join("testdata", dir)
+	files := map[string][]byte{}
+	require.NoError(t, filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)], err = ioutil.ReadFile(path)
+		return err
+	}))
+	return files
+}
+
+func TestConfigurationFromMapFS(t *testing.T) {
+	ondisk := parseConfiguration(t)
+	files := readTestdataFiles(t, "irma_configuration")
+
+	conf, err := NewConfigurationFromFS(NewMapFS(files))
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+	require.Len(t, conf.SchemeManagers, len(ondisk.SchemeManagers))
+	require.Len(t, conf.CredentialTypes, len(ondisk.CredentialTypes))
+	require.True(t, conf.SchemeManagers[NewSchemeManagerIdentifier("irma-demo")].Valid)
+
+	pk, err := conf.PublicKey(NewIssuerIdentifier("irma-demo.RU"), 2)
+	require.NoError(t, err)
+	require.NotNil(t, pk)
+	sk, err := conf.PrivateKey(NewIssuerIdentifier("irma-demo.RU"))
+	require.NoError(t, err)
+	require.NotNil(t, sk)
+
+	diff, err := ondisk.Diff(conf)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	// Updating is not possible
+	require.Error(t, conf.UpdateSchemeManager(NewSchemeManagerIdentifier("irma-demo"), nil))
+
+	// Signatures are verified
+	files["irma-demo/RU/description.xml"] = append(files["irma-demo/RU/description.xml"], ' ')
+	conf, err = NewConfigurationFromFS(NewMapFS(files))
+	require.NoError(t, err)
+	require.Error(t, conf.ParseFolder())
+	require.Contains(t, conf.DisabledSchemeManagers, NewSchemeManagerIdentifier("irma-demo"))
+}
+
+func TestConfigurationFromZipFS(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for path, bts := range readTestdataFiles(t, "irma_configuration") {
+		f, err := w.Create("irma_configuration/" + path)
+		require.NoError(t, err)
+		_, err = f.Write(bts)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	fsys, err := NewZipFS(r, "irma_configuration")
+	require.NoError(t, err)
+	conf, err := NewConfigurationFromFS(fsys)
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+	require.Contains(t, conf.CredentialTypes, NewCredentialTypeIdentifier("irma-demo.RU.studentCard"))
+}
+
+func TestConfigurationConcurrentUpdate(t *testing.T) {
+	conf, err := NewConfigurationFromFS(NewMapFS(readTestdataFiles(t, "irma_configuration")))
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+
+	var swaps int
+	conf.Subscribe(func() { swaps++ })
+
+	credid := NewCredentialTypeIdentifier("irma-demo.RU.studentCard")
+	attrid := NewAttributeTypeIdentifier("irma-demo.RU.studentCard.level")
+	issid := NewIssuerIdentifier("irma-demo.RU")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				require.NotNil(t, conf.CredentialType(credid))
+				require.True(t, conf.ContainsAttributeType(attrid))
+				pk, err := conf.PublicKey(issid, 2)
+				require.NoError(t, err)
+				require.NotNil(t, pk)
+				require.Contains(t, conf.Snapshot().Issuers, issid)
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, conf.ParseFolder())
+	}
+	close(done)
+	wg.Wait()
+	require.Equal(t, 5, swaps)
+
+	// Snapshots are not affected by later updates
+	snapshot := conf.Snapshot()
+	require.NoError(t, conf.RemoveSchemeManager(NewSchemeManagerIdentifier("irma-demo"), false))
+	require.Equal(t, 6, swaps)
+	require.Nil(t, conf.CredentialType(credid))
+	require.NotNil(t, snapshot.CredentialType(credid))
+
+	// Failing updates are not swapped in
+	emailid := NewCredentialTypeIdentifier("test.test.email")
+	require.Error(t, conf.update(func(fresh *Configuration) error {
+		delete(fresh.CredentialTypes, emailid)
+		return errors.New("update failed")
+	}))
+	require.Equal(t, 6, swaps)
+	require.NotNil(t, conf.CredentialType(emailid))
+
+	// Listeners may themselves update the configuration
+	var once sync.Once
+	conf.AddUpdateListener(func(diff *ConfigurationDiff) {
+		once.Do(func() {
+			require.NoError(t, conf.RemoveSchemeManager(NewSchemeManagerIdentifier("test"), false))
+		})
+	})
+	require.NoError(t, conf.ParseFolder())
+	require.Equal(t, 8, swaps)
+	require.NotNil(t, conf.CredentialType(credid))
+	require.Nil(t, conf.CredentialType(emailid))
+}
+
+func TestConfigurationUpdateListener(t *testing.T) {
+	fsys := NewMapFS(readTestdataFiles(t, "irma_configuration"))
+	conf, err := NewConfigurationFromFS(fsys)
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+
+	var diffs []*ConfigurationDiff
+	conf.AddUpdateListener(func(diff *ConfigurationDiff) {
+		diffs = append(diffs, diff)
+	})
+
+	// Reparsing an unchanged configuration does not invoke the listener
+	require.NoError(t, conf.ParseFolder())
+	require.Empty(t, diffs)
+
+	// Replace irma-demo by its updated version
+	for path := range fsys {
+		if strings.HasPrefix(path, "irma-demo/") {
+			delete(fsys, path)
+		}
+	}
+	for path, bts := range readTestdataFiles(t, "irma_configuration_updated") {
+		fsys[path] = bts
+	}
+	require.NoError(t, conf.ParseFolder())
+	require.Len(t, diffs, 1)
+	require.Empty(t, diffs[0].PublicKeys)
+	require.Len(t, diffs[0].AttributeTypes, 2)
+	require.Equal(t, "irma-demo.RU.studentCard.level", diffs[0].AttributeTypes[0].ID)
+	require.Equal(t, DiffKindModified, diffs[0].AttributeTypes[0].Kind)
+	require.Equal(t, "irma-demo.RU.studentCard.newAttribute", diffs[0].AttributeTypes[1].ID)
+	require.Equal(t, DiffKindAdded, diffs[0].AttributeTypes[1].Kind)
+
+	// Public keys of removed schemes are reported, even though they can no longer be parsed
+	require.NoError(t, conf.RemoveSchemeManager(NewSchemeManagerIdentifier("test"), false))
+	require.Len(t, diffs, 2)
+	require.Len(t, diffs[1].SchemeManagers, 1)
+	require.Equal(t, DiffKindRemoved, diffs[1].SchemeManagers[0].Kind)
+	require.NotEmpty(t, diffs[1].PublicKeys)
+	for _, d := range diffs[1].PublicKeys {
+		require.True(t, strings.HasPrefix(d.ID, "test."))
+		require.Equal(t, DiffKindRemoved, d.Kind)
+	}
+}
+
+func TestSchemeMirrorFallback(t *testing.T) {
+	test.StartSchemeManagerHttpServer()
+	defer test.StopSchemeManagerHttpServer()
+
+	test.CreateTestStorage(t)
+	defer test.ClearTestStorage(t)
+
+	conf, err := NewConfiguration(filepath.Join("testdata", "storage", "test", "irma_configuration"))
+	require.NoError(t, err)
+
+	// Nothing listens at the scheme URL, so all files must come from the mirror
+	id := NewSchemeManagerIdentifier("irma-demo")
+	mirror := "http://localhost:48681/irma_configuration/irma-demo"
+	conf.SetSchemeMirrors(id, mirror)
+	scheme, err := DownloadSchemeManager("http://localhost:48689/irma-demo", mirror)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:48689/irma-demo", scheme.URL)
+	require.Equal(t, []string{"http://localhost:48689/irma-demo", mirror}, conf.schemeURLs(scheme))
+
+	require.NoError(t, conf.InstallSchemeManager(scheme, nil))
+	require.True(t, conf.SchemeManager(id).Valid)
+	require.NotNil(t, conf.CredentialType(NewCredentialTypeIdentifier("irma-demo.RU.studentCard")))
+
+	// The mirrors are kept in snapshots, which are used when updating
+	require.Equal(t, conf.schemeURLs(scheme), conf.Snapshot().schemeURLs(scheme))
+	require.NoError(t, conf.ParseFolder())
+	require.Equal(t, []string{"http://localhost:48689/irma-demo", mirror}, conf.schemeURLs(scheme))
+
+	// A mirror serving an issuer that does not match the signed index
+	tampered := httptest.NewServer(http.StripPrefix("/irma-demo/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "RU/description.xml" {
+			_, _ = w.Write([]byte("<Issuer>tampered</Issuer>"))
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", "irma_configuration", "irma-demo", filepath.FromSlash(r.URL.Path)))
+	})))
+	defer tampered.Close()
+	tmp, err := ioutil.TempDir("", "irma_configuration")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	install := func(mirrors ...string) (*Configuration, error) {
+		dir, err := ioutil.TempDir(tmp, "irma_configuration")
+		require.NoError(t, err)
+		conf, err := NewConfiguration(dir)
+		require.NoError(t, err)
+		conf.SetSchemeMirrors(id, mirrors...)
+		scheme, err := DownloadSchemeManager("http://localhost:48689/irma-demo", mirrors...)
+		require.NoError(t, err)
+		return conf, conf.InstallSchemeManager(scheme, nil)
+	}
+
+	// The tampered file is rejected, and downloaded from the next mirror instead
+	conf, err = install(tampered.URL+"/irma-demo", mirror)
+	require.NoError(t, err)
+	require.Equal(t, "Radboud University Nijmegen", conf.Issuer(NewIssuerIdentifier("irma-demo.RU")).Name["en"])
+
+	// Without a good mirror, installation fails
+	_, err = install(tampered.URL + "/irma-demo")
+	require.Error(t, err)
+}
+
+func TestPublicKeyCache(t *testing.T) {
+	conf, err := NewConfigurationFromFS(NewMapFS(readTestdataFiles(t, "irma_configuration")))
+	require.NoError(t, err)
+	require.NoError(t, conf.ParseFolder())
+	conf.SetPublicKeyCacheSize(2)
+	issuer := NewIssuerIdentifier("irma-demo.RU")
+
+	for _, counter := range []int{0, 1, 2, 0} {
+		pk, err := conf.PublicKey(issuer, counter)
+		require.NoError(t, err)
+		require.NotNil(t, pk)
+		require.Equal(t, counter, int(pk.Counter))
+		require.Equal(t, "irma-demo.RU", pk.Issuer)
+	}
+	require.Equal(t, 2, conf.publicKeys.len())
+	require.NotNil(t, conf.publicKeys.get(issuer, 0))
+	require.NotNil(t, conf.publicKeys.get(issuer, 2))
+	require.Nil(t, conf.publicKeys.get(issuer, 1))
+
+	// Nonexisting keys are not cached
+	pk, err := conf.PublicKey(issuer, 100)
+	require.NoError(t, err)
+	require.Nil(t, pk)
+	require.Equal(t, 2, conf.publicKeys.len())
+
+	require.NoError(t, conf.RemoveSchemeManager(issuer.SchemeManagerIdentifier(), false))
+	require.Equal(t, 0, conf.publicKeys.len())
+}
+
+// benchmarkConfigurationFS returns a file system containing a signed scheme called bench with the
+// specified amount of issuers, each of which is a copy of irma-demo.RU with one credential type.
+func benchmarkConfigurationFS(b *testing.B, issuers int) MapFS {
+	templates := readTestdataFiles(b, "irma_configuration/irma-demo")
+	rename := func(bts []byte, issuer string) []byte {
+		str := strings.Replace(string(bts), "irma-demo", "bench", -1)
+		str = strings.Replace(str, "<ID>RU</ID>", "<ID>"+issuer+"</ID>", 1)
+		str = strings.Replace(str, "<IssuerID>RU</IssuerID>", "<IssuerID>"+issuer+"</IssuerID>", 1)
+		return []byte(str)
+	}
+
+	files := map[string][]byte{
+		"bench/description.xml": rename(templates["description.xml"], ""),
+		"bench/timestamp":       templates["timestamp"],
+	}
+	for i := 0; i < issuers; i++ {
+		issuer := fmt.Sprintf("issuer%d", i)
+		files["bench/"+issuer+"/description.xml"] = rename(templates["RU/description.xml"], issuer)
+		files["bench/"+issuer+"/logo.png"] = templates["RU/logo.png"]
+		files["bench/"+issuer+"/Issues/studentCard/description.xml"] = rename(templates["RU/Issues/studentCard/description.xml"], issuer)
+		files["bench/"+issuer+"/Issues/studentCard/logo.png"] = templates["RU/Issues/studentCard/logo.png"]
+		for counter := 0; counter < 3; counter++ {
+			file := fmt.Sprintf("PublicKeys/%d.xml", counter)
+			files["bench/"+issuer+"/"+file] = templates["RU/"+file]
+		}
+	}
+
+	signTestScheme(b, files, "bench")
+	return NewMapFS(files)
+}
+
+// signTestScheme adds an index, a signature over it using a new key, and that key to the
+// specified scheme within files.
+func signTestScheme(t testing.TB, files map[string][]byte, scheme string) {
+	index := SchemeManagerIndex{}
+	for file, bts := range files {
+		if strings.HasPrefix(file, scheme+"/") {
+			hash := sha256.Sum256(bts)
+			index[file] = hash[:]
+		}
+	}
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	indexbts := []byte(index.String())
+	hash := sha256.Sum256(indexbts)
+	r, s, err := ecdsa.Sign(rand.Reader, sk, hash[:])
+	require.NoError(t, err)
+	sig, err := asn1.Marshal([]*gobig.Int{r, s})
+	require.NoError(t, err)
+	pkbts, err := x509.MarshalPKIXPublicKey(&sk.PublicKey)
+	require.NoError(t, err)
+
+	files[scheme+"/index"] = indexbts
+	files[scheme+"/index.sig"] = sig
+	files[scheme+"/pk.pem"] = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkbts})
+}
+
+func BenchmarkParseFolder(b *testing.B) {
+	fsys := benchmarkConfigurationFS(b, 200)
+	workers := parseWorkers
+	defer func() { parseWorkers = workers }()
+
+	for _, bm := range []struct {
+		name    string
+		workers int
+	}{{"sequential", 1}, {"parallel", workers}} {
+		b.Run(bm.name, func(b *testing.B) {
+			parseWorkers = bm.workers
+			for i := 0; i < b.N; i++ {
+				conf, err := NewConfigurationFromFS(fsys)
+				require.NoError(b, err)
+				require.NoError(b, conf.ParseFolder())
+				require.Len(b, conf.Issuers, 200)
+			}
+		})
+	}
+}
+
+func BenchmarkPublicKey(b *testing.B) {
+	fsys := benchmarkConfigurationFS(b, 200)
+	conf, err := NewConfigurationFromFS(fsys)
+	require.NoError(b, err)
+	require.NoError(b, conf.ParseFolder())
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pk, err := conf.parsePublicKey(NewIssuerIdentifier(fmt.Sprintf("bench.issuer%d", i%200)), 2)
+			require.NoError(b, err)
+			require.NotNil(b, pk)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		id := NewIssuerIdentifier("bench.issuer0")
+		for i := 0; i < b.N; i++ {
+			pk, err := conf.PublicKey(id, 2)
+			require.NoError(b, err)
+			require.NotNil(b, pk)
+		}
+	})
+}
+
+func TestAttributeValueTranslations(t *testing.T) {
+	var attrtype AttributeType
+	require.NoError(t, xml.Unmarshal([]byte(`<Attribute id="gender">
+		<Name><en>Gender</en><nl>Geslacht</nl></Name>
+		<Description><en>Your gender</en><nl>Uw geslacht</nl></Description>
+		<Values>
+			<Value value="M"><en>Male</en><nl>Man</nl><de>Mann</de></Value>
+			<Value value="F"><en>Female</en></Value>
+		</Values>
+	</Attribute>`), &attrtype))
+	require.Equal(t, AttributeValueTranslations{
+		"M": {"en": "Male", "nl": "Man", "de": "Mann"},
+		"F": {"en": "Female"},
+	}, attrtype.Values)
+
+	m, x := "M", "X"
+	require.Equal(t, TranslatedString{"": "M", "en": "Male", "nl": "Man", "de": "Mann"}, attrtype.Translate(&m))
+	require.Equal(t, NewTranslatedString(&x), attrtype.Translate(&x))
+	require.Nil(t, attrtype.Translate(nil))
+	require.Equal(t, NewTranslatedString(&m), (*AttributeType)(nil).Translate(&m))
+
+	// Marshaling and unmarshaling again yields the same translations
+	bts, err := xml.Marshal(&attrtype)
+	require.NoError(t, err)
+	var unmarshaled AttributeType
+	require.NoError(t, xml.Unmarshal(bts, &unmarshaled))
+	require.Equal(t, attrtype.Values, unmarshaled.Values)
+
+	conf := &Configuration{}
+	conf.validateTranslations("Attribute gender", &attrtype)
+	require.Equal(t, []string{"Attribute gender misses nl translation of value F in <Values> tag"}, conf.Warnings)
+
+	conf = &Configuration{}
+	conf.SetRequiredLanguages("en", "de")
+	conf.validateTranslations("Attribute gender", &attrtype)
+	require.Equal(t, []string{
+		"Attribute gender misses de translation in <Name> tag",
+		"Attribute gender misses de translation in <Description> tag",
+		"Attribute gender misses de translation of value F in <Values> tag",
+	}, conf.Warnings)
+}
+
+func TestCredentialView(t *testing.T) {
+	conf := parseConfiguration(t)
+	credid := NewCredentialTypeIdentifier("irma-demo.RU.studentCard")
+	credtype := conf.CredentialType(credid)
+	credtype.BackgroundColor = "#123456"
+	credtype.Category = "education"
+	credtype.AttributeTypes[1].Hidden = "true" // studentCardNumber
+	credtype.AttributeTypes[2].Secret = "true" // studentID
+	first, second := 0, 1
+	credtype.AttributeTypes[3].DisplayIndex = &first  // level
+	credtype.AttributeTypes[0].DisplayIndex = &second // university
+	credtype.AttributeTypes[3].Values = AttributeValueTranslations{"42": {"en": "The answer", "nl": "Het antwoord"}}
+
+	al, err := (&CredentialRequest{
+		CredentialTypeID: credid,
+		Attributes: map[string]string{
+			"university":        "Radboud",
+			"studentCardNumber": "31415927",
+			"studentID":         "s1234567",
+			"level":             "42",
+		},
+	}).AttributeList(conf, 0x03)
+	require.NoError(t, err)
+
+	view := al.View(conf)
+	require.NotNil(t, view)
+	require.Equal(t, credid, view.ID)
+	require.Equal(t, "#123456", view.BackgroundColor)
+	require.Equal(t, "education", view.Category)
+	require.Equal(t, conf.Issuer(credid.IssuerIdentifier()).Name, view.IssuerName)
+	require.NotEmpty(t, view.Logo)
+	require.Equal(t, conf.Issuer(credid.IssuerIdentifier()).Logo(conf), view.IssuerLogo)
+	require.NotEmpty(t, view.IssuerLogo)
+
+	require.Len(t, view.Attributes, 3)
+	require.Equal(t, "level", view.Attributes[0].ID.Name())
+	require.Equal(t, "The answer", view.Attributes[0].Value["en"])
+	require.Equal(t, "Radboud", view.Attributes[1].Value[""])
+	require.Equal(t, "studentID", view.Attributes[2].ID.Name())
+	require.True(t, view.Attributes[2].Secret)
+
+	logo, err := conf.CredentialTypeLogo(credid)
+	require.NoError(t, err)
+	require.NotEmpty(t, logo)
+	logo, err = conf.IssuerLogo(credid.IssuerIdentifier())
+	require.NoError(t, err)
+	require.NotEmpty(t, logo)
+	logo, err = conf.IssuerLogo(NewIssuerIdentifier("irma-demo.nonexisting"))
+	require.NoError(t, err)
+	require.Nil(t, logo)
+}
@@ -162,6 +162,7 @@ const (
 	ActionSchemeManager = Action("schememanager")
 	ActionDisclosing    = Action("disclosing")
 	ActionSigning       = Action("signing")
+	ActionMultiSigning  = Action("multisigning")
 	ActionIssuing       = Action("issuing")
 	ActionRedirect      = Action("redirect")
 	ActionUnknown       = Action("unknown")
@@ -201,6 +202,10 @@ const (
 	ErrorInvalidRequest = ErrorType("invalidRequest")
 	// Recovered panic
 	ErrorPanic = ErrorType("panic")
+	// Session refused by the session policy of the client
+	ErrorBlocked = ErrorType("blocked")
+	// Another session is already running in the client
+	ErrorSessionInProgress = ErrorType("sessionInProgress")
 )
 
 type Disclosure struct {
@@ -288,6 +293,8 @@ func ParseRequestorJwt(action string, requestorJwt string) (RequestorJwt, error)
 		retval = &SignatureRequestorJwt{}
 	case "issue_request", string(ActionIssuing):
 		retval = &IdentityProviderJwt{}
+	case "multisignature_request", string(ActionMultiSigning):
+		retval = &MultiSignatureRequestorJwt{}
 	default:
 		return nil, errors.New("Invalid session type")
 	}
@@ -0,0 +1,92 @@
+package irma
+
+import (
+	"container/list"
+
+	"github.com/privacybydesign/gabi"
+)
+
+// DefaultPublicKeyCacheSize is the maximum amount of public keys that a Configuration keeps in
+// memory, unless configured otherwise with SetPublicKeyCacheSize().
+const DefaultPublicKeyCacheSize = 256
+
+// publicKeyCache is a bounded cache of parsed public keys, evicting the least recently used
+// public key when full. It is not safe for concurrent use.
+type publicKeyCache struct {
+	size    int
+	entries map[publicKeyID]*list.Element
+	order   *list.List // of *publicKeyEntry, most recently used first
+}
+
+type publicKeyID struct {
+	issuer  IssuerIdentifier
+	counter int
+}
+
+type publicKeyEntry struct {
+	id publicKeyID
+	pk *gabi.PublicKey
+}
+
+func newPublicKeyCache(size int) *publicKeyCache {
+	if size <= 0 {
+		size = DefaultPublicKeyCacheSize
+	}
+	return &publicKeyCache{
+		size:    size,
+		entries: map[publicKeyID]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the specified public key, or nil if it is not in the cache.
+func (cache *publicKeyCache) get(issuer IssuerIdentifier, counter int) *gabi.PublicKey {
+	elem, ok := cache.entries[publicKeyID{issuer, counter}]
+	if !ok {
+		return nil
+	}
+	cache.order.MoveToFront(elem)
+	return elem.Value.(*publicKeyEntry).pk
+}
+
+func (cache *publicKeyCache) put(issuer IssuerIdentifier, counter int, pk *gabi.PublicKey) {
+	id := publicKeyID{issuer, counter}
+	if elem, ok := cache.entries[id]; ok {
+		elem.Value.(*publicKeyEntry).pk = pk
+		cache.order.MoveToFront(elem)
+		return
+	}
+	cache.entries[id] = cache.order.PushFront(&publicKeyEntry{id: id, pk: pk})
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+func (cache *publicKeyCache) remove(elem *list.Element) {
+	cache.order.Remove(elem)
+	delete(cache.entries, elem.Value.(*publicKeyEntry).id)
+}
+
+// removeScheme removes the public keys of all issuers of the specified scheme from the cache.
+func (cache *publicKeyCache) removeScheme(scheme SchemeManagerIdentifier) {
+	for id, elem := range cache.entries {
+		if id.issuer.SchemeManagerIdentifier() == scheme {
+			cache.remove(elem)
+		}
+	}
+}
+
+func (cache *publicKeyCache) len() int {
+	return cache.order.Len()
+}
+
+// copy returns a copy of the cache of the specified size, containing the most recently used
+// public keys of this cache that fit.
+func (cache *publicKeyCache) copy(size int) *publicKeyCache {
+	c := newPublicKeyCache(size)
+	for elem := cache.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*publicKeyEntry)
+		c.put(entry.id.issuer, entry.id.counter, entry.pk)
+	}
+	return c
+}
@@ -0,0 +1,194 @@
+package irma
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// This file contains requestor schemes: signed lists of requestors (verifiers, signature requestors
+// and issuers), with which IRMA apps can show users who is asking for their attributes.
+//
+// A requestor scheme is a directory in irma_configuration alongside the scheme managers, signed
+// in the same way (index, index.sig, pk.pem, timestamp). It is recognized by its description.json
+// (instead of description.xml), and lists its requestors in requestors.json, e.g.:
+//   [{
+//     "name": {"en": "Example", "nl": "Voorbeeld"},
+//     "hostnames": ["example.com", "www.example.com"],
+//     "logo": "assets/example.png",
+//     "attributes": ["irma-demo.MijnOverheid.fullName", "irma-demo.RU.studentCard.studentID"]
+//   }]
+// in which the attributes are the attributes (or all attributes of the credential types) that
+// the requestor declares to request.
+
+const (
+	requestorSchemeDescription = "description.json"
+	requestorSchemeRequestors  = "requestors.json"
+)
+
+// RequestorScheme describes a requestor scheme.
+type RequestorScheme struct {
+	ID   RequestorSchemeIdentifier `json:"id"`
+	URL  string                    `json:"url"`
+	Demo bool                      `json:"demo"`
+
+	Timestamp  Timestamp        `json:"-"`
+	Requestors []*RequestorInfo `json:"-"`
+
+	index SchemeManagerIndex
+}
+
+// RequestorInfo describes a requestor listed in a requestor scheme.
+type RequestorInfo struct {
+	Scheme     RequestorSchemeIdentifier `json:"-"`
+	Name       TranslatedString          `json:"name"`
+	Hostnames  []string                  `json:"hostnames"`
+	Logo       string                    `json:"logo,omitempty"` // Path within the requestor scheme
+	Attributes []AttributeTypeIdentifier `json:"attributes,omitempty"`
+}
+
+// Requestor returns the requestor from the requestor schemes having the specified hostname,
+// or nil if there is none.
+func (conf *Configuration) Requestor(hostname string) *RequestorInfo {
+	conf.lock.RLock()
+	defer conf.lock.RUnlock()
+	return conf.requestors[strings.ToLower(hostname)]
+}
+
+// LogoPath returns the path to the logo of the requestor, or "" if it has none.
+func (ri *RequestorInfo) LogoPath(conf *Configuration) string {
+	if ri.Logo == "" {
+		return ""
+	}
+	path := filepath.Join(conf.Path, ri.Scheme.String(), filepath.FromSlash(ri.Logo))
+	exists, err := conf.pathExists(path)
+	if err != nil || !exists {
+		return ""
+	}
+	return path
+}
+
+// Declares returns whether the requestor declared that it requests the specified attribute,
+// either explicitly or by declaring its credential type.
+func (ri *RequestorInfo) Declares(attr AttributeTypeIdentifier) bool {
+	for _, declared := range ri.Attributes {
+		if declared == attr || (declared.IsCredential() && declared.CredentialTypeIdentifier() == attr.CredentialTypeIdentifier()) {
+			return true
+		}
+	}
+	return false
+}
+
+// UndeclaredAttributes returns the attributes (sorted and without duplicates) that the specified
+// request asks to be disclosed, but that the requestor did not declare.
+func (ri *RequestorInfo) UndeclaredAttributes(request SessionRequest) []AttributeTypeIdentifier {
+	set := map[AttributeTypeIdentifier]struct{}{}
+	_ = request.Disclosure().Disclose.Iterate(func(attr *AttributeRequest) error {
+		if !ri.Declares(attr.Type) {
+			set[attr.Type] = struct{}{}
+		}
+		return nil
+	})
+	var undeclared []AttributeTypeIdentifier
+	for attr := range set {
+		undeclared = append(undeclared, attr)
+	}
+	sort.Slice(undeclared, func(i, j int) bool { return undeclared[i].String() < undeclared[j].String() })
+	return undeclared
+}
+
+// isRequestorScheme returns whether the specified directory contains a requestor scheme.
+func (conf *Configuration) isRequestorScheme(dir string) (bool, error) {
+	return conf.pathExists(filepath.Join(dir, requestorSchemeDescription))
+}
+
+// parseRequestorSchemeFolder verifies and parses the requestor scheme in the specified directory.
+func (conf *Configuration) parseRequestorSchemeFolder(dir string) error {
+	name := filepath.Base(dir)
+	if err := conf.VerifySignature(NewSchemeManagerIdentifier(name)); err != nil {
+		return err
+	}
+	index, err := conf.parseIndex(name, nil)
+	if err != nil {
+		return err
+	}
+	if index.Scheme().Name() != name {
+		return errors.Errorf("Folder must be called %s, not %s", index.Scheme().Name(), name)
+	}
+	for file := range index {
+		exists, err := conf.pathExists(filepath.Join(conf.Path, file))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, _, err = conf.readAuthenticatedFile(index, file); err != nil {
+			return err
+		}
+	}
+
+	scheme := &RequestorScheme{index: index}
+	if err = conf.readRequestorSchemeFile(index, name, requestorSchemeDescription, scheme); err != nil {
+		return err
+	}
+	if scheme.ID.String() != name {
+		return errors.Errorf("Requestor scheme %s has wrong directory name %s", scheme.ID, name)
+	}
+	ts, exists, err := readTimestamp(conf.files(), filepath.Join(dir, "timestamp"))
+	if err != nil || !exists {
+		return errors.WrapPrefix(err, "Could not read requestor scheme timestamp", 0)
+	}
+	scheme.Timestamp = *ts
+	if err = conf.readRequestorSchemeFile(index, name, requestorSchemeRequestors, &scheme.Requestors); err != nil {
+		return err
+	}
+
+	// Validate all requestors before registering any of them, so that nothing of an invalid
+	// scheme ends up in the configuration
+	for i, requestor := range scheme.Requestors {
+		if len(requestor.Hostnames) == 0 {
+			return errors.Errorf("Requestor %d of requestor scheme %s has no hostnames", i, name)
+		}
+	}
+
+	for i, requestor := range scheme.Requestors {
+		requestor.Scheme = scheme.ID
+		desc := fmt.Sprintf("Requestor %d of requestor scheme %s", i, name)
+		conf.validateTranslations(desc, requestor)
+		if requestor.Logo != "" {
+			if _, ok := index[name+"/"+requestor.Logo]; !ok {
+				conf.Warnings = append(conf.Warnings, fmt.Sprintf("%s has logo %s that is not present in the index", desc, requestor.Logo))
+			}
+		}
+		for _, hostname := range requestor.Hostnames {
+			hostname = strings.ToLower(hostname)
+			if other, present := conf.requestors[hostname]; present {
+				conf.Warnings = append(conf.Warnings, fmt.Sprintf("Hostname %s is listed in both requestor schemes %s and %s; using the first", hostname, other.Scheme, name))
+				continue
+			}
+			conf.requestors[hostname] = requestor
+		}
+	}
+
+	conf.RequestorSchemes[scheme.ID] = scheme
+	return nil
+}
+
+func (conf *Configuration) readRequestorSchemeFile(index SchemeManagerIndex, name, file string, dest interface{}) error {
+	bts, found, err := conf.readAuthenticatedFile(index, filepath.Join(name, file))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("File %s not present in requestor scheme index", file)
+	}
+	if err = json.Unmarshal(bts, dest); err != nil {
+		return errors.WrapPrefix(err, "Failed to parse "+file+" of requestor scheme "+name, 0)
+	}
+	return nil
+}
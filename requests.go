@@ -3,7 +3,6 @@ package irma
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"strconv"
 	"time"
 
@@ -12,7 +11,6 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/gabi"
 	"github.com/privacybydesign/gabi/big"
-	"github.com/privacybydesign/irmago/internal/fs"
 )
 
 const (
@@ -318,7 +316,7 @@ func (cdc AttributeConDisCon) Validate(conf *Configuration) error {
 			var nonsingleton *CredentialTypeIdentifier
 			for _, attr := range con {
 				typ := attr.Type.CredentialTypeIdentifier()
-				if !conf.CredentialTypes[typ].IsSingleton {
+				if !conf.CredentialType(typ).IsSingleton {
 					if nonsingleton != nil && *nonsingleton != typ {
 						return errors.New("Multiple non-singletons within one inner conjunction are not allowed")
 					} else {
@@ -468,7 +466,7 @@ func (cr *CredentialRequest) Info(conf *Configuration, metadataVersion byte) (*C
 // the credential type is known, all required attributes are present and no unknown attributes
 // are given.
 func (cr *CredentialRequest) Validate(conf *Configuration) error {
-	credtype := conf.CredentialTypes[cr.CredentialTypeID]
+	credtype := conf.CredentialType(cr.CredentialTypeID)
 	if credtype == nil {
 		return errors.New("Credential request of unknown credential type")
 	}
@@ -513,7 +511,7 @@ func (cr *CredentialRequest) AttributeList(conf *Configuration, metadataVersion
 	}
 
 	// Compute other attributes
-	credtype := conf.CredentialTypes[cr.CredentialTypeID]
+	credtype := conf.CredentialType(cr.CredentialTypeID)
 	attrs := make([]*big.Int, len(credtype.AttributeTypes)+1)
 	attrs[0] = meta.Int
 	for i, attrtype := range credtype.AttributeTypes {
@@ -674,15 +672,15 @@ func (t *Timestamp) Floor() Timestamp {
 	return Timestamp(time.Unix((time.Time(*t).Unix()/ExpiryFactor)*ExpiryFactor, 0))
 }
 
-func readTimestamp(path string) (*Timestamp, bool, error) {
-	exists, err := fs.PathExists(path)
+func readTimestamp(fsys ConfigurationFS, path string) (*Timestamp, bool, error) {
+	exists, err := fsPathExists(fsys, path)
 	if err != nil {
 		return nil, false, err
 	}
 	if !exists {
 		return nil, false, nil
 	}
-	bts, err := ioutil.ReadFile(path)
+	bts, err := fsys.ReadFile(path)
 	if err != nil {
 		return nil, true, errors.New("Could not read scheme manager timestamp")
 	}
@@ -869,6 +867,8 @@ func SignSessionRequest(request SessionRequest, alg jwt.SigningMethod, key inter
 		jwtcontents = NewServiceProviderJwt(name, r)
 	case *SignatureRequest:
 		jwtcontents = NewSignatureRequestorJwt(name, r)
+	case *MultiSignatureRequest:
+		jwtcontents = NewMultiSignatureRequestorJwt(name, r)
 	}
 	return jwtcontents.Sign(alg, key)
 }
@@ -885,6 +885,9 @@ func SignRequestorRequest(request RequestorRequest, alg jwt.SigningMethod, key i
 	case *SignatureRequestorRequest:
 		jwtcontents = NewSignatureRequestorJwt(name, nil)
 		jwtcontents.(*SignatureRequestorJwt).Request = r
+	case *MultiSignatureRequestorRequest:
+		jwtcontents = NewMultiSignatureRequestorJwt(name, nil)
+		jwtcontents.(*MultiSignatureRequestorJwt).Request = r
 	}
 	return jwtcontents.Sign(alg, key)
 }
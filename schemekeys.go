@@ -0,0 +1,230 @@
+package irma
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	gobig "math/big"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/privacybydesign/irmago/internal/fs"
+)
+
+// SchemeKeyRotationsFile is the file within a scheme directory containing the chain of
+// signing key rotations of the scheme.
+const SchemeKeyRotationsFile = "keyrotations.json"
+
+const schemeKeyRotationPrefix = "IRMA scheme key rotation v1"
+
+// A SchemeKeyRotation is a statement, signed by the previous signing key of a scheme, designating
+// the key with which the scheme is signed from then on, optionally during a limited period.
+// The first statement of a chain is signed by the key in the pk.pem file of the scheme.
+type SchemeKeyRotation struct {
+	PublicKey  string     `json:"publicKey"` // PEM-encoded ECDSA public key
+	ValidFrom  *Timestamp `json:"validFrom,omitempty"`
+	ValidUntil *Timestamp `json:"validUntil,omitempty"`
+	Signature  []byte     `json:"signature"` // ASN.1-encoded ECDSA signature by the previous key
+}
+
+// SchemeKeyRotations is a chain of key rotations, in which each statement is signed by the key
+// designated by the previous one.
+type SchemeKeyRotations []*SchemeKeyRotation
+
+// NewSchemeKeyRotation returns a key rotation statement for the specified scheme, in which the
+// previous key designates the next key, optionally valid only within the specified period.
+func NewSchemeKeyRotation(
+	scheme SchemeManagerIdentifier,
+	previous *ecdsa.PrivateKey,
+	next *ecdsa.PublicKey,
+	validFrom, validUntil *Timestamp,
+) (*SchemeKeyRotation, error) {
+	bts, err := x509.MarshalPKIXPublicKey(next)
+	if err != nil {
+		return nil, err
+	}
+	rotation := &SchemeKeyRotation{
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bts})),
+		ValidFrom:  validFrom,
+		ValidUntil: validUntil,
+	}
+
+	hash := sha256.Sum256(rotation.message(scheme))
+	r, s, err := ecdsa.Sign(rand.Reader, previous, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	if rotation.Signature, err = asn1.Marshal([]*gobig.Int{r, s}); err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// message returns the bytes that are signed in a key rotation statement. The scheme identifier is
+// included so that a statement cannot be replayed in other schemes signed by the same key.
+func (r *SchemeKeyRotation) message(scheme SchemeManagerIdentifier) []byte {
+	var from, until int64
+	if r.ValidFrom != nil {
+		from = time.Time(*r.ValidFrom).Unix()
+	}
+	if r.ValidUntil != nil {
+		until = time.Time(*r.ValidUntil).Unix()
+	}
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%d\n%s", schemeKeyRotationPrefix, scheme.String(), from, until, r.PublicKey))
+}
+
+// Key returns the public key designated by this statement.
+func (r *SchemeKeyRotation) Key() (*ecdsa.PublicKey, error) {
+	return ParsePemEcdsaPublicKey([]byte(r.PublicKey))
+}
+
+// Verify checks that this statement is signed by the specified key.
+func (r *SchemeKeyRotation) Verify(scheme SchemeManagerIdentifier, pk *ecdsa.PublicKey) error {
+	ints := make([]*gobig.Int, 0, 2)
+	if _, err := asn1.Unmarshal(r.Signature, &ints); err != nil || len(ints) != 2 {
+		return errors.New("Invalid scheme key rotation signature")
+	}
+	hash := sha256.Sum256(r.message(scheme))
+	if !ecdsa.Verify(pk, hash[:], ints[0], ints[1]) {
+		return errors.New("Scheme key rotation signature was invalid")
+	}
+	return nil
+}
+
+// Follow verifies the chain starting at the specified trusted key, and returns the signing key
+// of the scheme at the specified time. If the trusted key is itself designated by one of the
+// statements (e.g. because it was installed after the rotation), the chain is followed from that
+// statement onwards. Statements that are not yet valid at the specified time are not followed.
+func (chain SchemeKeyRotations) Follow(scheme SchemeManagerIdentifier, trusted *ecdsa.PublicKey, t time.Time) (*ecdsa.PublicKey, error) {
+	current := trusted
+	var validUntil *Timestamp
+	start := 0
+	for i, rotation := range chain {
+		pk, err := rotation.Key()
+		if err != nil {
+			return nil, err
+		}
+		if ecdsaKeysEqual(pk, trusted) {
+			start = i + 1
+			validUntil = rotation.ValidUntil
+		}
+	}
+
+	for _, rotation := range chain[start:] {
+		if err := rotation.Verify(scheme, current); err != nil {
+			return nil, err
+		}
+		if rotation.ValidFrom != nil && t.Before(time.Time(*rotation.ValidFrom)) {
+			break
+		}
+		next, err := rotation.Key()
+		if err != nil {
+			return nil, err
+		}
+		current, validUntil = next, rotation.ValidUntil
+	}
+
+	if validUntil != nil && t.After(time.Time(*validUntil)) {
+		return nil, errors.Errorf("Signing key of scheme %s expired at %s", scheme, time.Time(*validUntil).String())
+	}
+	return current, nil
+}
+
+// extends returns whether the specified chain is a prefix of this chain.
+func (chain SchemeKeyRotations) extends(other SchemeKeyRotations) bool {
+	if len(other) > len(chain) {
+		return false
+	}
+	for i, rotation := range other {
+		if rotation.PublicKey != chain[i].PublicKey || !bytes.Equal(rotation.Signature, chain[i].Signature) {
+			return false
+		}
+	}
+	return true
+}
+
+func ecdsaKeysEqual(pk1, pk2 *ecdsa.PublicKey) bool {
+	return pk1.Curve == pk2.Curve && pk1.X.Cmp(pk2.X) == 0 && pk1.Y.Cmp(pk2.Y) == 0
+}
+
+// SchemeKeyRotations returns the key rotation chain of the specified scheme, or nil if it has none.
+func (conf *Configuration) SchemeKeyRotations(id SchemeManagerIdentifier) (SchemeKeyRotations, error) {
+	path := filepath.Join(conf.Path, id.String(), SchemeKeyRotationsFile)
+	exists, err := conf.pathExists(path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	bts, err := conf.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain SchemeKeyRotations
+	if err = json.Unmarshal(bts, &chain); err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to parse scheme key rotations", 0)
+	}
+	return chain, nil
+}
+
+// SchemeSigningKey returns the current signing key of the specified scheme, by following its
+// key rotation chain (if any) starting at the public key in its pk.pem file.
+func (conf *Configuration) SchemeSigningKey(id SchemeManagerIdentifier) (*ecdsa.PublicKey, error) {
+	pk, err := conf.schemeTrustedKey(id)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := conf.SchemeKeyRotations(id)
+	if err != nil {
+		return nil, err
+	}
+	return chain.Follow(id, pk, time.Now())
+}
+
+// schemeTrustedKey returns the public key in the pk.pem file of the specified scheme.
+func (conf *Configuration) schemeTrustedKey(id SchemeManagerIdentifier) (*ecdsa.PublicKey, error) {
+	pkbts, err := conf.readFile(filepath.Join(conf.Path, id.String(), "pk.pem"))
+	if err != nil {
+		return nil, err
+	}
+	return ParsePemEcdsaPublicKey(pkbts)
+}
+
+// downloadSchemeKeyRotations downloads and stores the key rotation chain of the scheme, if it has
+// one, provided that it extends the chain that we already have and that it can be followed
+// starting at the public key of the scheme that we trust.
+func (conf *Configuration) downloadSchemeKeyRotations(manager *SchemeManager, transport *HTTPTransport) error {
+	bts, err := transport.GetBytes(SchemeKeyRotationsFile)
+	if err != nil {
+		if serr, ok := err.(*SessionError); ok && serr.RemoteStatus == http.StatusNotFound {
+			return nil // scheme has no key rotations
+		}
+		return err
+	}
+	var chain SchemeKeyRotations
+	if err = json.Unmarshal(bts, &chain); err != nil {
+		return errors.WrapPrefix(err, "Failed to parse scheme key rotations", 0)
+	}
+	local, err := conf.SchemeKeyRotations(manager.Identifier())
+	if err != nil {
+		return err
+	}
+	if !chain.extends(local) {
+		return errors.Errorf("Key rotations of scheme %s do not extend the ones we have", manager.ID)
+	}
+	// Only store chains that are signed starting at the key that we trust
+	pk, err := conf.schemeTrustedKey(manager.Identifier())
+	if err != nil {
+		return err
+	}
+	if _, err = chain.Follow(manager.Identifier(), pk, time.Now()); err != nil {
+		return errors.WrapPrefix(err, fmt.Sprintf("Key rotations of scheme %s are not signed by its key", manager.ID), 0)
+	}
+	return fs.SaveFile(filepath.Join(conf.Path, manager.ID, SchemeKeyRotationsFile), bts)
+}
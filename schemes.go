@@ -57,7 +57,7 @@ func (conf *Configuration) downloadDemoPrivateKeys(scheme *SchemeManager) error
 	}
 
 	Logger.Debugf("Attempting downloading of private keys of scheme %s", scheme.ID)
-	transport := NewHTTPTransport(scheme.URL)
+	transport := conf.schemeTransport(scheme)
 
 	err := transport.GetFile("sk.pem", filepath.Join(conf.Path, scheme.ID, "sk.pem"))
 	if err != nil { // If downloading of any of the private key fails just log it, and then continue
@@ -88,3 +88,97 @@ func (conf *Configuration) downloadDemoPrivateKeys(scheme *SchemeManager) error
 
 	return nil
 }
+
+// SetSchemeMirrors sets the URLs of mirrors of the specified scheme in this configuration. When
+// downloading files of the scheme fails at the scheme URL, the mirrors declared in the scheme
+// description and then the mirrors set here are tried in order. Just like the files downloaded
+// from the scheme URL, all files downloaded from mirrors are verified against the signed index
+// of the scheme.
+func (conf *Configuration) SetSchemeMirrors(id SchemeManagerIdentifier, urls ...string) {
+	conf.lock.Lock()
+	defer conf.lock.Unlock()
+	if conf.schemeMirrors == nil {
+		conf.schemeMirrors = map[SchemeManagerIdentifier][]string{}
+	}
+	conf.schemeMirrors[id] = urls
+}
+
+// schemeURLs returns the URL of the specified scheme followed by the URLs of its mirrors.
+func (conf *Configuration) schemeURLs(manager *SchemeManager) []string {
+	conf.lock.RLock()
+	mirrors := append(append([]string{}, manager.Mirrors...), conf.schemeMirrors[manager.Identifier()]...)
+	conf.lock.RUnlock()
+
+	urls := []string{normalizeSchemeURL(manager.URL)}
+	seen := map[string]struct{}{urls[0]: {}}
+	for _, url := range mirrors {
+		url = normalizeSchemeURL(url)
+		if _, ok := seen[url]; !ok {
+			seen[url] = struct{}{}
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+func normalizeSchemeURL(url string) string {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "https://" + url
+	}
+	url = strings.TrimSuffix(url, "/")
+	return strings.TrimSuffix(url, "/description.xml")
+}
+
+// schemeTransport downloads the files of a scheme from the URL of the scheme or, if that fails,
+// from each of its mirrors in turn.
+type schemeTransport struct {
+	transports []*HTTPTransport
+}
+
+func newSchemeTransport(urls []string) *schemeTransport {
+	t := &schemeTransport{}
+	for _, url := range urls {
+		t.transports = append(t.transports, NewHTTPTransport(url))
+	}
+	return t
+}
+
+func (conf *Configuration) schemeTransport(manager *SchemeManager) *schemeTransport {
+	return newSchemeTransport(conf.schemeURLs(manager))
+}
+
+// try invokes f with the transport of each URL in turn, until it succeeds. If it fails for all
+// URLs, the last error is returned.
+func (t *schemeTransport) try(f func(transport *HTTPTransport) error) error {
+	var err error
+	for i, transport := range t.transports {
+		if err = f(transport); err == nil {
+			return nil
+		}
+		if i < len(t.transports)-1 {
+			Logger.Warnf("Downloading from %s failed, trying next mirror: %s", transport.Server, err.Error())
+		}
+	}
+	return err
+}
+
+func (t *schemeTransport) GetBytes(url string) ([]byte, error) {
+	var bts []byte
+	err := t.try(func(transport *HTTPTransport) (err error) {
+		bts, err = transport.GetBytes(url)
+		return
+	})
+	return bts, err
+}
+
+// GetSignedFile downloads the specified file, trying the next URL also if the file does not
+// match the specified hash.
+func (t *schemeTransport) GetSignedFile(url string, dest string, hash ConfigurationFileHash) error {
+	return t.try(func(transport *HTTPTransport) error {
+		return transport.GetSignedFile(url, dest, hash)
+	})
+}
+
+func (t *schemeTransport) GetFile(url string, dest string) error {
+	return t.GetSignedFile(url, dest, nil)
+}
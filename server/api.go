@@ -69,8 +69,11 @@ type Configuration struct {
 }
 
 type SessionPackage struct {
-	SessionPtr *irma.Qr `json:"sessionPtr"`
+	SessionPtr *irma.Qr `json:"sessionPtr,omitempty"`
 	Token      string   `json:"token"`
+
+	// In multi-signature sessions, the session pointers for each of the signers (in order)
+	SessionPtrs []*irma.Qr `json:"sessionPtrs,omitempty"`
 }
 
 // SessionResult contains session information such as the session status, type, possible errors,
@@ -84,6 +87,11 @@ type SessionResult struct {
 	Signature   *irma.SignedMessage          `json:"signature,omitempty"`
 	Err         *irma.RemoteError            `json:"error,omitempty"`
 
+	// In multi-signature sessions, the combined signatures and the results of the signature
+	// sessions of each of the signers (in order)
+	SignatureBundle *irma.SignatureBundle `json:"signatureBundle,omitempty"`
+	CoSigners       []*SessionResult      `json:"cosigners,omitempty"`
+
 	LegacySession bool `json:"-"` // true if request was started with legacy (i.e. pre-condiscon) session request
 }
 
@@ -131,7 +139,7 @@ func (conf *Configuration) PrivateKey(id irma.IssuerIdentifier) (sk *gabi.Privat
 func (conf *Configuration) HavePrivateKeys() (bool, error) {
 	var err error
 	var sk *gabi.PrivateKey
-	for id := range conf.IrmaConfiguration.Issuers {
+	for id := range conf.IrmaConfiguration.Snapshot().Issuers {
 		sk, err = conf.PrivateKey(id)
 		if err != nil {
 			return false, err
@@ -212,8 +220,9 @@ func WriteString(w http.ResponseWriter, str string) {
 }
 
 // ParseSessionRequest attempts to parse the input as an irma.RequestorRequest instance, accepting (skipping "irma.")
-//  - RequestorRequest instances directly (ServiceProviderRequest, SignatureRequestorRequest, IdentityProviderRequest)
-//  - SessionRequest instances (DisclosureRequest, SignatureRequest, IssuanceRequest)
+//  - RequestorRequest instances directly (ServiceProviderRequest, SignatureRequestorRequest, IdentityProviderRequest,
+//    MultiSignatureRequestorRequest)
+//  - SessionRequest instances (DisclosureRequest, SignatureRequest, IssuanceRequest, MultiSignatureRequest)
 //  - JSON representations ([]byte or string) of any of the above.
 func ParseSessionRequest(request interface{}) (irma.RequestorRequest, error) {
 	switch r := request.(type) {
@@ -224,12 +233,12 @@ func ParseSessionRequest(request interface{}) (irma.RequestorRequest, error) {
 	case string:
 		return ParseSessionRequest([]byte(r))
 	case []byte:
-		var attempts = []irma.Validator{&irma.ServiceProviderRequest{}, &irma.SignatureRequestorRequest{}, &irma.IdentityProviderRequest{}}
+		var attempts = []irma.Validator{&irma.ServiceProviderRequest{}, &irma.SignatureRequestorRequest{}, &irma.IdentityProviderRequest{}, &irma.MultiSignatureRequestorRequest{}}
 		t, err := tryUnmarshalJson(r, attempts)
 		if err == nil {
 			return t.(irma.RequestorRequest), nil
 		}
-		attempts = []irma.Validator{&irma.DisclosureRequest{}, &irma.SignatureRequest{}, &irma.IssuanceRequest{}}
+		attempts = []irma.Validator{&irma.DisclosureRequest{}, &irma.SignatureRequest{}, &irma.IssuanceRequest{}, &irma.MultiSignatureRequest{}}
 		t, err = tryUnmarshalJson(r, attempts)
 		if err == nil {
 			return wrapSessionRequest(t.(irma.SessionRequest))
@@ -248,6 +257,8 @@ func wrapSessionRequest(request irma.SessionRequest) (irma.RequestorRequest, err
 		return &irma.SignatureRequestorRequest{Request: r}, nil
 	case *irma.IssuanceRequest:
 		return &irma.IdentityProviderRequest{Request: r}, nil
+	case *irma.MultiSignatureRequest:
+		return &irma.MultiSignatureRequestorRequest{Request: r}, nil
 	default:
 		return nil, errors.New("Invalid session type")
 	}
@@ -13,7 +13,8 @@ var CheckCommand = &cobra.Command{
 	Short: "Check server configuration correctness",
 	Long: `check reads the server configuration like the main command does, from a
 configuration file, command line flags, or environmental variables, and checks
-that the configuration is valid.
+that the configuration is valid. Warnings are shown for the public keys of issuer
+private keys that are expired or expire soon.
 
 Specify -v to see the configuration.`,
 	Run: func(command *cobra.Command, args []string) {
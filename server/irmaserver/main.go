@@ -7,6 +7,7 @@ package irmaserver
 import (
 	"io/ioutil"
 	"net/http"
+	"sync"
 
 	"github.com/go-errors/errors"
 	"github.com/privacybydesign/irmago"
@@ -17,7 +18,8 @@ import (
 // Server is an irmaserver instance.
 type Server struct {
 	*servercore.Server
-	handlers map[string]SessionHandler
+	handlers     map[string]SessionHandler
+	handlersLock sync.Mutex
 }
 
 // SessionHandler is a function that can handle a session result
@@ -66,12 +68,42 @@ func (s *Server) StartSession(request interface{}, handler SessionHandler) (*irm
 	if err != nil {
 		return nil, "", err
 	}
-	if handler != nil {
-		s.handlers[token] = handler
-	}
+	s.setHandler(token, handler)
 	return qr, token, nil
 }
 
+// StartMultiSignSession starts a multi-signature session, in which each of the signers of the
+// irma.MultiSignatureRequest signs the message in their own signature session, for which a
+// session pointer is returned (in the order of the signers in the request). The handler, if
+// specified, is run once all signers have finished, with a session result containing the
+// signature bundle. The returned token refers to the multi-signature session as a whole.
+func StartMultiSignSession(request interface{}, handler SessionHandler) ([]*irma.Qr, string, error) {
+	return s.StartMultiSignSession(request, handler)
+}
+func (s *Server) StartMultiSignSession(request interface{}, handler SessionHandler) ([]*irma.Qr, string, error) {
+	qrs, token, err := s.Server.StartMultiSignSession(request)
+	if err != nil {
+		return nil, "", err
+	}
+	s.setHandler(token, handler)
+	return qrs, token, nil
+}
+
+func (s *Server) setHandler(token string, handler SessionHandler) {
+	if handler == nil {
+		return
+	}
+	s.handlersLock.Lock()
+	defer s.handlersLock.Unlock()
+	s.handlers[token] = handler
+}
+
+func (s *Server) handler(token string) SessionHandler {
+	s.handlersLock.Lock()
+	defer s.handlersLock.Unlock()
+	return s.handlers[token]
+}
+
 // GetSessionResult retrieves the result of the specified IRMA session.
 func GetSessionResult(token string) *server.SessionResult {
 	return s.GetSessionResult(token)
@@ -145,7 +177,7 @@ func (s *Server) HandlerFunc() http.HandlerFunc {
 			_ = server.LogError(errors.WrapPrefix(err, "http.ResponseWriter.Write() returned error", 0))
 		}
 		if result != nil && result.Status.Finished() {
-			if handler := s.handlers[result.Token]; handler != nil {
+			if handler := s.handler(result.Token); handler != nil {
 				go handler(result)
 			}
 		}
@@ -123,7 +123,7 @@ func (conf *Configuration) CanVerifyOrSign(requestor string, action irma.Action,
 		permissions = append(conf.Requestors[requestor].Disclosing, conf.Disclosing...)
 	case irma.ActionIssuing:
 		permissions = append(conf.Requestors[requestor].Disclosing, conf.Disclosing...)
-	case irma.ActionSigning:
+	case irma.ActionSigning, irma.ActionMultiSigning:
 		permissions = append(conf.Requestors[requestor].Signing, conf.Signing...)
 	}
 	if len(permissions) == 0 { // requestor is not present in the permissions
@@ -280,6 +280,29 @@ func (conf *Configuration) initialize() error {
 	return nil
 }
 
+// configurationUpdated is called when the IRMA configuration has been updated, and checks that
+// the requestor permissions and static sessions still refer to existing schemes and attributes.
+func (conf *Configuration) configurationUpdated(_ *irma.ConfigurationDiff) {
+	if err := conf.validatePermissions(); err != nil {
+		_ = server.LogError(errors.WrapPrefix(err, "Permissions invalid after IRMA configuration update", 0))
+	}
+	for name, rrequest := range conf.staticSessions {
+		err := rrequest.SessionRequest().Disclosure().Disclose.Iterate(func(attr *irma.AttributeRequest) error {
+			if attr.Type.IsCredential() {
+				if !conf.IrmaConfiguration.ContainsCredentialType(attr.Type.CredentialTypeIdentifier()) {
+					return errors.Errorf("unknown credential type %s", attr.Type.CredentialTypeIdentifier())
+				}
+			} else if !conf.IrmaConfiguration.ContainsAttributeType(attr.Type) {
+				return errors.Errorf("unknown attribute type %s", attr.Type)
+			}
+			return nil
+		})
+		if err != nil {
+			_ = server.LogError(errors.WrapPrefix(err, "Static session "+name+" invalid after IRMA configuration update", 0))
+		}
+	}
+}
+
 func (conf *Configuration) validatePermissions() error {
 	if conf.DisableRequestorAuthentication && len(conf.Requestors) != 0 {
 		return errors.New("Requestors must not be configured when requestor authentication is disabled")
@@ -317,28 +340,28 @@ func (conf *Configuration) validatePermissionSet(requestor string, requestorperm
 				}
 			}
 			if len(parts) > 0 && parts[0] != "*" {
-				if conf.IrmaConfiguration.SchemeManagers[irma.NewSchemeManagerIdentifier(parts[0])] == nil {
+				if conf.IrmaConfiguration.SchemeManager(irma.NewSchemeManagerIdentifier(parts[0])) == nil {
 					errs = append(errs, fmt.Sprintf("%s %s permission '%s': unknown scheme", requestor, typ, permission))
 					continue // no sense in checking if issuer, credtype or attr type are known; they won't be
 				}
 			}
 			if len(parts) > 1 && parts[1] != "*" {
 				id := irma.NewIssuerIdentifier(strings.Join(parts[:2], "."))
-				if conf.IrmaConfiguration.Issuers[id] == nil {
+				if conf.IrmaConfiguration.Issuer(id) == nil {
 					errs = append(errs, fmt.Sprintf("%s %s permission '%s': unknown issuer", requestor, typ, permission))
 					continue
 				}
 			}
 			if len(parts) > 2 && parts[2] != "*" {
 				id := irma.NewCredentialTypeIdentifier(strings.Join(parts[:3], "."))
-				if conf.IrmaConfiguration.CredentialTypes[id] == nil {
+				if conf.IrmaConfiguration.CredentialType(id) == nil {
 					errs = append(errs, fmt.Sprintf("%s %s permission '%s': unknown credential type", requestor, typ, permission))
 					continue
 				}
 			}
 			if len(parts) > 3 && parts[3] != "*" {
 				id := irma.NewAttributeTypeIdentifier(strings.Join(parts[:4], "."))
-				if conf.IrmaConfiguration.AttributeTypes[id] == nil {
+				if conf.IrmaConfiguration.AttributeType(id) == nil {
 					errs = append(errs, fmt.Sprintf("%s %s permission '%s': unknown attribute type", requestor, typ, permission))
 					continue
 				}
@@ -34,6 +34,8 @@ type Server struct {
 	irmaserv *irmaserver.Server
 	stop     chan struct{}
 	stopped  chan struct{}
+
+	removeUpdateListener func()
 }
 
 // Start the server. If successful then it will not return until Stop() is called.
@@ -133,6 +135,7 @@ func filterStopError(err error) error {
 }
 
 func (s *Server) Stop() {
+	s.removeUpdateListener()
 	s.irmaserv.Stop()
 	s.stop <- struct{}{}
 	<-s.stopped
@@ -150,8 +153,9 @@ func New(config *Configuration) (*Server, error) {
 		return nil, err
 	}
 	return &Server{
-		conf:     config,
-		irmaserv: irmaserv,
+		conf:                 config,
+		irmaserv:             irmaserv,
+		removeUpdateListener: config.IrmaConfiguration.AddUpdateListener(config.configurationUpdated),
 	}, nil
 }
 
@@ -179,6 +183,11 @@ func (s *Server) attachClientEndpoints(router *chi.Mux) {
 		}
 		r.Post("/irma/session/{name}", s.handleCreateStatic)
 	})
+
+	// Logos of the issuers and credential types in the schemes, at stable URLs so that frontends
+	// showing credentials need not host them themselves
+	router.Get("/logos/{scheme}/{issuer}/logo.png", s.handleIssuerLogo)
+	router.Get("/logos/{scheme}/{issuer}/{credtype}/logo.png", s.handleCredentialTypeLogo)
 }
 
 // Handler returns a http.Handler that handles all IRMA requestor messages
@@ -347,6 +356,18 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Everything is authenticated and parsed, we're good to go!
+	if request.Action() == irma.ActionMultiSigning {
+		qrs, token, err := s.irmaserv.StartMultiSignSession(rrequest, s.doResultCallback)
+		if err != nil {
+			server.WriteError(w, server.ErrorInvalidRequest, err.Error())
+			return
+		}
+		server.WriteJson(w, server.SessionPackage{
+			SessionPtrs: qrs,
+			Token:       token,
+		})
+		return
+	}
 	qr, token, err := s.irmaserv.StartSession(rrequest, s.doResultCallback)
 	if err != nil {
 		server.WriteError(w, server.ErrorInvalidRequest, err.Error())
@@ -463,6 +484,8 @@ func (s *Server) handleJwtProofs(w http.ResponseWriter, r *http.Request) {
 		claims["sub"] = "abs_result"
 	case irma.ActionIssuing:
 		claims["sub"] = "issue_result"
+	case irma.ActionMultiSigning:
+		claims["sub"] = "multisignature_result"
 	default:
 		server.WriteError(w, server.ErrorInvalidRequest, "")
 		return
@@ -488,6 +511,9 @@ func (s *Server) handleJwtProofs(w http.ResponseWriter, r *http.Request) {
 	if res.Signature != nil {
 		claims["signature"] = res.Signature
 	}
+	if res.SignatureBundle != nil {
+		claims["signatureBundle"] = res.SignatureBundle
+	}
 
 	// Sign the jwt and return it
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
@@ -501,6 +527,35 @@ func (s *Server) handleJwtProofs(w http.ResponseWriter, r *http.Request) {
 	server.WriteString(w, resultJwt)
 }
 
+func (s *Server) handleIssuerLogo(w http.ResponseWriter, r *http.Request) {
+	id := irma.NewIssuerIdentifier(chi.URLParam(r, "scheme") + "." + chi.URLParam(r, "issuer"))
+	logo, err := s.conf.IrmaConfiguration.IssuerLogo(id)
+	s.writeLogo(w, logo, err)
+}
+
+func (s *Server) handleCredentialTypeLogo(w http.ResponseWriter, r *http.Request) {
+	id := irma.NewCredentialTypeIdentifier(
+		chi.URLParam(r, "scheme") + "." + chi.URLParam(r, "issuer") + "." + chi.URLParam(r, "credtype"),
+	)
+	logo, err := s.conf.IrmaConfiguration.CredentialTypeLogo(id)
+	s.writeLogo(w, logo, err)
+}
+
+func (s *Server) writeLogo(w http.ResponseWriter, logo []byte, err error) {
+	if err != nil {
+		_ = server.LogError(err)
+		server.WriteError(w, server.ErrorUnknown, err.Error())
+		return
+	}
+	if logo == nil {
+		server.WriteError(w, server.ErrorNotFound, "")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_, _ = w.Write(logo)
+}
+
 func (s *Server) handlePublicKey(w http.ResponseWriter, r *http.Request) {
 	if s.conf.jwtPrivateKey == nil {
 		server.WriteError(w, server.ErrorUnsupported, "")
@@ -23,6 +23,8 @@ const (
 	ProofStatusUnmatchedRequest  = ProofStatus("UNMATCHED_REQUEST")  // Proof does not correspond to a specified request
 	ProofStatusMissingAttributes = ProofStatus("MISSING_ATTRIBUTES") // Proof does not contain all requested attributes
 	ProofStatusExpired           = ProofStatus("EXPIRED")            // Attributes were expired at proof creation time (now, or according to timestamp in case of abs)
+	ProofStatusInvalidDigest     = ProofStatus("INVALID_DIGEST")     // Signed file does not match the digest in the file signature
+	ProofStatusExpiredPublicKey  = ProofStatus("EXPIRED_PUBLIC_KEY") // Proof was made using an issuer public key that was expired at proof creation time
 
 	AttributeProofStatusPresent = AttributeProofStatus("PRESENT") // Attribute is disclosed and matches the value
 	AttributeProofStatusExtra   = AttributeProofStatus("EXTRA")   // Attribute is disclosed, but wasn't requested in request
@@ -41,7 +43,10 @@ type DisclosedAttribute struct {
 // ProofList is a gabi.ProofList with some extra methods.
 type ProofList gabi.ProofList
 
-var ErrorMissingPublicKey = errors.New("Missing public key")
+var (
+	ErrorMissingPublicKey = errors.New("Missing public key")
+	ErrorExpiredPublicKey = errors.New("Expired public key")
+)
 
 // ExtractPublicKeys returns the public keys of each proof in the proofList, in the same order,
 // for later use in verification of the proofList. If one of the proofs is not a ProofD
@@ -69,8 +74,10 @@ func (pl ProofList) ExtractPublicKeys(configuration *Configuration) ([]*gabi.Pub
 	return publicKeys, nil
 }
 
-// VerifyProofs verifies the proofs cryptographically.
-func (pl ProofList) VerifyProofs(configuration *Configuration, context *big.Int, nonce *big.Int, publickeys []*gabi.PublicKey, isSig bool) (bool, error) {
+// VerifyProofs cryptographically verifies the proofs, using the specified public keys if not nil,
+// and otherwise those referred to by the proofs. All public keys must be valid at validAt (or now,
+// if validAt is nil); if the proofs are valid but one of the keys is not, ErrorExpiredPublicKey is returned.
+func (pl ProofList) VerifyProofs(configuration *Configuration, context *big.Int, nonce *big.Int, publickeys []*gabi.PublicKey, validAt *time.Time, isSig bool) (bool, error) {
 	// Empty proof lists are allowed (if consistent with the session request, which is checked elsewhere)
 	if len(pl) == 0 {
 		return true, nil
@@ -92,7 +99,7 @@ func (pl ProofList) VerifyProofs(configuration *Configuration, context *big.Int,
 	keyshareServers := make([]string, len(pl))
 	for i := range pl {
 		schemeID := NewIssuerIdentifier(publickeys[i].Issuer).SchemeManagerIdentifier()
-		if !configuration.SchemeManagers[schemeID].Distributed() {
+		if !configuration.SchemeManager(schemeID).Distributed() {
 			keyshareServers[i] = "." // dummy value: no IRMA scheme will ever have this name
 		} else {
 			keyshareServers[i] = schemeID.Name()
@@ -123,6 +130,17 @@ func (pl ProofList) VerifyProofs(configuration *Configuration, context *big.Int,
 		}
 	}
 
+	// Check that the public keys were not expired at the time the proofs were created
+	if validAt == nil {
+		now := time.Now()
+		validAt = &now
+	}
+	for _, pk := range publickeys {
+		if PublicKeyExpired(pk, *validAt) {
+			return false, ErrorExpiredPublicKey
+		}
+	}
+
 	return true, nil
 }
 
@@ -227,6 +245,7 @@ func (d *Disclosure) DisclosedAttributes(configuration *Configuration, condiscon
 func parseAttribute(index int, metadata *MetadataAttribute, attr *big.Int) (*DisclosedAttribute, *string, error) {
 	var attrid AttributeTypeIdentifier
 	var attrval *string
+	var attrtype *AttributeType
 	credtype := metadata.CredentialType()
 	if credtype == nil {
 		return nil, nil, errors.New("ProofList contained a disclosure proof of an unkown credential type")
@@ -236,7 +255,8 @@ func parseAttribute(index int, metadata *MetadataAttribute, attr *big.Int) (*Dis
 		p := "present"
 		attrval = &p
 	} else {
-		attrid = credtype.AttributeTypes[index-2].GetAttributeTypeIdentifier()
+		attrtype = credtype.AttributeTypes[index-2]
+		attrid = attrtype.GetAttributeTypeIdentifier()
 		attrval = decodeAttribute(attr, metadata.Version())
 	}
 	status := AttributeProofStatusPresent
@@ -246,7 +266,7 @@ func parseAttribute(index int, metadata *MetadataAttribute, attr *big.Int) (*Dis
 	return &DisclosedAttribute{
 		Identifier:   attrid,
 		RawValue:     attrval,
-		Value:        NewTranslatedString(attrval),
+		Value:        attrtype.Translate(attrval),
 		Status:       status,
 		IssuanceTime: Timestamp(metadata.SigningDate()),
 	}, attrval, nil
@@ -257,10 +277,14 @@ func (d *Disclosure) VerifyAgainstDisjunctions(
 	required AttributeConDisCon,
 	context, nonce *big.Int,
 	publickeys []*gabi.PublicKey,
+	validAt *time.Time,
 	issig bool,
 ) ([][]*DisclosedAttribute, ProofStatus, error) {
 	// Cryptographically verify the IRMA disclosure proofs in the signature
-	valid, err := ProofList(d.Proofs).VerifyProofs(configuration, context, nonce, publickeys, issig)
+	valid, err := ProofList(d.Proofs).VerifyProofs(configuration, context, nonce, publickeys, validAt, issig)
+	if err == ErrorExpiredPublicKey {
+		return nil, ProofStatusExpiredPublicKey, nil
+	}
 	if !valid || err != nil {
 		return nil, ProofStatusInvalid, err
 	}
@@ -280,7 +304,7 @@ func (d *Disclosure) VerifyAgainstDisjunctions(
 }
 
 func (d *Disclosure) Verify(configuration *Configuration, request *DisclosureRequest) ([][]*DisclosedAttribute, ProofStatus, error) {
-	list, status, err := d.VerifyAgainstDisjunctions(configuration, request.Disclose, request.GetContext(), request.GetNonce(nil), nil, false)
+	list, status, err := d.VerifyAgainstDisjunctions(configuration, request.Disclose, request.GetContext(), request.GetNonce(nil), nil, nil, false)
 	if err != nil {
 		return list, status, err
 	}
@@ -303,8 +327,6 @@ func (d *Disclosure) Verify(configuration *Configuration, request *DisclosureReq
 // The signature request is optional; if it is nil then the attribute-based signature is still verified, and all
 // containing attributes returned in the result.
 func (sm *SignedMessage) Verify(configuration *Configuration, request *SignatureRequest) ([][]*DisclosedAttribute, ProofStatus, error) {
-	var message string
-
 	if len(sm.Signature) == 0 {
 		return nil, ProofStatusInvalid, nil
 	}
@@ -315,29 +337,36 @@ func (sm *SignedMessage) Verify(configuration *Configuration, request *Signature
 			return nil, ProofStatusUnmatchedRequest, nil
 		}
 		// If there is a request, then the signed message must be that of the request
-		message = request.Message
-	} else {
-		// If not, we just verify that the signed message is a valid signature over its contained message
-		message = sm.Message
+		return sm.verify(configuration, request.Disclose, request.Message)
 	}
 
-	// Now, cryptographically verify the IRMA disclosure proofs in the signature
-	var required AttributeConDisCon
-	if request != nil {
-		required = request.Disclose
+	// If not, we just verify that the signed message is a valid signature over its contained message
+	return sm.verify(configuration, nil, sm.Message)
+}
+
+// verify cryptographically verifies the IRMA disclosure proofs in the signature against the
+// required attributes, and its timestamp against the specified message.
+func (sm *SignedMessage) verify(configuration *Configuration, required AttributeConDisCon, message string) ([][]*DisclosedAttribute, ProofStatus, error) {
+	if len(sm.Signature) == 0 {
+		return nil, ProofStatusInvalid, nil
+	}
+
+	// The public keys and credentials must have been valid when the signature was created
+	t := time.Now()
+	if sm.Timestamp != nil {
+		t = time.Unix(sm.Timestamp.Time, 0)
 	}
-	result, status, err := sm.Disclosure().VerifyAgainstDisjunctions(configuration, required, sm.Context, sm.GetNonce(), nil, true)
+
+	result, status, err := sm.Disclosure().VerifyAgainstDisjunctions(configuration, required, sm.Context, sm.GetNonce(), nil, &t, true)
 	if status != ProofStatusValid || err != nil {
 		return result, status, err
 	}
 
 	// Next, verify the timestamp
-	t := time.Now()
 	if sm.Timestamp != nil {
 		if err := sm.VerifyTimestamp(message, configuration); err != nil {
 			return nil, ProofStatusInvalidTimestamp, nil
 		}
-		t = time.Unix(sm.Timestamp.Time, 0)
 	}
 
 	// Check if a credential was expired at creation time, according to the timestamp